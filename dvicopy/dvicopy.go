@@ -0,0 +1,210 @@
+// Package dvicopy rewrites DVI files. Like the TeXware program DVIcopy it
+// replaces the characters of virtual fonts by the contents of their
+// packets, so that the result can be used with drivers that don't know
+// virtual fonts. The file is written anew with dviwriter: the fonts are
+// numbered from 0 in the order of their first use and the movements use
+// the w, x, y and z registers wherever possible.
+//
+// The dir commands of pTeX and the glyphs of XDV files are not copied.
+package dvicopy
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/tfm"
+)
+
+// Options controls what Copy does.
+type Options struct {
+	PageSpec string             // the first page to copy, see dvitype.Dvitype.PageSpec; all pages if empty
+	MaxPages int                // the number of pages to copy, 0 means all
+	Finder   dvitype.FileFinder // opens the TFM and VF files, if nil they are opened in the current directory
+	// KeepVirtual copies the characters of virtual fonts unchanged.
+	KeepVirtual bool
+	// Specials starting with one of the prefixes are removed, the empty
+	// prefix removes all specials.
+	DropSpecials []string
+}
+
+// font is a font of the input file.
+type font struct {
+	def     dvitype.FontDef
+	num     int       // the number in the output, -1 if not used yet
+	metrics *tfm.Font // nil if the TFM file could not be loaded
+}
+
+type fontKey struct {
+	name string
+	size int
+}
+
+// copier is the dvitype.Handler that writes the output.
+type copier struct {
+	dvitype.NopHandler
+	w     *dviwriter.Writer
+	opts  Options
+	fonts map[int]*font
+	nums  map[fontKey]int // output numbers of the fonts used so far
+	h, v  int             // the position of the output
+	stack [][2]int
+}
+
+// Copy reads the DVI file from r and writes the rewritten file to w. If a
+// TFM or VF file is bad, Copy writes the complete file and returns a
+// *dvitype.FontError.
+func Copy(w io.Writer, r io.ReadSeeker, opts Options) error {
+	c := &copier{
+		w:     dviwriter.New(w),
+		opts:  opts,
+		fonts: make(map[int]*font),
+		nums:  make(map[fontKey]int),
+	}
+	if err := c.preamble(r); err != nil {
+		return err
+	}
+	d := dvitype.New(r)
+	d.Output = io.Discard
+	if opts.PageSpec != "" {
+		d.PageSpec = opts.PageSpec
+	}
+	if opts.MaxPages > 0 {
+		d.MaxPages = opts.MaxPages
+	}
+	d.Finder = opts.Finder
+	d.ExpandVirtual = !opts.KeepVirtual
+	d.Handler = c
+	err := d.Run()
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		return err
+	}
+	if cerr := c.w.Close(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// preamble copies the unit, magnification and comment of the input file.
+func (c *copier) preamble(r io.ReadSeeker) error {
+	pre, err := dvitype.ReadPreamble(r)
+	if err != nil {
+		return err
+	}
+	c.w.Num, c.w.Den, c.w.Mag, c.w.Comment = pre.Num, pre.Den, pre.Mag, pre.Comment
+	_, err = r.Seek(0, io.SeekStart)
+	return err
+}
+
+func (c *copier) openFile(name string) (io.ReadCloser, error) {
+	if c.opts.Finder == nil {
+		return os.Open(name)
+	}
+	return c.opts.Finder.OpenFile(name)
+}
+
+func (c *copier) FontDef(fd dvitype.FontDef) {
+	c.fonts[fd.Num] = &font{def: fd, num: -1}
+}
+
+// use selects the font f in the output and defines it first if needed.
+func (c *copier) use(f *font) {
+	if f.num < 0 {
+		key := fontKey{f.def.Area + f.def.Name, f.def.ScaledSize}
+		num, ok := c.nums[key]
+		if !ok {
+			num = len(c.nums)
+			c.nums[key] = num
+			c.w.FontDef(dviwriter.FontDef{
+				Num:        num,
+				Checksum:   uint32(f.def.Checksum),
+				ScaledSize: f.def.ScaledSize,
+				DesignSize: f.def.DesignSize,
+				Area:       f.def.Area,
+				Name:       f.def.Name,
+			})
+		}
+		f.num = num
+		if r, err := c.openFile(f.def.Name + ".tfm"); err == nil {
+			f.metrics, _ = tfm.Parse(r)
+			r.Close()
+		}
+	}
+	c.w.SetFont(f.num)
+}
+
+// moveTo moves the output to h, v.
+func (c *copier) moveTo(h, v int) {
+	c.w.Right(h - c.h)
+	c.w.Down(v - c.v)
+	c.h, c.v = h, v
+}
+
+func (c *copier) BeginPage(counts [10]int32, pos int64) {
+	var wc [10]int
+	for k, n := range counts {
+		wc[k] = int(n)
+	}
+	c.w.BeginPage(wc)
+	c.h, c.v = 0, 0
+	c.stack = c.stack[:0]
+}
+
+func (c *copier) SetChar(font, code, h, v int) {
+	f := c.fonts[font]
+	if f == nil {
+		return
+	}
+	c.use(f)
+	c.moveTo(h, v)
+	// without metrics the position after the character is unknown
+	ch, ok := tfm.Char{}, false
+	if f.metrics != nil {
+		ch, ok = f.metrics.Char(code)
+	}
+	if !ok {
+		c.w.PutChar(code)
+		return
+	}
+	width := tfm.Scale(ch.Width, f.def.ScaledSize)
+	c.w.SetChar(code, width)
+	c.h += width
+}
+
+func (c *copier) SetRule(h, v, height, width int) {
+	c.moveTo(h, v)
+	c.w.SetRule(height, width)
+	c.h += width
+}
+
+func (c *copier) Special(data []byte, h, v int) {
+	for _, prefix := range c.opts.DropSpecials {
+		if strings.HasPrefix(string(data), prefix) {
+			return
+		}
+	}
+	c.moveTo(h, v)
+	c.w.Special(data)
+}
+
+func (c *copier) Push() {
+	c.w.Push()
+	c.stack = append(c.stack, [2]int{c.h, c.v})
+}
+
+func (c *copier) Pop() {
+	if len(c.stack) == 0 {
+		return
+	}
+	c.w.Pop()
+	c.h, c.v = c.stack[len(c.stack)-1][0], c.stack[len(c.stack)-1][1]
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+func (c *copier) EndPage() {
+	c.w.EndPage()
+}
@@ -0,0 +1,77 @@
+// Command dvicopy rewrites a DVI file with the characters of virtual
+// fonts replaced by the fonts they are made of.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/speedata/gotex/dvicopy"
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/internal/cmdline"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dvicopy [options] INFILE OUTFILE")
+		flag.PrintDefaults()
+	}
+	curdir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var pagespec = flag.String("page-start", "*", "start at PAGE-SPEC, for example `2' or `5.*.-2'")
+	var maxpages = flag.Int("max-pages", 0, "copy NUMBER pages; default all")
+	var basedir = flag.String("basedir", curdir, "Set the root directory with TFM and VF files")
+	var texmf = flag.String("texmf", "", "search TFM and VF files like kpathsea in these TEXMF trees (a path list); default $TEXMF")
+	var keepVF = flag.Bool("keep-vf", false, "don't replace the characters of virtual fonts")
+	var drop = flag.String("drop-specials", "", "remove the specials starting with one of these comma separated prefixes")
+	var strip = flag.Bool("strip-specials", false, "remove all specials")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "dvicopy: Need exactly two file arguments.")
+		fmt.Fprintln(os.Stderr, "Try `dvicopy --help' for more information.")
+		os.Exit(1)
+	}
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	opts := dvicopy.Options{
+		PageSpec:    *pagespec,
+		MaxPages:    *maxpages,
+		Finder:      cmdline.Finder(*basedir, *texmf),
+		KeepVirtual: *keepVF,
+	}
+	if *drop != "" {
+		opts.DropSpecials = strings.Split(*drop, ",")
+	}
+	if *strip {
+		opts.DropSpecials = []string{""}
+	}
+
+	var out bytes.Buffer
+	err = dvicopy.Copy(&out, in, opts)
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if werr := os.WriteFile(flag.Arg(1), out.Bytes(), 0644); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(4)
+	}
+}
@@ -0,0 +1,131 @@
+package dvicopy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/internal/testfont"
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+// testVF returns a virtual font with the local font real where A is BB.
+func testVF() []byte {
+	b := []byte{247, 202, 0, 0, 0, 0, 0, 0, 0xa0, 0, 0}
+	b = append(b, 243, 0, 0, 0, 0, 0, 0, 0x10, 0, 0, 0, 0xa0, 0, 0, 0, 4)
+	b = append(b, "real"...)
+	b = append(b, 2, 'A', 0x10, 0, 0, 'B', 'B')
+	return append(b, 248, 248, 248, 248)
+}
+
+func testDVI(t *testing.T) []byte {
+	return testfont.DVI(t, func(w *dviwriter.Writer) {
+		w.FontDef(dviwriter.FontDef{Num: 5, ScaledSize: 655360, DesignSize: 655360, Name: "virt"})
+		w.FontDef(dviwriter.FontDef{Num: 9, ScaledSize: 655360, DesignSize: 655360, Name: "real"})
+		w.BeginPage([10]int{1})
+		w.Down(1000)
+		w.SetFont(5)
+		w.SetChar('A', 655360)
+		w.Special([]byte("color push"))
+		w.Special([]byte("pdf:literal"))
+		w.SetFont(9)
+		w.SetChar('C', 327680)
+		w.EndPage()
+		w.BeginPage([10]int{2})
+		w.SetFont(9)
+		w.Right(1000)
+		w.SetChar('B', 327680)
+		w.EndPage()
+	})
+}
+
+func commands(pg dvitype.Page) string {
+	var names []string
+	for _, c := range pg.Commands {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestCopy(t *testing.T) {
+	finder := simplefilefinder.Map{
+		"virt.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'C', Width: 1 << 20}),
+		"virt.vf":  testVF(),
+		"real.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'C', Width: 1 << 19}),
+	}
+	var out bytes.Buffer
+	if err := Copy(&out, bytes.NewReader(testDVI(t)), Options{Finder: finder, DropSpecials: []string{"pdf:"}}); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := dvitype.Parse(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Fonts) != 1 || doc.Fonts[0].Num != 0 || doc.Fonts[0].Name != "real" {
+		t.Errorf("unexpected fonts %+v", doc.Fonts)
+	}
+	exp := []string{
+		"fntdef1 fntnum0 down2 setchar66 setchar66 xxx1 setchar67 eop",
+		"fntnum0 right2 setchar66 eop",
+	}
+	if len(doc.Pages) != 2 {
+		t.Fatalf("want 2 pages, got %d", len(doc.Pages))
+	}
+	for i, pg := range doc.Pages {
+		if res := commands(pg); res != exp[i] {
+			t.Errorf("page %d: Should be %q, but is %q", i+1, exp[i], res)
+		}
+	}
+	if c := doc.Pages[0].Commands[5]; string(c.Special) != "color push" {
+		t.Errorf("unexpected special %q", c.Special)
+	}
+
+	// no warnings from dvitype
+	var log bytes.Buffer
+	d := dvitype.New(bytes.NewReader(out.Bytes()))
+	d.Output = &bytes.Buffer{}
+	d.Log = &log
+	d.Finder = finder
+	if err = d.Run(); err != nil || log.Len() > 0 {
+		t.Errorf("dvitype: %v\n%s", err, log.String())
+	}
+}
+
+func TestCopyPages(t *testing.T) {
+	finder := simplefilefinder.Map{
+		"virt.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'C', Width: 1 << 20}),
+		"real.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'C', Width: 1 << 19}),
+	}
+	var out bytes.Buffer
+	opts := Options{Finder: finder, PageSpec: "2", KeepVirtual: true, DropSpecials: []string{""}}
+	if err := Copy(&out, bytes.NewReader(testDVI(t)), opts); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := dvitype.Parse(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Pages) != 1 || doc.Pages[0].Counts[0] != 2 {
+		t.Fatalf("unexpected pages %+v", doc.Pages)
+	}
+	if res, exp := commands(doc.Pages[0]), "fntdef1 fntnum0 right2 setchar66 eop"; res != exp {
+		t.Errorf("Should be %q, but is %q", exp, res)
+	}
+
+	out.Reset()
+	opts = Options{Finder: finder, KeepVirtual: true, DropSpecials: []string{""}, MaxPages: 1}
+	if err = Copy(&out, bytes.NewReader(testDVI(t)), opts); err != nil {
+		t.Fatal(err)
+	}
+	if doc, err = dvitype.Parse(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Fonts) != 2 || len(doc.Pages) != 1 {
+		t.Fatalf("unexpected fonts %+v or pages %d", doc.Fonts, len(doc.Pages))
+	}
+	if res, exp := commands(doc.Pages[0]), "fntdef1 fntnum0 down2 setchar65 fntdef1 fntnum1 setchar67 eop"; res != exp {
+		t.Errorf("Should be %q, but is %q", exp, res)
+	}
+}
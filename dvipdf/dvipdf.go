@@ -0,0 +1,412 @@
+// Package dvipdf converts DVI files to PDF.
+//
+// The fonts are looked up in a font map file such as pdftex.map. Type 1
+// fonts are embedded, as subsets unless the map line asks for the whole
+// font (<<), and the characters are re-encoded with the encoding file of
+// the map line. Fonts without a font file in the map are referenced by
+// their PostScript name only. Virtual fonts are replaced by the fonts they
+// are made of.
+//
+// These specials are supported:
+//
+//	papersize=210mm,297mm      the size of the page and the following pages
+//	color push rgb 1 0 0       also cmyk c m y k, gray g and Black
+//	color pop
+//	color rgb 1 0 0            replaces the whole color stack
+//	pdf:literal ops            PDF operators, the origin is at the current point
+//	pdf:literal direct ops     PDF operators in page coordinates
+//	pdf:content ops            like pdf:literal, in a q/Q pair
+//	pdf:bcolor [r g b]         like color push, also [g] and [c m y k]
+//	pdf:ecolor                 like color pop
+//	pdf:docinfo << ... >>      entries of the document information
+//
+// Other specials are ignored. The default paper size is A4; the origin of
+// the DVI file is one inch from the top and the left side of the page.
+package dvipdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/tfm"
+)
+
+// ErrFontNotMapped is wrapped by the *dvitype.FontError that Convert
+// returns if a font is not in the map file.
+var ErrFontNotMapped = errors.New("font is not in the map file")
+
+// Options controls what Convert does.
+type Options struct {
+	PageSpec string             // the first page, see dvitype.Dvitype.PageSpec; all pages if empty
+	MaxPages int                // the number of pages, 0 means all
+	Finder   dvitype.FileFinder // opens the TFM, VF, map, Type 1 and encoding files, if nil they are opened in the current directory
+	MapFile  string             // the font map, pdftex.map if empty
+}
+
+// dviFont is a font of the DVI file.
+type dviFont struct {
+	pdf  *pdfFont
+	size float64 // in bp
+}
+
+// converter is the dvitype.Handler that writes the PDF file.
+type converter struct {
+	dvitype.NopHandler
+	opts     Options
+	pdf      *pdfWriter
+	scale    float64 // bp per DVI unit
+	fontmap  *fontmap.Map
+	fonts    map[int]*dviFont
+	pdffonts map[string]*pdfFont // by TFM name
+	fonterr  *dvitype.FontError
+	pagesID  int
+	pages    []int // object numbers of the pages
+	info     []string
+
+	width, height float64     // of the paper in bp
+	next          *[2]float64 // the paper size from the next page on
+	colors        []string    // the color stack, operators that set the color
+	nfonts        int         // fonts in the PDF file
+
+	// the current page
+	content   bytes.Buffer
+	drawn     bool // something is on the page
+	resources map[*pdfFont]bool
+	inText    bool
+	curFont   *dviFont
+}
+
+// Convert reads the DVI file from r and writes the PDF file to w. If a
+// font is not in the map file or a font file is missing or bad, Convert
+// writes the complete file and returns a *dvitype.FontError.
+func Convert(w io.Writer, r io.ReadSeeker, opts Options) error {
+	pre, err := dvitype.ReadPreamble(r)
+	if err != nil {
+		return err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	c := &converter{
+		opts:     opts,
+		scale:    float64(pre.Num) / float64(pre.Den) * 72 / 254000 * float64(pre.Mag) / 1000,
+		fonts:    make(map[int]*dviFont),
+		pdffonts: make(map[string]*pdfFont),
+		width:    595.2756,
+		height:   841.8898,
+	}
+	mapfile := opts.MapFile
+	if mapfile == "" {
+		mapfile = "pdftex.map"
+	}
+	c.fontmap = fontmap.New()
+	if err = c.fontmap.ReadFile(opts.Finder, mapfile); err != nil {
+		return err
+	}
+
+	c.pdf = newPDFWriter(w)
+	c.pagesID = c.pdf.alloc()
+	d := dvitype.New(r)
+	d.Output = io.Discard
+	if opts.PageSpec != "" {
+		d.PageSpec = opts.PageSpec
+	}
+	if opts.MaxPages > 0 {
+		d.MaxPages = opts.MaxPages
+	}
+	d.Finder = opts.Finder
+	d.ExpandVirtual = true
+	d.Handler = c
+	err = d.Run()
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		return err
+	}
+	if ferr := c.finish(); ferr != nil {
+		return ferr
+	}
+	if err == nil && c.fonterr != nil {
+		err = c.fonterr
+	}
+	return err
+}
+
+func (c *converter) openFile(name string) (io.ReadCloser, error) {
+	if c.opts.Finder == nil {
+		return os.Open(name)
+	}
+	return c.opts.Finder.OpenFile(name)
+}
+
+// fail records the first font error.
+func (c *converter) fail(name string, err error) {
+	if c.fonterr == nil {
+		c.fonterr = &dvitype.FontError{Name: name, Err: err}
+	}
+}
+
+// finish writes the fonts, the page tree and the trailer.
+func (c *converter) finish() error {
+	var fonts []*pdfFont
+	for _, f := range c.pdffonts {
+		if f.id > 0 {
+			fonts = append(fonts, f)
+		}
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].id < fonts[j].id })
+	for _, f := range fonts {
+		c.writeFont(f)
+	}
+	kids := make([]string, len(c.pages))
+	for i, id := range c.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	c.pdf.object(c.pagesID, "<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(c.pages))
+	root := c.pdf.alloc()
+	c.pdf.object(root, "<< /Type /Catalog /Pages %d 0 R >>", c.pagesID)
+	info := c.pdf.alloc()
+	c.pdf.object(info, "<< /Producer (gotex dvipdf)%s >>", strings.Join(c.info, ""))
+	return c.pdf.finish(root, info)
+}
+
+func (c *converter) FontDef(fd dvitype.FontDef) {
+	pf := c.pdffonts[fd.Name]
+	if pf == nil {
+		e, ok := c.fontmap.Lookup(fd.Name)
+		if !ok {
+			c.fail(fd.Name, ErrFontNotMapped)
+			return
+		}
+		pf = &pdfFont{entry: e}
+		if rc, err := c.openFile(fd.Name + ".tfm"); err == nil {
+			pf.metrics, _ = tfm.Parse(rc)
+			rc.Close()
+		}
+		c.pdffonts[fd.Name] = pf
+	}
+	c.fonts[fd.Num] = &dviFont{pdf: pf, size: float64(fd.ScaledSize) * c.scale}
+}
+
+func (c *converter) BeginPage(counts [10]int32, pos int64) {
+	if c.next != nil {
+		c.width, c.height = c.next[0], c.next[1]
+		c.next = nil
+	}
+	c.content.Reset()
+	c.drawn = false
+	c.resources = make(map[*pdfFont]bool)
+	c.inText, c.curFont = false, nil
+	if len(c.colors) > 0 {
+		c.content.WriteString(c.colors[len(c.colors)-1])
+	}
+}
+
+// pos returns the position h, v on the page.
+func (c *converter) pos(h, v int) (float64, float64) {
+	return 72 + float64(h)*c.scale, c.height - 72 - float64(v)*c.scale
+}
+
+func (c *converter) endText() {
+	if c.inText {
+		c.content.WriteString("ET\n")
+		c.inText, c.curFont = false, nil
+	}
+}
+
+func (c *converter) SetChar(font, code, h, v int) {
+	f := c.fonts[font]
+	if f == nil || code < 0 || code > 255 {
+		return
+	}
+	c.drawn = true
+	pf := f.pdf
+	if pf.id == 0 {
+		pf.id = c.pdf.alloc()
+		c.nfonts++
+		pf.res = fmt.Sprintf("F%d", c.nfonts)
+	}
+	pf.used[code] = true
+	c.resources[pf] = true
+	if !c.inText {
+		c.content.WriteString("BT\n")
+		c.inText = true
+	}
+	if c.curFont != f {
+		fmt.Fprintf(&c.content, "/%s %s Tf\n", pf.res, num(f.size))
+		c.curFont = f
+	}
+	x, y := c.pos(h, v)
+	fmt.Fprintf(&c.content, "%s 0 %s 1 %s %s Tm <%02X> Tj\n", num(pf.entry.Extend), num(pf.entry.Slant), num(x), num(y), code)
+}
+
+func (c *converter) SetRule(h, v, height, width int) {
+	c.endText()
+	c.drawn = true
+	x, y := c.pos(h, v)
+	fmt.Fprintf(&c.content, "%s %s %s %s re f\n", num(x), num(y), num(float64(width)*c.scale), num(float64(height)*c.scale))
+}
+
+func (c *converter) Special(data []byte, h, v int) {
+	s := strings.TrimSpace(string(data))
+	switch {
+	case strings.HasPrefix(s, "papersize="):
+		c.papersize(s[len("papersize="):])
+	case s == "color pop":
+		c.popColor()
+	case strings.HasPrefix(s, "color push "):
+		c.pushColor(colorOperators(strings.Fields(s[len("color push "):])))
+	case strings.HasPrefix(s, "color "):
+		c.colors = c.colors[:0]
+		c.pushColor(colorOperators(strings.Fields(s[len("color "):])))
+	case strings.HasPrefix(s, "pdf:"):
+		c.pdfSpecial(strings.TrimSpace(s[len("pdf:"):]), h, v)
+	}
+}
+
+// papersize sets the paper size from "width,height". On a page that has
+// contents already, the size applies from the next page on.
+func (c *converter) papersize(s string) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return
+	}
+	w, ok1 := dimen(parts[0])
+	h, ok2 := dimen(parts[1])
+	if !ok1 || !ok2 || w <= 0 || h <= 0 {
+		return
+	}
+	if c.drawn {
+		c.next = &[2]float64{w, h}
+		return
+	}
+	c.width, c.height = w, h
+}
+
+// dimen converts a TeX dimension like 210mm or 8.5truein to bp.
+func dimen(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, false
+	}
+	unit := s[len(s)-2:]
+	x, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s[:len(s)-2]), "true"), 64)
+	if err != nil {
+		return 0, false
+	}
+	factors := map[string]float64{
+		"pt": 72 / 72.27, "bp": 1, "mm": 72 / 25.4, "cm": 72 / 2.54, "in": 72,
+		"pc": 12 * 72 / 72.27, "dd": 1238.0 / 1157 * 72 / 72.27, "cc": 12 * 1238.0 / 1157 * 72 / 72.27,
+		"sp": 72 / 72.27 / 65536,
+	}
+	f, ok := factors[unit]
+	return x * f, ok
+}
+
+// colorOperators returns the PDF operators that set the color in the
+// model and values of a color special.
+func colorOperators(spec []string) string {
+	if len(spec) == 0 {
+		return ""
+	}
+	vals := strings.Join(spec[1:], " ")
+	for _, v := range spec[1:] {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return ""
+		}
+	}
+	switch {
+	case spec[0] == "rgb" && len(spec) == 4:
+		return vals + " rg " + vals + " RG\n"
+	case spec[0] == "cmyk" && len(spec) == 5:
+		return vals + " k " + vals + " K\n"
+	case spec[0] == "gray" && len(spec) == 2:
+		return vals + " g " + vals + " G\n"
+	case spec[0] == "Black" && len(spec) == 1:
+		return "0 g 0 G\n"
+	}
+	return ""
+}
+
+func (c *converter) pushColor(ops string) {
+	if ops == "" {
+		ops = "0 g 0 G\n"
+	}
+	c.colors = append(c.colors, ops)
+	c.content.WriteString(ops)
+}
+
+func (c *converter) popColor() {
+	if len(c.colors) == 0 {
+		return
+	}
+	c.colors = c.colors[:len(c.colors)-1]
+	if len(c.colors) > 0 {
+		c.content.WriteString(c.colors[len(c.colors)-1])
+	} else {
+		c.content.WriteString("0 g 0 G\n")
+	}
+}
+
+// word splits s at the first white space.
+func word(s string) (string, string) {
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// pdfSpecial interprets the special pdf:s.
+func (c *converter) pdfSpecial(s string, h, v int) {
+	cmd, rest := word(s)
+	rest = strings.TrimSpace(rest)
+	x, y := c.pos(h, v)
+	switch cmd {
+	case "literal":
+		c.endText()
+		c.drawn = true
+		if arg, ops := word(rest); arg == "direct" {
+			fmt.Fprintf(&c.content, "%s\n", strings.TrimSpace(ops))
+		} else {
+			fmt.Fprintf(&c.content, "1 0 0 1 %s %s cm %s 1 0 0 1 %s %s cm\n", num(x), num(y), rest, num(-x), num(-y))
+		}
+	case "content":
+		c.endText()
+		c.drawn = true
+		fmt.Fprintf(&c.content, "q 1 0 0 1 %s %s cm %s Q\n", num(x), num(y), rest)
+	case "bcolor":
+		end := strings.IndexByte(rest, ']')
+		if !strings.HasPrefix(rest, "[") || end < 0 {
+			return
+		}
+		vals := strings.Fields(rest[1:end])
+		model := map[int]string{1: "gray", 3: "rgb", 4: "cmyk"}[len(vals)]
+		c.pushColor(colorOperators(append([]string{model}, vals...)))
+	case "ecolor":
+		c.popColor()
+	case "docinfo":
+		rest = strings.TrimSuffix(strings.TrimPrefix(rest, "<<"), ">>")
+		c.info = append(c.info, " "+strings.TrimSpace(rest))
+	}
+}
+
+func (c *converter) EndPage() {
+	c.endText()
+	var res []string
+	for f := range c.resources {
+		res = append(res, fmt.Sprintf("/%s %d 0 R", f.res, f.id))
+	}
+	sort.Strings(res)
+	page, contents := c.pdf.alloc(), c.pdf.alloc()
+	c.pdf.stream(contents, "", c.content.Bytes())
+	c.pdf.object(page, "<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s >> /ProcSet [/PDF /Text] >> /Contents %d 0 R >>",
+		c.pagesID, num(c.width), num(c.height), strings.Join(res, " "), contents)
+	c.pages = append(c.pages, page)
+}
@@ -0,0 +1,67 @@
+// Command dvipdf converts a DVI file to PDF.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/speedata/gotex/dvipdf"
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/internal/cmdline"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dvipdf [options] INFILE OUTFILE")
+		flag.PrintDefaults()
+	}
+	curdir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var pagespec = flag.String("page-start", "*", "start at PAGE-SPEC, for example `2' or `5.*.-2'")
+	var maxpages = flag.Int("max-pages", 0, "convert NUMBER pages; default all")
+	var basedir = flag.String("basedir", curdir, "Set the root directory with TFM, VF, map, Type 1 and encoding files")
+	var texmf = flag.String("texmf", "", "search the files like kpathsea in these TEXMF trees (a path list); default $TEXMF")
+	var mapfile = flag.String("map", "pdftex.map", "the font map file")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "dvipdf: Need exactly two file arguments.")
+		fmt.Fprintln(os.Stderr, "Try `dvipdf --help' for more information.")
+		os.Exit(1)
+	}
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	opts := dvipdf.Options{
+		PageSpec: *pagespec,
+		MaxPages: *maxpages,
+		Finder:   cmdline.Finder(*basedir, *texmf),
+		MapFile:  *mapfile,
+	}
+
+	var out bytes.Buffer
+	err = dvipdf.Convert(&out, in, opts)
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if werr := os.WriteFile(flag.Arg(1), out.Bytes(), 0644); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(4)
+	}
+}
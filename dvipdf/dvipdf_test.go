@@ -0,0 +1,153 @@
+package dvipdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/internal/testfont"
+	"github.com/speedata/gotex/simplefilefinder"
+	"github.com/speedata/gotex/type1"
+)
+
+// testFont is a Type 1 font with the glyphs A, B, ring and Aring, which
+// is built from A and ring with seac.
+var testFont = &testfont.Type1{
+	Encoding: map[int]string{65: "A", 66: "B", 67: "Aring"},
+	Glyphs: []testfont.Glyph{
+		{Name: ".notdef", Prog: "0 0 hsbw endchar"},
+		{Name: "A", Prog: "0 500 hsbw endchar"},
+		{Name: "B", Prog: "0 500 hsbw endchar"},
+		{Name: "ring", Prog: "0 500 hsbw endchar"},
+		{Name: "Aring", Prog: "0 500 hsbw 0 0 0 65 202 seac"},
+	},
+}
+
+func testDVI(t *testing.T) []byte {
+	return testfont.DVI(t, func(w *dviwriter.Writer) {
+		w.FontDef(dviwriter.FontDef{Num: 0, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "test"})
+		w.FontDef(dviwriter.FontDef{Num: 1, ScaledSize: 20 << 16, DesignSize: 10 << 16, Name: "testx"})
+		w.FontDef(dviwriter.FontDef{Num: 2, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "unknown"})
+		w.BeginPage([10]int{1})
+		w.Special([]byte("papersize=100bp,200bp"))
+		w.Down(10 << 16)
+		w.SetFont(0)
+		w.SetChar('A', 5<<16)
+		w.SetChar('C', 5<<16)
+		w.Special([]byte("color push rgb 1 0 0"))
+		w.SetRule(1<<16, 20<<16)
+		w.Special([]byte("color pop"))
+		w.Special([]byte("pdf:literal 0 0 m 10 0 l S"))
+		w.Special([]byte("pdf:docinfo << /Title (Test) >>"))
+		w.EndPage()
+		w.BeginPage([10]int{2})
+		w.Special([]byte("color push gray 0.5"))
+		w.SetFont(1)
+		w.SetChar(0, 10<<16)
+		w.SetChar(1, 10<<16)
+		w.SetFont(2)
+		w.SetChar('A', 0)
+		w.EndPage()
+	})
+}
+
+// streams returns the decompressed streams of a PDF file.
+func streams(t *testing.T, pdf []byte) []string {
+	var res []string
+	for _, part := range strings.Split(string(pdf), ">>\nstream\n")[1:] {
+		end := strings.Index(part, "\nendstream")
+		if end < 0 {
+			continue
+		}
+		zr, err := zlib.NewReader(strings.NewReader(part[:end]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, string(data))
+	}
+	return res
+}
+
+func TestConvert(t *testing.T) {
+	finder := simplefilefinder.Map{
+		"pdftex.map": []byte("% test fonts\ntest Test <test.pfb\ntestx Test \"0.8 ExtendFont\" <test.enc <<test.pfa\n"),
+		"test.tfm":   testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'C', Width: 1 << 19}),
+		"testx.tfm":  testfont.TFM(t, testfont.Chars{BC: 0, EC: 1, Width: 1 << 19}),
+		"test.pfb":   testFont.PFB(t),
+		"test.pfa":   testFont.PFA(t),
+		"test.enc":   []byte("% two glyphs\n/TestEncoding [ /B /A ] def\n"),
+	}
+	var out bytes.Buffer
+	err := Convert(&out, bytes.NewReader(testDVI(t)), Options{Finder: finder})
+	var fe *dvitype.FontError
+	if !errors.As(err, &fe) || fe.Name != "unknown" || !errors.Is(err, ErrFontNotMapped) {
+		t.Fatalf("want FontError for unknown, got %v", err)
+	}
+	pdf := out.String()
+	for _, exp := range []string{
+		"/Type /Pages /Kids [3 0 R 6 0 R] /Count 2",
+		"/MediaBox [0 0 100 200]",
+		"/Producer (gotex dvipdf) /Title (Test)",
+		"/FirstChar 65 /LastChar 67 /Widths [500 0 500]",
+		"/FirstChar 0 /LastChar 1 /Widths [625 625]",
+		"/Encoding << /Type /Encoding /Differences [0 /B /A] >>",
+		"/FontBBox [0 -200 800 700] /ItalicAngle -9.5",
+		"/BaseFont /Test ",
+	} {
+		if !strings.Contains(pdf, exp) {
+			t.Errorf("%q not found in the PDF file", exp)
+		}
+	}
+	if !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Errorf("the file does not end with %%%%EOF")
+	}
+
+	s := streams(t, out.Bytes())
+	if len(s) != 4 {
+		t.Fatalf("want 4 streams, got %d", len(s))
+	}
+	for i, exp := range []string{
+		"BT\n/F1 9.9626 Tf\n1 0 0 1 72 118.0374 Tm <41> Tj\n1 0 0 1 76.9813 118.0374 Tm <43> Tj\n1 0 0 rg 1 0 0 RG\nET\n",
+		"ET\n81.9626 118.0374 19.9253 0.9963 re f\n0 g 0 G\n",
+		"1 0 0 1 101.8879 118.0374 cm 0 0 m 10 0 l S 1 0 0 1 -101.8879 -118.0374 cm\n",
+	} {
+		if !strings.Contains(s[0], exp) {
+			t.Errorf("page 1, part %d: %q not found in\n%s", i+1, exp, s[0])
+		}
+	}
+	if exp := "0.5 g 0.5 G\nBT\n/F2 19.9253 Tf\n0.8 0 0 1 72 128 Tm <00> Tj\n"; !strings.HasPrefix(s[1], exp) {
+		t.Errorf("page 2: Should start with %q, but is\n%s", exp, s[1])
+	}
+
+	// the subset has the glyphs of A and Aring, the full font has B
+	for i, ff := range s[2:] {
+		j := strings.Index(ff, "eexec\n")
+		if j < 0 {
+			t.Fatalf("font %d: no eexec", i+1)
+		}
+		private := string(type1.Decrypt([]byte(ff[j+len("eexec\n"):]), type1.EexecKey))
+		if !strings.Contains(private, "/CharStrings 5 dict") && i == 1 || !strings.Contains(private, "/CharStrings 4 dict") && i == 0 {
+			t.Errorf("font %d: unexpected number of charstrings\n%q", i+1, private)
+		}
+		for _, g := range []string{"/.notdef ", "/A ", "/ring ", "/Aring "} {
+			if !strings.Contains(private, g) {
+				t.Errorf("font %d: %s missing", i+1, g)
+			}
+		}
+		if strings.Contains(private, "/B ") != (i == 1) {
+			t.Errorf("font %d: B should be in the full font only", i+1)
+		}
+	}
+	if !strings.Contains(pdf, "+Test /FirstChar 65") {
+		t.Error("the subset has no tag")
+	}
+}
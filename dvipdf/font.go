@@ -0,0 +1,175 @@
+package dvipdf
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/speedata/gotex/enc"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/type1"
+)
+
+// pdfFont is a font resource of the PDF file. All sizes of a TFM file
+// share the resource.
+type pdfFont struct {
+	id      int    // the object number of the font dictionary, 0 if not used yet
+	res     string // the resource name
+	entry   *fontmap.Entry
+	metrics *tfm.Font // nil if the TFM file could not be loaded
+	used    [256]bool
+}
+
+// subsetTag returns the six letters that are prepended to the name of a
+// subset font, derived from the name and the glyphs.
+func subsetTag(name string, glyphs map[string]bool) string {
+	var names []string
+	for g := range glyphs {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	h := fnv.New32a()
+	fmt.Fprint(h, name, names)
+	x := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = byte('A' + x%26)
+		x /= 26
+	}
+	return string(tag)
+}
+
+// writeFont writes the font dictionary of f and its descriptor, encoding
+// and font file. Problems with the files are recorded with fail, the font
+// is then referenced by name only.
+func (c *converter) writeFont(f *pdfFont) {
+	e := f.entry
+	first, last := -1, 0
+	for code, used := range f.used {
+		if used {
+			if first < 0 {
+				first = code
+			}
+			last = code
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	var vector *enc.Encoding
+	if e.Encoding != "" {
+		rc, err := c.openFile(e.Encoding)
+		if err == nil {
+			vector, err = enc.Parse(rc)
+			rc.Close()
+		}
+		if err != nil {
+			c.fail(e.Encoding, err)
+		}
+	}
+	var t1 *type1.Font
+	if e.FontFile != "" {
+		rc, err := c.openFile(e.FontFile)
+		if err == nil {
+			t1, err = type1.Parse(rc)
+			rc.Close()
+		}
+		if err != nil {
+			c.fail(e.FontFile, err)
+		}
+	}
+
+	// the glyph names of the used characters
+	var names []string
+	if vector != nil {
+		names = vector.Glyphs[:]
+	} else if t1 != nil {
+		names = t1.Encoding[:]
+	}
+	glyphs := make(map[string]bool)
+	for code := first; code <= last; code++ {
+		if !f.used[code] {
+			continue
+		}
+		if code >= len(names) || names[code] == "" {
+			glyphs = nil // unknown glyphs, the whole font is embedded
+			break
+		}
+		glyphs[names[code]] = true
+	}
+
+	psname := e.PSName
+	if psname == "" {
+		psname = e.TFMName
+	}
+	basefont := psname
+	var fontfile []byte
+	var length1 int
+	if t1 != nil {
+		embed := t1
+		if !e.Full && glyphs != nil {
+			if sub, err := t1.Subset(glyphs); err == nil {
+				embed = sub
+				basefont = subsetTag(psname, glyphs) + "+" + psname
+			} else {
+				c.fail(e.FontFile, err)
+			}
+		}
+		clear, private := embed.FontFile()
+		length1 = len(clear)
+		fontfile = append(append(fontfile, clear...), private...)
+	}
+
+	widths := make([]string, 0, last-first+1)
+	for code := first; code <= last; code++ {
+		w := 0.0
+		if f.used[code] && f.metrics != nil {
+			if ch, ok := f.metrics.Char(code); ok {
+				w = float64(ch.Width) / (1 << 20) * 1000 / e.Extend
+			}
+		}
+		widths = append(widths, num(math.Round(w)))
+	}
+
+	bbox := [4]float64{0, 0, 1000, 1000}
+	italic := 0.0
+	if t1 != nil {
+		bbox, italic = t1.FontBBox, t1.ItalicAngle
+	}
+	flags := e.Flags
+	if flags == 0 {
+		flags = 4 // symbolic
+	}
+	descriptor := c.pdf.alloc()
+	dict := fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox [%s %s %s %s] /ItalicAngle %s /Ascent %s /Descent %s /CapHeight %s /StemV 80",
+		basefont, flags, num(bbox[0]), num(bbox[1]), num(bbox[2]), num(bbox[3]), num(italic), num(bbox[3]), num(bbox[1]), num(bbox[3]))
+	if fontfile != nil {
+		ff := c.pdf.alloc()
+		c.pdf.stream(ff, fmt.Sprintf("/Length1 %d /Length2 %d /Length3 0", length1, len(fontfile)-length1), fontfile)
+		dict += fmt.Sprintf(" /FontFile %d 0 R", ff)
+	}
+	c.pdf.object(descriptor, "%s >>", dict)
+
+	encoding := ""
+	if vector != nil {
+		var diffs []string
+		prev := -2
+		for code := first; code <= last; code++ {
+			if !f.used[code] || vector.Glyphs[code] == "" {
+				continue
+			}
+			if code != prev+1 {
+				diffs = append(diffs, fmt.Sprint(code))
+			}
+			diffs = append(diffs, "/"+vector.Glyphs[code])
+			prev = code
+		}
+		encoding = fmt.Sprintf(" /Encoding << /Type /Encoding /Differences [%s] >>", strings.Join(diffs, " "))
+	}
+	c.pdf.object(f.id, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /FirstChar %d /LastChar %d /Widths [%s] /FontDescriptor %d 0 R%s >>",
+		basefont, first, last, strings.Join(widths, " "), descriptor, encoding)
+}
@@ -0,0 +1,94 @@
+package dvipdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// pdfWriter writes the objects of a PDF file and the cross-reference
+// table. Object numbers are handed out by alloc, the objects can be
+// written in any order. The first error is kept and returned by finish.
+type pdfWriter struct {
+	w       io.Writer
+	pos     int64
+	offsets []int64 // offsets[n-1] is the position of object n, 0 if not written yet
+	err     error
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	p := &pdfWriter{w: w}
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return p
+}
+
+func (p *pdfWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.pos += int64(n)
+	p.err = err
+}
+
+func (p *pdfWriter) printf(format string, a ...interface{}) {
+	p.write([]byte(fmt.Sprintf(format, a...)))
+}
+
+// alloc returns a new object number.
+func (p *pdfWriter) alloc() int {
+	p.offsets = append(p.offsets, 0)
+	return len(p.offsets)
+}
+
+// object writes the object id with the contents format.
+func (p *pdfWriter) object(id int, format string, a ...interface{}) {
+	p.offsets[id-1] = p.pos
+	p.printf("%d 0 obj\n", id)
+	p.printf(format, a...)
+	p.printf("\nendobj\n")
+}
+
+// stream writes the object id as a compressed stream. dict has the
+// entries of the stream dictionary besides Length and Filter.
+func (p *pdfWriter) stream(id int, dict string, data []byte) {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	if dict != "" {
+		dict = " " + dict
+	}
+	p.offsets[id-1] = p.pos
+	p.printf("%d 0 obj\n<< /Length %d /Filter /FlateDecode%s >>\nstream\n", id, b.Len(), dict)
+	p.write(b.Bytes())
+	p.printf("\nendstream\nendobj\n")
+}
+
+// finish writes the cross-reference table and the trailer.
+func (p *pdfWriter) finish(root, info int) error {
+	start := p.pos
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, off := range p.offsets {
+		if off == 0 {
+			p.printf("0000000000 65535 f \n")
+		} else {
+			p.printf("%010d 00000 n \n", off)
+		}
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R", len(p.offsets)+1, root)
+	if info > 0 {
+		p.printf(" /Info %d 0 R", info)
+	}
+	p.printf(" >>\nstartxref\n%d\n%%%%EOF\n", start)
+	return p.err
+}
+
+// num formats x for PDF with at most 4 decimal places.
+func num(x float64) string {
+	x = math.Round(x*10000) / 10000
+	return strconv.FormatFloat(x+0, 'f', -1, 64) // +0 turns -0 into 0
+}
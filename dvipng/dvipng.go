@@ -0,0 +1,176 @@
+// Package dvipng renders the pages of DVI files as bitmaps with PK fonts.
+//
+// The positions are rounded to pixels like DVItype does it, so the
+// characters of a word keep their distances in pixels and the words stay
+// close to their exact positions. Virtual fonts are replaced by the fonts
+// they are made of. Each image gets the size of the painted pixels; its
+// bounds are the pixel coordinates on the page, with the DVI origin at
+// 0,0.
+package dvipng
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"os"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/pk"
+)
+
+// Options controls what Render does.
+type Options struct {
+	PageSpec   string             // the first page, see dvitype.Dvitype.PageSpec; all pages if empty
+	MaxPages   int                // the number of pages, 0 means all
+	Resolution float32            // pixels per inch, 300 if 0
+	Finder     dvitype.FileFinder // opens the TFM, VF and PK files, if nil they are opened in the current directory
+}
+
+// Page is a rendered page.
+type Page struct {
+	Counts [10]int32 // \count0 to \count9
+	Image  *image.Gray
+}
+
+// item is a glyph or a rule on the page, g is nil for rules.
+type item struct {
+	r image.Rectangle
+	g *pk.Glyph
+}
+
+// renderer is the dvitype.Handler that paints the pages.
+type renderer struct {
+	dvitype.NopHandler
+	opts    Options
+	mag     int
+	fonts   map[int]*pk.Font
+	fonterr *dvitype.FontError
+	pages   []Page
+	counts  [10]int32
+	items   []item
+}
+
+// Render reads the DVI file from r and returns the images of its pages.
+// If a PK, TFM or VF file is missing or bad, Render returns the pages
+// together with a *dvitype.FontError.
+func Render(r io.ReadSeeker, opts Options) ([]Page, error) {
+	pre, err := dvitype.ReadPreamble(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rd := &renderer{opts: opts, mag: pre.Mag, fonts: make(map[int]*pk.Font)}
+	d := dvitype.New(r)
+	d.Output = io.Discard
+	if opts.PageSpec != "" {
+		d.PageSpec = opts.PageSpec
+	}
+	if opts.MaxPages > 0 {
+		d.MaxPages = opts.MaxPages
+	}
+	if opts.Resolution > 0 {
+		d.Resolution = opts.Resolution
+	}
+	rd.opts.Resolution = d.Resolution
+	d.Finder = opts.Finder
+	d.ExpandVirtual = true
+	d.Handler = rd
+	err = d.Run()
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		return nil, err
+	}
+	if err == nil && rd.fonterr != nil {
+		err = rd.fonterr
+	}
+	return rd.pages, err
+}
+
+func (r *renderer) openFile(name string) (io.ReadCloser, error) {
+	if r.opts.Finder == nil {
+		return os.Open(name)
+	}
+	return r.opts.Finder.OpenFile(name)
+}
+
+// FontDef loads the PK file of the font. The resolution of the font is
+// rounded to whole dpi, one dpi more or less is good enough.
+func (r *renderer) FontDef(fd dvitype.FontDef) {
+	if fd.DesignSize <= 0 {
+		return
+	}
+	dpi := int(math.Round(float64(r.opts.Resolution) * float64(r.mag) / 1000 * float64(fd.ScaledSize) / float64(fd.DesignSize)))
+	name := fmt.Sprintf("%s.%dpk", fd.Name, dpi)
+	rc, err := r.openFile(name)
+	for _, n := range []int{dpi - 1, dpi + 1} {
+		if err == nil {
+			break
+		}
+		rc, err = r.openFile(fmt.Sprintf("%s.%dpk", fd.Name, n))
+	}
+	if err == nil {
+		defer rc.Close()
+		if r.fonts[fd.Num], err = pk.Parse(rc); err == nil {
+			return
+		}
+	}
+	if r.fonterr == nil {
+		r.fonterr = &dvitype.FontError{Name: name, Err: err}
+	}
+}
+
+func (r *renderer) BeginPage(counts [10]int32, pos int64) {
+	r.counts = counts
+	r.items = r.items[:0]
+}
+
+func (r *renderer) SetCharPixels(font, code, hh, vv int) {
+	f := r.fonts[font]
+	if f == nil {
+		return
+	}
+	g, ok := f.Glyphs[code]
+	if !ok || g.Width == 0 || g.Height == 0 {
+		return
+	}
+	x, y := hh-g.HOff, vv-g.VOff
+	r.items = append(r.items, item{r: image.Rect(x, y, x+g.Width, y+g.Height), g: g})
+}
+
+// SetRulePixels paints the rule above the row vv, the row of the baseline
+// belongs to the rule.
+func (r *renderer) SetRulePixels(hh, vv, height, width int) {
+	r.items = append(r.items, item{r: image.Rect(hh, vv-height+1, hh+width, vv+1)})
+}
+
+func (r *renderer) EndPage() {
+	var bounds image.Rectangle
+	for _, it := range r.items {
+		bounds = bounds.Union(it.r)
+	}
+	if bounds.Empty() {
+		bounds = image.Rect(0, 0, 1, 1)
+	}
+	img := image.NewGray(bounds)
+	draw.Draw(img, bounds, image.White, image.Point{}, draw.Src)
+	for _, it := range r.items {
+		if it.g == nil {
+			draw.Draw(img, it.r, image.Black, image.Point{}, draw.Src)
+			continue
+		}
+		for y := 0; y < it.g.Height; y++ {
+			for x := 0; x < it.g.Width; x++ {
+				if it.g.Black(x, y) {
+					img.SetGray(it.r.Min.X+x, it.r.Min.Y+y, color.Gray{})
+				}
+			}
+		}
+	}
+	r.pages = append(r.pages, Page{Counts: r.counts, Image: img})
+}
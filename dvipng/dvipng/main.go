@@ -0,0 +1,83 @@
+// Command dvipng converts the pages of a DVI file to PNG images with PK
+// fonts.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/speedata/gotex/dvipng"
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/internal/cmdline"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dvipng [options] DVIFILE")
+		flag.PrintDefaults()
+	}
+	curdir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var pagespec = flag.String("page-start", "*", "start at PAGE-SPEC, for example `2' or `5.*.-2'")
+	var maxpages = flag.Int("max-pages", 0, "convert NUMBER pages; default all")
+	var basedir = flag.String("basedir", curdir, "Set the root directory with TFM, VF and PK files")
+	var texmf = flag.String("texmf", "", "search TFM, VF and PK files like kpathsea in these TEXMF trees (a path list); default $TEXMF")
+	var resolution = flag.Float64("dpi", 300, "set resolution to REAL pixels per inch; default 300")
+	var output = flag.String("output", "", "name of the PNG files, %d is replaced by 1, 2, ... for the pages written; default NAME-%d.png")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "dvipng: Need exactly one file argument.")
+		fmt.Fprintln(os.Stderr, "Try `dvipng --help' for more information.")
+		os.Exit(1)
+	}
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	opts := dvipng.Options{
+		PageSpec:   *pagespec,
+		MaxPages:   *maxpages,
+		Resolution: float32(*resolution),
+		Finder:     cmdline.Finder(*basedir, *texmf),
+	}
+	pattern := *output
+	if pattern == "" {
+		pattern = strings.TrimSuffix(filepath.Base(flag.Arg(0)), filepath.Ext(flag.Arg(0))) + "-%d.png"
+	}
+
+	pages, err := dvipng.Render(in, opts)
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for i, pg := range pages {
+		name := strings.ReplaceAll(pattern, "%d", fmt.Sprint(i+1))
+		var b bytes.Buffer
+		if werr := png.Encode(&b, pg.Image); werr != nil {
+			fmt.Fprintln(os.Stderr, werr)
+			os.Exit(1)
+		}
+		if werr := os.WriteFile(name, b.Bytes(), 0644); werr != nil {
+			fmt.Fprintln(os.Stderr, werr)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(4)
+	}
+}
@@ -0,0 +1,97 @@
+package dvipng
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/internal/testfont"
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+// testPK returns a PK file where A is a black box of 2x3 pixels on the
+// baseline.
+func testPK() []byte {
+	b := []byte{247, 89, 0}
+	b = append(b, 0, 0xa0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0)
+	b = append(b, 0xe0, 10, 'A', 0x08, 0, 0, 5, 2, 3, 0, 2, 0xfc)
+	return append(b, 245, 245, 245, 245)
+}
+
+func testDVI(t *testing.T) []byte {
+	return testfont.DVI(t, func(w *dviwriter.Writer) {
+		w.FontDef(dviwriter.FontDef{Num: 0, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "test"})
+		w.BeginPage([10]int{1})
+		w.Down(10 << 16)
+		w.SetFont(0)
+		w.SetChar('A', 5<<16)
+		w.SetChar('A', 5<<16)
+		w.Down(2 << 16)
+		w.PutRule(1<<16, 10<<16)
+		w.EndPage()
+		w.BeginPage([10]int{2})
+		w.EndPage()
+	})
+}
+
+// picture returns the image as rows of # and . for black and white.
+func picture(img *image.Gray) string {
+	var rows []string
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var row strings.Builder
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.GrayAt(x, y).Y == 0 {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows = append(rows, row.String())
+	}
+	return strings.Join(rows, "\n")
+}
+
+func TestRender(t *testing.T) {
+	finder := simplefilefinder.Map{"test.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'A', Width: 1 << 19}), "test.72pk": testPK()}
+	// one pixel per point
+	pages, err := Render(bytes.NewReader(testDVI(t)), Options{Finder: finder, Resolution: 72.27})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[1].Counts[0] != 2 {
+		t.Fatalf("unexpected pages %+v", pages)
+	}
+	img := pages[0].Image
+	if res, exp := img.Bounds(), image.Rect(0, 8, 20, 13); res != exp {
+		t.Errorf("bounds: want %v, got %v", exp, res)
+	}
+	exp := strings.Join([]string{
+		"##...##.............",
+		"##...##.............",
+		"##...##.............",
+		"....................",
+		"..........##########",
+	}, "\n")
+	if res := picture(img); res != exp {
+		t.Errorf("Should be\n%s\nbut is\n%s", exp, res)
+	}
+	if b := pages[1].Image.Bounds(); b.Dx() != 1 || b.Dy() != 1 {
+		t.Errorf("empty page: unexpected bounds %v", b)
+	}
+
+	// the PK file for 300 dpi is missing
+	delete(finder, "test.72pk")
+	pages, err = Render(bytes.NewReader(testDVI(t)), Options{Finder: finder, MaxPages: 1})
+	var fe *dvitype.FontError
+	if !errors.As(err, &fe) || fe.Name != "test.300pk" {
+		t.Errorf("want FontError for test.300pk, got %v", err)
+	}
+	if len(pages) != 1 {
+		t.Errorf("unexpected pages %+v", pages)
+	}
+}
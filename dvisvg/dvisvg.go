@@ -0,0 +1,263 @@
+// Package dvisvg renders the pages of DVI files as SVG images.
+//
+// Characters are written as text elements with the name of the TFM file
+// as font family, so the fonts have to be available to the program that
+// shows the image. If a GlyphSource knows the outline of a character, the
+// character is drawn as a path instead. Virtual fonts are replaced by the
+// fonts they are made of. Each page gets the size of its contents, the
+// bounding box is computed from the TFM metrics and the rules.
+package dvisvg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/tfm"
+)
+
+// GlyphSource provides the outlines of characters, for example from
+// Type 1 fonts.
+type GlyphSource interface {
+	// Outline returns the outline of the character code of the font as
+	// SVG path data. The unit is 1/1000 of the font size, y grows upwards
+	// and the origin is the reference point of the character.
+	Outline(font dvitype.FontDef, code int) (string, bool)
+}
+
+// Options controls what Render does.
+type Options struct {
+	PageSpec string             // the first page, see dvitype.Dvitype.PageSpec; all pages if empty
+	MaxPages int                // the number of pages, 0 means all
+	Finder   dvitype.FileFinder // opens the TFM and VF files, if nil they are opened in the current directory
+	Glyphs   GlyphSource        // optional
+}
+
+// Page is a rendered page.
+type Page struct {
+	Counts [10]int32 // \count0 to \count9
+	SVG    []byte
+}
+
+type font struct {
+	def     dvitype.FontDef
+	id      int       // number for the ids of the glyphs
+	metrics *tfm.Font // nil if the TFM file could not be loaded
+}
+
+// textRun is a sequence of characters of one font on a baseline.
+type textRun struct {
+	font *font
+	v    int
+	h    []int
+	text []rune
+}
+
+// renderer is the dvitype.Handler that draws the pages.
+type renderer struct {
+	dvitype.NopHandler
+	opts    Options
+	scale   float64 // bp (the pt of SVG) per DVI unit
+	fonts   map[int]*font
+	pages   []Page
+	counts  [10]int32
+	body    bytes.Buffer
+	defs    bytes.Buffer
+	defined map[string]bool // glyphs in defs
+	run     textRun
+
+	empty                  bool // nothing on the page yet
+	minh, minv, maxh, maxv int  // bounding box
+}
+
+// Render reads the DVI file from r and returns the SVG images of its
+// pages. If a TFM or VF file is bad, Render returns the pages together
+// with a *dvitype.FontError.
+func Render(r io.ReadSeeker, opts Options) ([]Page, error) {
+	pre, err := dvitype.ReadPreamble(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rd := &renderer{
+		opts:  opts,
+		scale: float64(pre.Num) / float64(pre.Den) * 72 / 254000 * float64(pre.Mag) / 1000,
+		fonts: make(map[int]*font),
+	}
+	d := dvitype.New(r)
+	d.Output = io.Discard
+	if opts.PageSpec != "" {
+		d.PageSpec = opts.PageSpec
+	}
+	if opts.MaxPages > 0 {
+		d.MaxPages = opts.MaxPages
+	}
+	d.Finder = opts.Finder
+	d.ExpandVirtual = true
+	d.Handler = rd
+	err = d.Run()
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		return nil, err
+	}
+	return rd.pages, err
+}
+
+func (r *renderer) openFile(name string) (io.ReadCloser, error) {
+	if r.opts.Finder == nil {
+		return os.Open(name)
+	}
+	return r.opts.Finder.OpenFile(name)
+}
+
+// pt formats the DVI dimension a in the pt of SVG, which is a big point.
+func (r *renderer) pt(a int) string {
+	return number(float64(a)*r.scale, 3)
+}
+
+// attr escapes s for an attribute value.
+func attr(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// number formats x with at most prec decimal places.
+func number(x float64, prec int) string {
+	p := math.Pow10(prec)
+	x = math.Round(x*p) / p
+	return strconv.FormatFloat(x+0, 'f', -1, 64) // +0 turns -0 into 0
+}
+
+// box extends the bounding box by the rectangle from h, v to h+width,
+// v-height.
+func (r *renderer) box(h, v, height, width int) {
+	h1, v1 := h+width, v-height
+	if h1 < h {
+		h, h1 = h1, h
+	}
+	if v1 > v {
+		v, v1 = v1, v
+	}
+	if r.empty {
+		r.minh, r.minv, r.maxh, r.maxv = h, v1, h1, v
+		r.empty = false
+		return
+	}
+	if h < r.minh {
+		r.minh = h
+	}
+	if h1 > r.maxh {
+		r.maxh = h1
+	}
+	if v1 < r.minv {
+		r.minv = v1
+	}
+	if v > r.maxv {
+		r.maxv = v
+	}
+}
+
+func (r *renderer) FontDef(fd dvitype.FontDef) {
+	f := &font{def: fd, id: len(r.fonts)}
+	if rc, err := r.openFile(fd.Name + ".tfm"); err == nil {
+		f.metrics, _ = tfm.Parse(rc)
+		rc.Close()
+	}
+	r.fonts[fd.Num] = f
+}
+
+func (r *renderer) BeginPage(counts [10]int32, pos int64) {
+	r.counts = counts
+	r.body.Reset()
+	r.defs.Reset()
+	r.defined = make(map[string]bool)
+	r.empty = true
+	r.minh, r.minv, r.maxh, r.maxv = 0, 0, 0, 0
+}
+
+func (r *renderer) SetChar(font, code, h, v int) {
+	f := r.fonts[font]
+	if f == nil {
+		return
+	}
+	if f.metrics != nil {
+		if ch, ok := f.metrics.Char(code); ok {
+			z := f.def.ScaledSize
+			r.box(h, v+tfm.Scale(ch.Depth, z), tfm.Scale(ch.Height, z)+tfm.Scale(ch.Depth, z), tfm.Scale(ch.Width, z))
+		}
+	} else {
+		r.box(h, v, 0, 0)
+	}
+	if r.opts.Glyphs != nil {
+		if path, ok := r.opts.Glyphs.Outline(f.def, code); ok {
+			r.flush()
+			id := fmt.Sprintf("g%d-%d", f.id, code)
+			if !r.defined[id] {
+				r.defined[id] = true
+				k := number(float64(f.def.ScaledSize)*r.scale/1000, 6)
+				fmt.Fprintf(&r.defs, "<path id=\"%s\" transform=\"scale(%s,-%s)\" d=\"%s\"/>\n", id, k, k, path)
+			}
+			fmt.Fprintf(&r.body, "<use xlink:href=\"#%s\" x=\"%s\" y=\"%s\"/>\n", id, r.pt(h), r.pt(v))
+			return
+		}
+	}
+	if r.run.font != f || r.run.v != v {
+		r.flush()
+		r.run.font, r.run.v = f, v
+	}
+	r.run.h = append(r.run.h, h)
+	// control characters are not allowed in XML, they go to the private use area
+	c := rune(code)
+	if code < 32 {
+		c += 0xe000
+	}
+	r.run.text = append(r.run.text, c)
+}
+
+// flush writes the current text run.
+func (r *renderer) flush() {
+	if len(r.run.text) == 0 {
+		return
+	}
+	xs := make([]string, len(r.run.h))
+	for i, h := range r.run.h {
+		xs[i] = r.pt(h)
+	}
+	f := r.run.font
+	fmt.Fprintf(&r.body, "<text x=\"%s\" y=\"%s\" font-family=\"%s\" font-size=\"%s\" xml:space=\"preserve\">", strings.Join(xs, " "), r.pt(r.run.v), attr(f.def.Name), r.pt(f.def.ScaledSize))
+	xml.EscapeText(&r.body, []byte(string(r.run.text)))
+	r.body.WriteString("</text>\n")
+	r.run.font, r.run.h, r.run.text = nil, r.run.h[:0], r.run.text[:0]
+}
+
+func (r *renderer) SetRule(h, v, height, width int) {
+	r.flush()
+	r.box(h, v, height, width)
+	fmt.Fprintf(&r.body, "<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\"/>\n", r.pt(h), r.pt(v-height), r.pt(width), r.pt(height))
+}
+
+func (r *renderer) EndPage() {
+	r.flush()
+	var b bytes.Buffer
+	w, h := r.pt(r.maxh-r.minh), r.pt(r.maxv-r.minv)
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" version=\"1.1\" width=\"%spt\" height=\"%spt\" viewBox=\"%s %s %s %s\">\n", w, h, r.pt(r.minh), r.pt(r.minv), w, h)
+	if r.defs.Len() > 0 {
+		b.WriteString("<defs>\n")
+		b.Write(r.defs.Bytes())
+		b.WriteString("</defs>\n")
+	}
+	b.Write(r.body.Bytes())
+	b.WriteString("</svg>\n")
+	r.pages = append(r.pages, Page{Counts: r.counts, SVG: b.Bytes()})
+}
@@ -0,0 +1,83 @@
+// Command dvisvg converts the pages of a DVI file to SVG images.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/speedata/gotex/dvisvg"
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/internal/cmdline"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dvisvg [options] DVIFILE")
+		flag.PrintDefaults()
+	}
+	curdir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var pagespec = flag.String("page-start", "*", "start at PAGE-SPEC, for example `2' or `5.*.-2'")
+	var maxpages = flag.Int("max-pages", 0, "convert NUMBER pages; default all")
+	var basedir = flag.String("basedir", curdir, "Set the root directory with TFM and VF files")
+	var texmf = flag.String("texmf", "", "search TFM and VF files like kpathsea in these TEXMF trees (a path list); default $TEXMF")
+	var mapfile = flag.String("map", "", "draw the characters with the Type 1 fonts of this font map, for example pdftex.map")
+	var output = flag.String("output", "", "name of the SVG files, %d is replaced by 1, 2, ... for the pages written; default NAME-%d.svg")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "dvisvg: Need exactly one file argument.")
+		fmt.Fprintln(os.Stderr, "Try `dvisvg --help' for more information.")
+		os.Exit(1)
+	}
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	opts := dvisvg.Options{
+		PageSpec: *pagespec,
+		MaxPages: *maxpages,
+		Finder:   cmdline.Finder(*basedir, *texmf),
+	}
+	if *mapfile != "" {
+		m := fontmap.New()
+		if err = m.ReadFile(opts.Finder, *mapfile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.Glyphs = &dvisvg.Type1Glyphs{Map: m, Finder: opts.Finder}
+	}
+	pattern := *output
+	if pattern == "" {
+		pattern = strings.TrimSuffix(filepath.Base(flag.Arg(0)), filepath.Ext(flag.Arg(0))) + "-%d.svg"
+	}
+
+	pages, err := dvisvg.Render(in, opts)
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for i, pg := range pages {
+		name := strings.ReplaceAll(pattern, "%d", fmt.Sprint(i+1))
+		if werr := os.WriteFile(name, pg.SVG, 0644); werr != nil {
+			fmt.Fprintln(os.Stderr, werr)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(4)
+	}
+}
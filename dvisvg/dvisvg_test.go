@@ -0,0 +1,154 @@
+package dvisvg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/internal/testfont"
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+func testDVI(t *testing.T) []byte {
+	return testfont.DVI(t, func(w *dviwriter.Writer) {
+		w.FontDef(dviwriter.FontDef{Num: 3, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "test"})
+		w.BeginPage([10]int{1})
+		w.Down(10 << 16)
+		w.SetFont(3)
+		w.SetChar('A', 5<<16)
+		w.SetChar('B', 5<<16)
+		w.SetChar('<', 0)
+		w.Down(5 << 16)
+		w.SetRule(1<<16, 20<<16)
+		w.EndPage()
+		w.BeginPage([10]int{2})
+		w.SetFont(3)
+		w.PutChar('B')
+		w.EndPage()
+		w.BeginPage([10]int{3})
+		w.EndPage()
+	})
+}
+
+// wellFormed reports an error if data is not well-formed XML.
+func wellFormed(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+type outlines map[int]string
+
+func (o outlines) Outline(font dvitype.FontDef, code int) (string, bool) {
+	p, ok := o[code]
+	return p, ok
+}
+
+func TestRender(t *testing.T) {
+	// A and B are 5pt wide, 7pt high and 2pt deep
+	finder := simplefilefinder.Map{"test.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'B', Width: 1 << 19, Height: 7 << 20 / 10, Depth: 2 << 20 / 10})}
+	pages, err := Render(bytes.NewReader(testDVI(t)), Options{Finder: finder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 || pages[1].Counts[0] != 2 {
+		t.Fatalf("unexpected pages %+v", pages)
+	}
+	if exp := `width="0pt" height="0pt" viewBox="0 0 0 0"`; !strings.Contains(string(pages[2].SVG), exp) {
+		t.Errorf("empty page: %q not found in\n%s", exp, pages[2].SVG)
+	}
+	// the pt of SVG is a big point, 72.27/72 TeX points
+	svg := string(pages[0].SVG)
+	for _, exp := range []string{
+		`width="29.888pt" height="11.955pt" viewBox="0 2.989 29.888 11.955"`,
+		`<text x="0 4.981 9.963" y="9.963" font-family="test" font-size="9.963" xml:space="preserve">AB&lt;</text>`,
+		`<rect x="9.963" y="13.948" width="19.925" height="0.996"/>`,
+	} {
+		if !strings.Contains(svg, exp) {
+			t.Errorf("%q not found in\n%s", exp, svg)
+		}
+	}
+	if err = wellFormed(pages[0].SVG); err != nil {
+		t.Error(err)
+	}
+
+	pages, err = Render(bytes.NewReader(testDVI(t)), Options{Finder: finder, PageSpec: "2", MaxPages: 1, Glyphs: outlines{'B': "M0 0L500 0L500 700Z"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("want 1 page, got %d", len(pages))
+	}
+	svg = string(pages[0].SVG)
+	for _, exp := range []string{
+		`<path id="g0-66" transform="scale(0.009963,-0.009963)" d="M0 0L500 0L500 700Z"/>`,
+		`<use xlink:href="#g0-66" x="0" y="0"/>`,
+		`viewBox="0 -6.974 4.981 8.966"`,
+	} {
+		if !strings.Contains(svg, exp) {
+			t.Errorf("%q not found in\n%s", exp, svg)
+		}
+	}
+	if err = wellFormed(pages[0].SVG); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFontFamily(t *testing.T) {
+	dvi := testfont.DVI(t, func(w *dviwriter.Writer) {
+		w.FontDef(dviwriter.FontDef{Num: 0, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: `a&b"<c`})
+		w.BeginPage([10]int{1})
+		w.SetFont(0)
+		w.SetChar('A', 5<<16)
+		w.EndPage()
+	})
+	pages, err := Render(bytes.NewReader(dvi), Options{Finder: simplefilefinder.Map{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `font-family="a&amp;b&#34;&lt;c"`; !strings.Contains(string(pages[0].SVG), exp) {
+		t.Errorf("%q not found in\n%s", exp, pages[0].SVG)
+	}
+	if err = wellFormed(pages[0].SVG); err != nil {
+		t.Error(err)
+	}
+}
+
+// testFont is a Type 1 font with the glyph A, a triangle.
+var testFont = &testfont.Type1{
+	Encoding: map[int]string{65: "A"},
+	Glyphs:   []testfont.Glyph{{Name: "A", Prog: "0 500 hsbw 0 0 rmoveto 100 0 rlineto 0 700 rlineto closepath endchar"}},
+}
+
+func TestType1Glyphs(t *testing.T) {
+	m, err := fontmap.Parse(strings.NewReader("test Test \"0.5 ExtendFont .2 SlantFont\" <test.pfa\nencoded Test <test.enc <test.pfa\n" +
+		"badenc Test <missing.enc <test.pfa\nmissing Missing <missing.pfa\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &Type1Glyphs{Map: m, Finder: simplefilefinder.Map{"test.pfa": testFont.PFA(t), "test.enc": []byte("/Test [ /B /A ] def\n")}}
+	if path, ok := g.Outline(dvitype.FontDef{Name: "test"}, 'A'); !ok || path != "M0 0L50 0L190 700Z" {
+		t.Errorf("unexpected outline %q", path)
+	}
+	if path, ok := g.Outline(dvitype.FontDef{Name: "encoded"}, 1); !ok || path != "M0 0L100 0L100 700Z" {
+		t.Errorf("unexpected outline %q with the encoding file", path)
+	}
+	for _, tc := range []struct {
+		font string
+		code int
+	}{{"test", 'B'}, {"test", 300}, {"encoded", 0}, {"encoded", 'A'}, {"badenc", 'A'}, {"missing", 'A'}, {"unknown", 'A'}} {
+		if path, ok := g.Outline(dvitype.FontDef{Name: tc.font}, tc.code); ok {
+			t.Errorf("%s %d: unexpected outline %q", tc.font, tc.code, path)
+		}
+	}
+}
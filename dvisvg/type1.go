@@ -0,0 +1,121 @@
+package dvisvg
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/enc"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/type1"
+)
+
+// Type1Glyphs is a GlyphSource with the Type 1 fonts of a font map. The
+// characters are looked up in the encoding file of the map line or else
+// in the built-in encoding of the font. SlantFont and ExtendFont are
+// applied. A Type1Glyphs must not be used concurrently.
+type Type1Glyphs struct {
+	Map    *fontmap.Map
+	Finder dvitype.FileFinder // opens the font and encoding files, if nil they are opened in the current directory
+	fonts  map[string]*outlineFont
+}
+
+// outlineFont is a font of Type1Glyphs.
+type outlineFont struct {
+	font   *type1.Font
+	entry  *fontmap.Entry
+	glyphs [256]string // the glyph names by code
+	paths  map[int]string
+}
+
+func (g *Type1Glyphs) openFile(name string) (io.ReadCloser, error) {
+	if g.Finder == nil {
+		return os.Open(name)
+	}
+	return g.Finder.OpenFile(name)
+}
+
+func (g *Type1Glyphs) load(tfmname string) *outlineFont {
+	e, ok := g.Map.Lookup(tfmname)
+	if !ok || e.FontFile == "" {
+		return nil
+	}
+	rc, err := g.openFile(e.FontFile)
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	f, err := type1.Parse(rc)
+	if err != nil {
+		return nil
+	}
+	of := &outlineFont{font: f, entry: e, glyphs: f.Encoding, paths: make(map[int]string)}
+	if e.Encoding != "" {
+		rc, err := g.openFile(e.Encoding)
+		if err != nil {
+			return nil
+		}
+		defer rc.Close()
+		vector, err := enc.Parse(rc)
+		if err != nil {
+			return nil
+		}
+		of.glyphs = vector.Glyphs
+	}
+	return of
+}
+
+// Outline returns the outline of the character code of the font.
+func (g *Type1Glyphs) Outline(font dvitype.FontDef, code int) (string, bool) {
+	if g.fonts == nil {
+		g.fonts = make(map[string]*outlineFont)
+	}
+	f, ok := g.fonts[font.Name]
+	if !ok {
+		f = g.load(font.Name)
+		g.fonts[font.Name] = f
+	}
+	if f == nil || code < 0 || code > 255 {
+		return "", false
+	}
+	if path, ok := f.paths[code]; ok {
+		return path, path != ""
+	}
+	path := ""
+	if name := f.glyphs[code]; name != "" {
+		if glyph, err := f.font.Glyph(name); err == nil {
+			path = f.svgPath(glyph)
+		}
+	}
+	f.paths[code] = path
+	return path, path != ""
+}
+
+// svgPath returns the path data of the glyph in 1/1000 of the font size.
+func (f *outlineFont) svgPath(glyph *type1.Glyph) string {
+	m := f.font.FontMatrix
+	xy := func(p type1.Point) string {
+		x := (m[0]*p.X + m[2]*p.Y + m[4]) * 1000
+		y := (m[1]*p.X + m[3]*p.Y + m[5]) * 1000
+		return number(f.entry.Extend*x+f.entry.Slant*y, 2) + " " + number(y, 2)
+	}
+	var b strings.Builder
+	for _, s := range glyph.Path {
+		switch s.Op {
+		case type1.MoveTo:
+			b.WriteString("M" + xy(s.Pts[0]))
+		case type1.LineTo:
+			b.WriteString("L" + xy(s.Pts[0]))
+		case type1.CurveTo:
+			b.WriteString("C" + xy(s.Pts[0]) + " " + xy(s.Pts[1]) + " " + xy(s.Pts[2]))
+		case type1.ClosePath:
+			b.WriteString("Z")
+		}
+	}
+	if b.Len() == 0 {
+		// an empty glyph such as a space
+		return "M0 0"
+	}
+	return b.String()
+}
@@ -0,0 +1,218 @@
+// Package dvitext extracts the plain text of DVI files, like dvi2tty.
+//
+// The characters are taken in the order of the DVI file, which is the
+// reading order for most TeX output. A horizontal gap of at least the
+// font space of DVItype (a sixth of the font size) or a move to the left
+// by four times that becomes a word space. A baseline that differs from
+// the one of the line by more than half the font size starts a new line,
+// so superscripts and subscripts stay in their line; an empty line is
+// inserted where the distance is more than one and a half times the one
+// between the previous lines.
+//
+// The character codes are mapped to Unicode with the glyph names of the
+// encoding file of the font map line or else of the built-in encoding of
+// the Type 1 font, see enc.ToUnicode. The ligatures ff, fi, fl, ffi and
+// ffl become their letters. Codes without a glyph name are taken as ASCII
+// from 32 to 126 and dropped otherwise. Virtual fonts are replaced by the
+// fonts they are made of.
+package dvitext
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/enc"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/type1"
+)
+
+// Options controls what Extract does.
+type Options struct {
+	PageSpec string             // the first page, see dvitype.Dvitype.PageSpec; all pages if empty
+	MaxPages int                // the number of pages, 0 means all
+	Finder   dvitype.FileFinder // opens the TFM, VF, encoding and font files, if nil they are opened in the current directory
+	Map      *fontmap.Map       // the encodings of the fonts, optional
+}
+
+// Page is the text of a page. Each line ends with a newline.
+type Page struct {
+	Counts [10]int32 // \count0 to \count9
+	Text   string
+}
+
+type font struct {
+	def     dvitype.FontDef
+	metrics *tfm.Font    // nil if the TFM file could not be loaded
+	space   int          // the font space of DVItype
+	glyphs  *[256]string // the glyph names, nil if not known
+}
+
+// extractor is the dvitype.Handler that collects the text.
+type extractor struct {
+	dvitype.NopHandler
+	opts   Options
+	fonts  map[int]*font
+	glyphs map[string]*[256]string // by TFM name
+	pages  []Page
+	counts [10]int32
+	text   strings.Builder
+
+	started  bool // a character is on the page
+	linev    int  // the baseline of the line
+	linedist int  // the distance between the last lines
+	end      int  // h after the last character
+	space    int  // the font space of the last character
+}
+
+// Extract reads the DVI file from r and returns the text of its pages. If
+// a TFM or VF file is bad, Extract returns the pages together with a
+// *dvitype.FontError.
+func Extract(r io.ReadSeeker, opts Options) ([]Page, error) {
+	e := &extractor{
+		opts:   opts,
+		fonts:  make(map[int]*font),
+		glyphs: make(map[string]*[256]string),
+	}
+	d := dvitype.New(r)
+	d.Output = io.Discard
+	if opts.PageSpec != "" {
+		d.PageSpec = opts.PageSpec
+	}
+	if opts.MaxPages > 0 {
+		d.MaxPages = opts.MaxPages
+	}
+	d.Finder = opts.Finder
+	d.ExpandVirtual = true
+	d.Handler = e
+	err := d.Run()
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		return nil, err
+	}
+	return e.pages, err
+}
+
+func (e *extractor) openFile(name string) (io.ReadCloser, error) {
+	if e.opts.Finder == nil {
+		return os.Open(name)
+	}
+	return e.opts.Finder.OpenFile(name)
+}
+
+// loadGlyphs returns the glyph names of the TFM file name from the font
+// map, nil if they are not known.
+func (e *extractor) loadGlyphs(name string) *[256]string {
+	if g, ok := e.glyphs[name]; ok {
+		return g
+	}
+	var glyphs *[256]string
+	if entry, ok := e.opts.Map.Lookup(name); ok {
+		if entry.Encoding != "" {
+			if rc, err := e.openFile(entry.Encoding); err == nil {
+				if vector, err := enc.Parse(rc); err == nil {
+					glyphs = &vector.Glyphs
+				}
+				rc.Close()
+			}
+		} else if entry.FontFile != "" {
+			if rc, err := e.openFile(entry.FontFile); err == nil {
+				if f, err := type1.Parse(rc); err == nil {
+					glyphs = &f.Encoding
+				}
+				rc.Close()
+			}
+		}
+	}
+	e.glyphs[name] = glyphs
+	return glyphs
+}
+
+func (e *extractor) FontDef(fd dvitype.FontDef) {
+	f := &font{def: fd, space: fd.ScaledSize / 6}
+	if rc, err := e.openFile(fd.Name + ".tfm"); err == nil {
+		f.metrics, _ = tfm.Parse(rc)
+		rc.Close()
+	}
+	if e.opts.Map != nil {
+		f.glyphs = e.loadGlyphs(fd.Name)
+	}
+	e.fonts[fd.Num] = f
+}
+
+func (e *extractor) BeginPage(counts [10]int32, pos int64) {
+	e.counts = counts
+	e.text.Reset()
+	e.started = false
+	e.linedist = 0
+}
+
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "\u200c", "")
+
+// unicode returns the text of the character code of f.
+func unicode(f *font, code int) string {
+	if f.glyphs != nil && code >= 0 && code < 256 && f.glyphs[code] != "" {
+		s, _ := enc.ToUnicode(f.glyphs[code])
+		return ligatures.Replace(s)
+	}
+	if code >= 32 && code < 127 {
+		return string(rune(code))
+	}
+	return ""
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (e *extractor) SetChar(font, code, h, v int) {
+	f := e.fonts[font]
+	if f == nil {
+		return
+	}
+	end := h
+	if f.metrics != nil {
+		if ch, ok := f.metrics.Char(code); ok {
+			end += tfm.Scale(ch.Width, f.def.ScaledSize)
+		}
+	}
+	s := unicode(f, code)
+	if s == "" {
+		if e.started {
+			e.end = end
+		}
+		return
+	}
+	switch dv := v - e.linev; {
+	case !e.started:
+		e.started = true
+		e.linev = v
+	case abs(dv) > f.def.ScaledSize/2:
+		e.text.WriteByte('\n')
+		if dv > 0 {
+			if e.linedist > 0 && dv > e.linedist*3/2 {
+				e.text.WriteByte('\n')
+			} else {
+				e.linedist = dv
+			}
+		}
+		e.linev = v
+	case h-e.end >= e.space || h-e.end <= -4*e.space:
+		e.text.WriteByte(' ')
+	}
+	e.text.WriteString(s)
+	e.end, e.space = end, f.space
+}
+
+func (e *extractor) EndPage() {
+	if e.started {
+		e.text.WriteByte('\n')
+	}
+	e.pages = append(e.pages, Page{Counts: e.counts, Text: e.text.String()})
+}
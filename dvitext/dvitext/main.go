@@ -0,0 +1,92 @@
+// Command dvitext prints the text of a DVI file.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/speedata/gotex/dvitext"
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/internal/cmdline"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: dvitext [options] DVIFILE")
+		flag.PrintDefaults()
+	}
+	curdir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var pagespec = flag.String("page-start", "*", "start at PAGE-SPEC, for example `2' or `5.*.-2'")
+	var maxpages = flag.Int("max-pages", 0, "extract NUMBER pages; default all")
+	var basedir = flag.String("basedir", curdir, "Set the root directory with TFM, VF, encoding and font files")
+	var texmf = flag.String("texmf", "", "search the files like kpathsea in these TEXMF trees (a path list); default $TEXMF")
+	var mapfile = flag.String("map", "", "map the characters to Unicode with the encodings of this font map, for example pdftex.map; default ASCII only")
+	var output = flag.String("output", "", "write the text to this file; default standard output")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "dvitext: Need exactly one file argument.")
+		fmt.Fprintln(os.Stderr, "Try `dvitext --help' for more information.")
+		os.Exit(1)
+	}
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	opts := dvitext.Options{
+		PageSpec: *pagespec,
+		MaxPages: *maxpages,
+		Finder:   cmdline.Finder(*basedir, *texmf),
+	}
+	if *mapfile != "" {
+		opts.Map = fontmap.New()
+		if err = opts.Map.ReadFile(opts.Finder, *mapfile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	pages, err := dvitext.Extract(in, opts)
+	var fe *dvitype.FontError
+	if err != nil && !errors.As(err, &fe) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	w := bufio.NewWriter(out)
+	for i, pg := range pages {
+		if i > 0 {
+			w.WriteString("\f") // pages are separated by form feeds
+		}
+		w.WriteString(pg.Text)
+	}
+	if werr := w.Flush(); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+		os.Exit(1)
+	}
+	if werr := out.Close(); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(4)
+	}
+}
@@ -0,0 +1,107 @@
+package dvitext
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/fontmap"
+	"github.com/speedata/gotex/internal/testfont"
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+// testFont is a Type 1 font without glyphs that has eacute at code 65.
+var testFont = &testfont.Type1{Encoding: map[int]string{65: "eacute"}}
+
+func text(w *dviwriter.Writer, s string) {
+	for _, c := range s {
+		w.SetChar(int(c), 5<<16)
+	}
+}
+
+func testDVI(t *testing.T) []byte {
+	return testfont.DVI(t, func(w *dviwriter.Writer) {
+		w.FontDef(dviwriter.FontDef{Num: 0, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "plain"})
+		w.FontDef(dviwriter.FontDef{Num: 1, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "encoded"})
+		w.FontDef(dviwriter.FontDef{Num: 2, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "builtin"})
+		w.BeginPage([10]int{1})
+		w.Down(10 << 16)
+		w.Push()
+		w.SetFont(0)
+		text(w, "Hello")
+		w.Right(3 << 16) // a word space
+		text(w, "World")
+		w.Down(-3 << 16) // a superscript
+		text(w, "2")
+		w.Down(3 << 16)
+		w.SetChar(200, 5<<16) // dropped
+		w.Right(1 << 16)      // less than the font space
+		text(w, "!")
+		w.Pop()
+		w.Down(12 << 16)
+		w.Push()
+		text(w, "a")
+		w.Right(1 << 16)
+		text(w, "b")
+		w.Right(-25 << 16) // back by more than four font spaces
+		text(w, "c")
+		w.Pop()
+		w.Down(30 << 16) // a new paragraph
+		w.Push()
+		text(w, "d")
+		w.Pop()
+		w.Down(12 << 16)
+		w.Push()
+		w.SetFont(1)
+		for c := 0; c < 5; c++ {
+			w.SetChar(c, 5<<16)
+		}
+		text(w, "x")
+		w.SetFont(2)
+		text(w, "AB")
+		w.Pop()
+		w.EndPage()
+		w.BeginPage([10]int{2})
+		w.EndPage()
+	})
+}
+
+func TestExtract(t *testing.T) {
+	m, err := fontmap.Parse(strings.NewReader("encoded Encoded <test.enc\nbuiltin Test <test.pfa\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the characters 0 to 255 are 5pt wide
+	tfmdata := testfont.TFM(t, testfont.Chars{BC: 0, EC: 255, Width: 1 << 19})
+	finder := simplefilefinder.Map{
+		"plain.tfm":   tfmdata,
+		"encoded.tfm": tfmdata,
+		"builtin.tfm": tfmdata,
+		"test.enc":    []byte("% test\n/Test [ /A /f_f_i /fi /uni00E9 /compwordmark ] def\n"),
+		"test.pfa":    testFont.PFA(t),
+	}
+	pages, err := Extract(bytes.NewReader(testDVI(t)), Options{Finder: finder, Map: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[1].Counts[0] != 2 {
+		t.Fatalf("unexpected pages %+v", pages)
+	}
+	want := "Hello World2!\nab c\n\nd\nAffifiéxéB\n"
+	if pages[0].Text != want {
+		t.Errorf("got\n%q\nwant\n%q", pages[0].Text, want)
+	}
+	if pages[1].Text != "" {
+		t.Errorf("page 2 should be empty, got %q", pages[1].Text)
+	}
+
+	// without the map only ASCII is left
+	pages, err = Extract(bytes.NewReader(testDVI(t)), Options{Finder: finder, PageSpec: "1", MaxPages: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || !strings.HasSuffix(pages[0].Text, "\nxAB\n") {
+		t.Errorf("unexpected pages %+v", pages)
+	}
+}
@@ -0,0 +1,227 @@
+package dvitype
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Document is the contents of a DVI file as returned by Parse.
+type Document struct {
+	Preamble  Preamble
+	Postamble Postamble
+	Fonts     []FontDef // in order of their first definition
+	Pages     []Page
+}
+
+// Preamble holds the parameters of the pre command.
+type Preamble struct {
+	Num     int // numerator of the unit of measurement
+	Den     int // denominator of the unit of measurement
+	Mag     int // magnification times 1000
+	Comment string
+}
+
+// ReadPreamble reads the preamble at the beginning of a DVI file. It is
+// meant for programs that need the unit of measurement before they
+// interpret the file with a Handler.
+func ReadPreamble(r io.Reader) (Preamble, error) {
+	var b [15]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return Preamble{}, &DVIError{Offset: 0, Opcode: pre, Msg: "the file ended prematurely", Err: err}
+	}
+	if b[0] != pre {
+		return Preamble{}, &DVIError{Offset: 0, Opcode: -1, Msg: "First byte isn't start of preamble!"}
+	}
+	quad := func(i int) int {
+		return int(int32(uint32(b[i])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])))
+	}
+	comment := make([]byte, b[14])
+	if _, err := io.ReadFull(r, comment); err != nil {
+		return Preamble{}, &DVIError{Offset: 15, Opcode: pre, Msg: "the file ended prematurely", Err: err}
+	}
+	return Preamble{Num: quad(2), Den: quad(6), Mag: quad(10), Comment: string(comment)}, nil
+}
+
+// Postamble holds the parameters of the post command.
+type Postamble struct {
+	MaxV          int // height plus depth of the tallest page
+	MaxH          int // width of the widest page
+	MaxStackDepth int
+	TotalPages    int
+}
+
+// FontDef is a font definition (fnt_def1..fnt_def4 or native_font_def).
+type FontDef struct {
+	Num        int // external font number
+	Checksum   int
+	ScaledSize int // in DVI units
+	DesignSize int // in DVI units
+	Area       string
+	Name       string      // for native fonts the file name of the font
+	Native     *NativeFont // non-nil for the native fonts of XDV files
+}
+
+// Page is the part of a DVI file between bop and eop.
+type Page struct {
+	Pos      int64 // byte offset of the bop command
+	Counts   [10]int
+	Commands []Command
+}
+
+// Command is a decoded DVI command together with the positions after
+// it has been executed.
+type Command struct {
+	Pos     int64   // byte offset of the command
+	Opcode  int     // the command byte
+	Name    string  // mnemonic such as "setchar65", "right3" or "fntdef1"
+	P       int     // the first parameter (character, font, movement, rule height, ...)
+	Q       int     // the width of a set or put character, rule or glyph run, 0 otherwise
+	Special []byte  // the contents of an xxx command
+	Glyphs  []Glyph // the glyphs of set_glyphs and set_text_and_glyphs
+	Text    string  // the text of set_text_and_glyphs
+	H, V    int     // current position on the page in DVI units
+	HH, VV  int     // current position on the page in pixels
+	Dir     int     // current direction (pTeX), DirYoko otherwise
+}
+
+// Parse reads the DVI file from r and returns its contents. TFM files are
+// located the same way Run does it; characters of fonts that could not be
+// loaded have no width, so the horizontal positions after them are not
+// meaningful. If a TFM file is bad, Parse returns the document together
+// with a *FontError.
+func Parse(r io.ReadSeeker) (*Document, error) {
+	d := New(r)
+	d.Output = io.Discard
+	d.doc = &Document{}
+	if err := d.Run(); err != nil {
+		var fe *FontError
+		if errors.As(err, &fe) {
+			return d.doc, err
+		}
+		return nil, err
+	}
+	return d.doc, nil
+}
+
+// record appends the command that has just been interpreted to the
+// current page of the document and passes it to a DocumentHandler.
+func (d *Dvitype) record(a int, o eightbits, p, q int) {
+	dh, _ := d.Handler.(DocumentHandler)
+	indoc := d.doc != nil && len(d.doc.Pages) > 0
+	if !indoc && dh == nil {
+		return
+	}
+	c := Command{
+		Pos:    int64(a),
+		Opcode: int(o),
+		Name:   opname(o, d.xdv),
+		P:      p,
+		Dir:    d.dir,
+	}
+	c.H, c.V = physical(d.dir, d.h, d.v)
+	c.HH, c.VV = physical(d.dir, d.hh, d.vv)
+	isChar := o < set1+4 || o >= put1 && o < put1+4
+	if (isChar || o == set_rule || o == put_rule) && q != invalid_width {
+		c.Q = q
+	}
+	if o >= xxx1 && o <= xxx4 {
+		c.Special = d.xxx
+		d.xxx = nil
+	}
+	if d.xdv && (o == set_glyphs || o == set_text_and_glyphs) {
+		c.Q = q
+		c.Glyphs = d.glyphs
+		c.Text = d.text
+	}
+	if indoc {
+		pg := &d.doc.Pages[len(d.doc.Pages)-1]
+		pg.Commands = append(pg.Commands, c)
+	}
+	if dh != nil {
+		dh.Command(c)
+	}
+}
+
+// fontDefined passes the first definition of each font to the document
+// and the handler.
+func (d *Dvitype) fontDefined(fd FontDef) {
+	for _, f := range d.fontdefs {
+		if f.Num == fd.Num {
+			return
+		}
+	}
+	d.fontdefs = append(d.fontdefs, fd)
+	if d.doc != nil {
+		d.doc.Fonts = append(d.doc.Fonts, fd)
+	}
+	if d.Handler != nil {
+		d.Handler.FontDef(fd)
+	}
+}
+
+// opname returns the mnemonic of the command o. xdv tells whether o is
+// from an XDV file.
+func opname(o eightbits, xdv bool) string {
+	if xdv {
+		switch o {
+		case native_font_def:
+			return "nativefontdef"
+		case set_glyphs:
+			return "setglyphs"
+		case set_text_and_glyphs:
+			return "settextandglyphs"
+		}
+	} else if o == dir {
+		return "dir"
+	}
+	switch {
+	case o < set1:
+		return fmt.Sprintf("setchar%d", o)
+	case o < set_rule:
+		return fmt.Sprintf("set%d", o-set1+1)
+	case o == set_rule:
+		return "setrule"
+	case o < put_rule:
+		return fmt.Sprintf("put%d", o-put1+1)
+	case o == put_rule:
+		return "putrule"
+	case o == nop:
+		return "nop"
+	case o == bop:
+		return "bop"
+	case o == eop:
+		return "eop"
+	case o == push:
+		return "push"
+	case o == pop:
+		return "pop"
+	case o < w0:
+		return fmt.Sprintf("right%d", o-right1+1)
+	case o < x0:
+		return fmt.Sprintf("w%d", o-w0)
+	case o < down1:
+		return fmt.Sprintf("x%d", o-x0)
+	case o < y0:
+		return fmt.Sprintf("down%d", o-down1+1)
+	case o < z0:
+		return fmt.Sprintf("y%d", o-y0)
+	case o < fnt_num_0:
+		return fmt.Sprintf("z%d", o-z0)
+	case o < fnt1:
+		return fmt.Sprintf("fntnum%d", o-fnt_num_0)
+	case o < xxx1:
+		return fmt.Sprintf("fnt%d", o-fnt1+1)
+	case o <= xxx4:
+		return fmt.Sprintf("xxx%d", o-xxx1+1)
+	case o < pre:
+		return fmt.Sprintf("fntdef%d", o-fnt_def1+1)
+	case o == pre:
+		return "pre"
+	case o == post:
+		return "post"
+	case o == post_post:
+		return "postpost"
+	}
+	return fmt.Sprintf("undefined%d", o)
+}
@@ -7,14 +7,15 @@
 package dvitype
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/speedata/gotex/simplefilefinder"
+	"github.com/speedata/gotex/tfm"
 )
 
 func round(f float32) int {
@@ -29,11 +30,26 @@ type Dvitype struct {
 	PageSpec   string
 	MaxPages   int
 	Resolution float32
-	Basedir    string
-	dvifile    io.ReadSeeker
-	tfmfile    io.Reader
-	dvisize    int64
-	curloc     int64
+	Finder     FileFinder // opens the TFM files, if nil they are opened in the current directory
+	Output     io.Writer  // the listing, os.Stdout by default
+	Log        io.Writer  // warnings and errors, one per line; if nil they are part of the listing
+	Handler    Handler    // if set, receives the contents of the pages
+	// ExpandVirtual makes the Handler see the characters of virtual fonts
+	// replaced by the contents of their VF packets, down to real fonts.
+	// Fonts used by the packets are passed to FontDef with new numbers.
+	// The listing and the Commands of a DocumentHandler still show the
+	// DVI file as it is; without a Handler nothing is expanded.
+	ExpandVirtual bool
+	// Basedir is searched recursively for the TFM files if Finder is nil
+	// and Basedir is not empty.
+	//
+	// Deprecated: Set Finder to simplefilefinder.NewDir(basedir).
+	Basedir     string
+	dvifile     io.ReadSeeker
+	doc         *Document // non-nil when called from Parse
+	basedir     *simplefilefinder.Dir
+	basedirName string // the Basedir of basedir
+	state
 }
 
 const (
@@ -72,7 +88,16 @@ const (
 	undef5     = 254
 	undef6     = 255
 
-	ID_BYTE = 2
+	// XeTeX's extended DVI (XDV) uses some of the undefined commands.
+	native_font_def     = 252 // define a native font
+	set_glyphs          = 253 // typeset glyphs and move right
+	set_text_and_glyphs = 254 // typeset text and its glyphs and move right
+
+	dir = 255 // pTeX: change the typesetting direction
+
+	ID_BYTE      = 2
+	PTEX_ID_BYTE = 3 // identification byte of pTeX files with dir commands
+	XDV_ID_BYTE  = 7 // identification byte of XDV files
 
 	max_fonts            = 100   // maximum number of distinct fonts per DVI file
 	max_widths           = 10000 // maximum number of different characters among all fonts
@@ -98,13 +123,22 @@ const (
 	invalid_font = max_fonts
 )
 
-var (
+// state holds everything the interpreter changes while reading a DVI file.
+// It is reset at the beginning of Run.
+type state struct {
+	tfmfile io.Reader
+	dvisize int64
+	curloc  int64
+	charloc int // byte offset of the set or put command being finished
+
 	new_mag int // if positive, overrides the postamble’s magnification
 
 	// 72
 	h, v, w, x, y, z, hh, vv                       int             // current state values
 	hstack, vstack, wstack, xstack, ystack, zstack [stack_size]int // pushed down values in DVI units
 	hhstack, vvstack                               [stack_size]int //  pushed down values in pixels
+	dir                                            int             // pTeX typesetting direction
+	dirstack                                       [stack_size]int
 
 	in_postamble bool
 
@@ -118,45 +152,32 @@ var (
 	// 22
 
 	curname [name_length + 1]uint8
-	// {:24}{25:}
-	b0, b1, b2, b3 eightbits
 	// {:25}{30:}
-	font_num       = make([]int, max_fonts)
-	fontname       = make([]int, max_fonts)
-	names          = make([]uint8, name_size)
-	fontchecksum   = make([]int, max_fonts)
-	fontscaledsize = make([]int, max_fonts)
-	fontdesignsize = make([]int, max_fonts)
-	fontspace      = make([]int, max_fonts+1)
-	fontbc         = make([]int, max_fonts)
-	fontec         = make([]int, max_fonts)
-	widthbase      = make([]int, max_fonts)
-	width          = make([]int, max_widths)
+	font_num       [max_fonts + 1]int
+	fontname       [max_fonts + 1]int
+	names          [name_size]uint8
+	fontchecksum   [max_fonts + 1]int
+	fontscaledsize [max_fonts + 1]int
+	fontdesignsize [max_fonts + 1]int
+	fontspace      [max_fonts + 1]int
+	fontjfm        [max_fonts + 1]*tfm.Font // the metrics of JFM files for the char types
+	fontbc         [max_fonts + 1]int
+	fontec         [max_fonts + 1]int
+	widthbase      [max_fonts + 1]int
+	width          [max_widths]int
 	nf             int
 	widthptr       int
 	// ;{:30}{33:}
-	inwidth       [255]int
 	tfmchecksum   int
 	tfmdesignsize int
 	tfmconv       float32
 	// {:33}{39:}
-	pixelwidth             = make([]int, max_widths)
+	pixelwidth             [max_widths]int
 	conv                   float32
 	true_conv              float32
 	numerator, denominator int
 	mag                    int
 
-	// {:42}{
-	// 45
-	buffer []uint8
-	// termin:textfile;termout:textfile;{:45}
-	// 48
-	buf_ptr int
-	// {57:}inpostamble:boolean;
-	// {:64}{67:}textptr:0..linelength;
-
-	// 64
-	defaultdirectory []uint8
 	// 67
 	textptr int
 	//
@@ -188,14 +209,18 @@ var (
 	startloc          int64
 	afterpre          int64
 
-	// 108
-	m    int
-	p, q int64
-)
+	xxx []byte // contents of the last xxx command if doc != nil
 
-func bad_dvi(s string) {
-	fmt.Println("Bad DVI file:", s)
-	os.Exit(-1)
+	xdv    bool    // is this an XDV file?
+	id     int     // the identification byte the postamble should have
+	glyphs []Glyph // glyphs of the last set_glyphs or set_text_and_glyphs
+	text   string  // text of the last set_text_and_glyphs
+
+	curfontnum int       // external number of the current font, even if it is not loaded
+	fontdefs   []FontDef // all fonts defined so far
+
+	eof     bool  // has the DVI file ended prematurely?
+	fonterr error // the first font that could not be loaded because of a bad TFM file
 }
 
 type (
@@ -284,17 +309,24 @@ func (d *Dvitype) signedquad() int {
 
 // 32
 func (d *Dvitype) printFont(f int) {
+	fmt.Fprint(d.Output, d.fontName(f))
+}
+
+func (d *Dvitype) fontName(f int) string {
 	if f == invalid_font {
-		fmt.Print("UNDEFINED!")
-	} else {
-		for k := fontname[f]; k < fontname[f+1]; k++ {
-			fmt.Printf("%c", names[k])
-		}
+		return "UNDEFINED!"
 	}
+	return string(d.names[d.fontname[f]:d.fontname[f+1]])
 }
 
 // 75
 func (d *Dvitype) firstpar(o eightbits) int {
+	if d.xdv && o == native_font_def {
+		return d.signedquad()
+	}
+	if !d.xdv && o == dir {
+		return d.getbyte()
+	}
 	switch o {
 	case set_char_0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45,
 		46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64, 65, 66, 67, 68, 69, 70, 71, 72, 73, 74, 75, 76, 77, 78, 79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 89, 90, 91, 92, 93,
@@ -317,180 +349,94 @@ func (d *Dvitype) firstpar(o eightbits) int {
 	case nop, bop, eop, push, pop, pre, post, post_post, undef1, undef2, undef3, undef4, undef5, undef6:
 		return 0
 	case w0:
-		return w
+		return d.w
 	case x0:
-		return x
+		return d.x
 	case y0:
-		return y
+		return d.y
 	case z0:
-		return z
+		return d.z
 	case fnt_num_0, fnt_num_0 + 1, fnt_num_0 + 2, 174, 175, 176, 177, 178, 179, 180, 181, 182, 183, 184, 185, 186,
 		187, 188, 189, 190, 191, 192, 193, 194, 195, 196, 197, 198, 199, 200, 201, 202,
 		203, 204, 205, 206, 207, 208, 209, 210, 211, 212, 213, 214, 215, 216, 217, 218,
 		219, 220, 221, 222, 223, 224, 225, 226, 227, 228, 229, 230, 231, 232, 233, 234:
 		return int(o - fnt_num_0)
-	default:
-		panic("Can't happen")
 	}
+	// all 256 command bytes are covered above
 	return 0
 }
 
-func (d *Dvitype) readTFMWord() {
-	var err error
-	b0, err = d.readFromTFM()
-	if err != nil {
-		log.Fatal(err)
-	}
-	b1, err = d.readFromTFM()
-	if err != nil {
-		log.Fatal(err)
-	}
-	b2, err = d.readFromTFM()
-	if err != nil {
-		log.Fatal(err)
-	}
-	b3, err = d.readFromTFM()
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
 // 34
-func (d *Dvitype) inTFM(z int) bool {
-	var (
-		// k           int // index for loops
-		lh          int // length of header data, in four-byte words
-		nw          int // number of words in the width table
-		wp          int // new value of width ptr after successful input
-		alpha, beta int // quantities used in the scaling computation
-	)
-
-	// Read past the header data; goto 9997 if there is a problem 35:
-	d.readTFMWord()
-	lh = int(b2)*256 + int(b3)
-	d.readTFMWord()
-	fontbc[nf] = int(b0)*256 + int(b1)
-	fontec[nf] = int(b2)*256 + int(b3)
-	if fontec[nf] < fontbc[nf] {
-		fontbc[nf] = fontec[nf] + 1
-	}
-	if widthptr+fontec[nf]-fontbc[nf]+1 > max_widths {
-		fmt.Println("---not loaded, DVItype needs larger width table")
-		return false
-	}
-	wp = widthptr + fontec[nf] - fontbc[nf] + 1
-	d.readTFMWord()
-	nw = int(b0)*256 + int(b1)
-	if nw == 0 || nw > 256 {
-		fmt.Println("--- not loaded, TFM file is bad (3)")
-		return false
-	}
-	for k := 1; k <= 3+lh; k++ {
-		// check for eof
-		d.readTFMWord()
-		if k == 4 {
-			if b0 < 128 {
-				tfmchecksum = ((int(b0)*256+int(b1))*256+int(b2))*256 + int(b3)
-			} else {
-				tfmchecksum = (((int(b0)-256)*256+int(b1))*256+int(b2))*256 + int(b3)
-			}
-		} else if k == 5 {
-			if b0 < 128 {
-				tfmdesignsize = round(tfmconv * float32(((int(b0)*256+int(b1))*256+int(b2))*256+int(b3)))
-			} else {
-				fmt.Println("--- not loaded, TFM file is bad (4)")
-				return false
-			}
-		}
-	}
-	// :35
+// inTFM loads the widths of font nf from tfmfile scaled to z. Problems
+// with the TFM file are reported by an error wrapping ErrBadTFM; if the
+// width table is full the error wraps ErrCapacityExceeded.
+func (d *Dvitype) inTFM(z int) error {
+	var wp int // new value of width ptr after successful input
 
-	// Store character-width indices at the end of the width table 36
-	if wp > 0 {
-		for k := widthptr; k < wp; k++ {
-			d.readTFMWord()
-			if int(b0) > nw {
-				fmt.Println("--- not loaded, TFM file is bad (5)")
-				return false
-			}
-			width[k] = int(b0)
+	font, err := tfm.Parse(d.tfmfile)
+	if err != nil {
+		return err
+	}
+	d.fontbc[d.nf] = font.BC
+	d.fontec[d.nf] = font.EC
+	if d.widthptr+d.fontec[d.nf]-d.fontbc[d.nf]+1 > max_widths {
+		return fmt.Errorf("%w (max widths=%d)", ErrCapacityExceeded, max_widths)
+	}
+	wp = d.widthptr + d.fontec[d.nf] - d.fontbc[d.nf] + 1
+	d.tfmchecksum = int(int32(font.Checksum))
+	d.tfmdesignsize = round(d.tfmconv * float32(font.DesignSize))
+
+	// Move the widths to width, and append pixel width values 40
+	d.widthbase[d.nf] = d.widthptr - d.fontbc[d.nf]
+	for k := d.widthptr; k < wp; k++ {
+		ci := font.CharInfo[k-d.widthptr]
+		if ci.WidthIndex == 0 {
+			d.width[k] = invalid_width
+			d.pixelwidth[k] = 0
+		} else {
+			d.width[k] = tfm.Scale(font.Width[ci.WidthIndex], z)
+			d.pixelwidth[k] = round(d.conv * float32(d.width[k]))
 		}
 	}
-	// :36
-
-	// Read and convert the width values, setting up the in width table 37
-	// ⟨Replace z by z′ and compute α,β 38⟩;
-	alpha = 16
-	for z >= 040000000 {
-		z = z / 2
-		alpha = alpha + alpha
+	// :40
+	d.widthptr = wp
+	d.fontjfm[d.nf] = nil
+	if font.JFM != 0 {
+		d.fontjfm[d.nf] = font
 	}
-	beta = 256 / alpha
-	alpha = alpha * z
-	// :38
+	return nil
+}
 
-	for k := 0; k <= nw-1; k++ {
-		d.readTFMWord()
-		inwidth[k] = (((((int(b3) * z) / 0400) + (int(b2) * z)) / 0400) + (int(b1) * z)) / beta
-		if b0 > 0 {
-			if b0 < 255 {
-				fmt.Println("--- not loaded, TFM file is bad (1)")
-				return false
-			} else {
-				inwidth[k] = inwidth[k] - alpha
-			}
-		}
-	}
-	// :37
-	// Move the widths from in width to width , and append pixel width values 40
-	if inwidth[0] != 0 {
-		// the first width should be zero
-		fmt.Println("--- not loaded, TFM file is bad (2)")
-		return false
-	}
-	widthbase[nf] = widthptr - fontbc[nf]
-	if wp > 0 {
-		for k := widthptr; k < wp; k++ {
-			if width[k] == 0 {
-				width[k] = invalid_width
-				pixelwidth[k] = 0
-			} else {
-				width[k] = inwidth[width[k]]
-				pixelwidth[k] = round(conv * float32(width[k]))
-			}
-		}
-	}
-	// :40
-	widthptr = wp
-	return true
+// goodID reports whether k is a valid identification byte in the
+// postamble. pTeX changes it to 3 if the file has dir commands.
+func (d *Dvitype) goodID(k int) bool {
+	return k == d.id || d.id == ID_BYTE && k == PTEX_ID_BYTE
 }
 
-func (d *Dvitype) moveToByte(pos int64) {
+func (d *Dvitype) moveToByte(pos int64) error {
 	var err error
-	d.curloc, err = d.dvifile.Seek(pos, os.SEEK_SET)
+	d.curloc, err = d.dvifile.Seek(pos, io.SeekStart)
 	if err != nil {
-		log.Fatal(err)
+		return &DVIError{Offset: pos, Opcode: -1, Msg: "can't move to byte", Err: err}
 	}
+	d.eof = false
+	return nil
 }
 
+// read returns the next byte of the DVI file. Reading past the end sets
+// eof.
 func (d *Dvitype) read() (eightbits, error) {
-	x := make([]byte, 1)
-	_, err := d.dvifile.Read(x)
-	return eightbits(x[0]), err
-}
-
-func (d *Dvitype) readFromTFM() (eightbits, error) {
-	x := make([]byte, 1)
-	_, err := d.tfmfile.Read(x)
-	return eightbits(x[0]), err
+	var buf [1]byte
+	_, err := io.ReadFull(d.dvifile, buf[:])
+	if err != nil {
+		d.eof = true
+	}
+	return eightbits(buf[0]), err
 }
 
 // 59
 // e is an external font number
-func (d *Dvitype) defineFont(e int) {
-	var (
-		err error
-	)
+func (d *Dvitype) defineFont(e int) error {
 	var f int
 	var _p int          //length of the area/directory spec
 	var n int           // length of the font name proper
@@ -499,128 +445,146 @@ func (d *Dvitype) defineFont(e int) {
 	var j, k int        // indices into names
 	var mismatch bool   //  do names disagree?
 
-	if nf == max_fonts {
-		bad_dvi(fmt.Sprintf("DVItype capacity exceeded (max fonts=%d!)", max_fonts))
+	if d.nf == max_fonts {
+		return &DVIError{Offset: d.curloc - 1, Opcode: -1, Msg: fmt.Sprintf("DVItype capacity exceeded (max fonts=%d)!", max_fonts), Err: ErrCapacityExceeded}
 	}
-	font_num[nf] = e
-	for font_num[f] != e {
+	d.font_num[d.nf] = e
+	for d.font_num[f] != e {
 		f++
 	}
 	// Read the font parameters into position for font nf , and print the font name 61:
 	c = d.signedquad()
-	fontchecksum[nf] = c
+	d.fontchecksum[d.nf] = c
 	q = d.signedquad()
-	fontscaledsize[nf] = q
+	d.fontscaledsize[d.nf] = q
 	_d = d.signedquad()
-	fontdesignsize[nf] = _d
+	d.fontdesignsize[d.nf] = _d
 	if (q <= 0) || (_d <= 0) {
 		m = 1000
 	} else {
-		m = round((1000.0 * conv * float32(q)) / (true_conv * float32(_d)))
+		m = round((1000.0 * d.conv * float32(q)) / (d.true_conv * float32(_d)))
 	}
 	_p = d.getbyte()
 	n = d.getbyte()
-	if fontname[nf]+n+_p > name_size {
-		bad_dvi(fmt.Sprintf("DVItype capacity exceeded (name size=%d)!", name_size))
+	if d.fontname[d.nf]+n+_p > name_size {
+		return &DVIError{Offset: d.curloc - 1, Opcode: -1, Msg: fmt.Sprintf("DVItype capacity exceeded (name size=%d)!", name_size), Err: ErrCapacityExceeded}
 	}
-	fontname[nf+1] = fontname[nf] + n + _p
-	if showing {
-		fmt.Print(": ") // when showing is true, the font number has already been printed
+	d.fontname[d.nf+1] = d.fontname[d.nf] + n + _p
+	if d.showing {
+		fmt.Fprint(d.Output, ": ") // when showing is true, the font number has already been printed
 	} else {
-		fmt.Printf("Font %d: ", e)
+		fmt.Fprintf(d.Output, "Font %d: ", e)
 	}
 	if n+_p == 0 {
-		fmt.Print("null font name!")
+		fmt.Fprint(d.Output, "null font name!")
 	} else {
-		for k := fontname[nf]; k < fontname[nf+1]; k++ {
-			names[k] = uint8(d.getbyte())
+		for k := d.fontname[d.nf]; k < d.fontname[d.nf+1]; k++ {
+			d.names[k] = uint8(d.getbyte())
 		}
 	}
-	d.printFont(nf)
-	if !showing {
+	d.printFont(d.nf)
+	if !d.showing {
 		if m != 1000 {
-			fmt.Print(" scaled ", m)
+			fmt.Fprint(d.Output, " scaled ", m)
 		}
 	}
-	if ((d.OutMode == the_works) && in_postamble) || ((d.OutMode < the_works) && !in_postamble) {
-		if f < nf {
-			fmt.Println("---this font was already defined!")
+	if ((d.OutMode == the_works) && d.in_postamble) || ((d.OutMode < the_works) && !d.in_postamble) {
+		if f < d.nf {
+			d.warn(d.curloc, "---this font was already defined!\n")
 		}
 	} else {
-		if f == nf {
-			fmt.Println("---this font wasn't loaded before!")
+		if f == d.nf {
+			d.warn(d.curloc, "---this font wasn't loaded before!\n")
 		}
 	}
 
-	if f == nf {
+	if f == d.nf {
+		d.fontDefined(FontDef{
+			Num:        e,
+			Checksum:   c,
+			ScaledSize: q,
+			DesignSize: _d,
+			Area:       string(d.names[d.fontname[d.nf] : d.fontname[d.nf]+_p]),
+			Name:       string(d.names[d.fontname[d.nf]+_p : d.fontname[d.nf+1]]),
+		})
+	}
+	if f == d.nf {
 		// Load the new font, unless there are problems 62
 		// 66:
 		for k := 1; k <= name_length; k++ {
-			curname[k] = ' '
+			d.curname[k] = ' '
 		}
 		r = 0
-		for k := fontname[nf]; k < fontname[nf+1]; k++ {
+		for k := d.fontname[d.nf]; k < d.fontname[d.nf+1]; k++ {
 			r++
-			curname[r] = names[k]
+			d.curname[r] = d.names[k]
 		}
-		curname[r+1] = '.'
-		curname[r+2] = 't'
-		curname[r+3] = 'f'
-		curname[r+4] = 'm'
-		_fontname := string(curname[1 : r+5])
+		d.curname[r+1] = '.'
+		d.curname[r+2] = 't'
+		d.curname[r+3] = 'f'
+		d.curname[r+4] = 'm'
+		_fontname := string(d.curname[1 : r+5])
 		// :66
-		d.tfmfile, err = os.Open(simplefilefinder.Locate(_fontname))
+		tfmfile, err := d.openFile(_fontname)
 		if err != nil {
-			fmt.Println(err)
-			fmt.Print("---not loaded, TFM file can't be opened!")
+			d.warn(d.curloc, fmt.Sprintf("%s\n---not loaded, TFM file can't be opened!", err))
 		} else {
+			defer tfmfile.Close()
+			d.tfmfile = tfmfile
 			if (q <= 0) || (q >= 01000000000) {
-				fmt.Printf("---not loaded, bad scale (%d)!", q)
+				d.warn(d.curloc, fmt.Sprintf("---not loaded, bad scale (%d)!", q))
 			} else if (_d <= 0) || _d >= 01000000000 {
-				fmt.Printf("---not loaded, bad design size (%d)!", _d)
-			} else if d.inTFM(q) {
+				d.warn(d.curloc, fmt.Sprintf("---not loaded, bad design size (%d)!", _d))
+			} else if err = d.inTFM(q); err != nil {
+				if errors.Is(err, ErrCapacityExceeded) {
+					d.warn(d.curloc, "---not loaded, DVItype needs larger width table")
+				} else {
+					d.warn(d.curloc, fmt.Sprintf("---not loaded, %s", err))
+					if d.fonterr == nil {
+						d.fonterr = &FontError{Name: _fontname, Err: err}
+					}
+				}
+			} else {
 				// finish loading the new font info 63
-				fontspace[nf] = q / 6 // this is a 3-unit “thin space”
+				d.fontspace[d.nf] = q / 6 // this is a 3-unit “thin space”
 
 				//font space [nf ] = q div 6; { }
-				if (c != 0) && (tfmchecksum != 0) && (c != tfmchecksum) {
-					fmt.Println("---beware: check sums do not agree!")
-					fmt.Printf("   (%o vs. %o)\n   ", c, tfmchecksum)
+				if (c != 0) && (d.tfmchecksum != 0) && (c != d.tfmchecksum) {
+					d.warn(d.curloc, fmt.Sprintf("---beware: check sums do not agree!\n   (%o vs. %o)\n   ", c, d.tfmchecksum))
 				}
-				if abs(tfmdesignsize-_d) > 2 {
-					fmt.Printf("---beware: design sizes do not agree!\n")
-					fmt.Printf("   (%d vs. %d)\n   ", _d, tfmdesignsize)
+				if abs(d.tfmdesignsize-_d) > 2 {
+					d.warn(d.curloc, fmt.Sprintf("---beware: design sizes do not agree!\n   (%d vs. %d)\n   ", _d, d.tfmdesignsize))
 				}
-				fmt.Print("---loaded at size ", q, " DVI units")
-				_d = round((100.0 * conv * float32(q)) / (true_conv * float32(_d)))
+				fmt.Fprint(d.Output, "---loaded at size ", q, " DVI units")
+				_d = round((100.0 * d.conv * float32(q)) / (d.true_conv * float32(_d)))
 				if _d != 100 {
-					fmt.Printf("\n (this font is magnified  %d%%)", _d)
+					fmt.Fprintf(d.Output, "\n (this font is magnified  %d%%)", _d)
 				}
-				nf++ // now the new font is officially present
+				d.nf++ // now the new font is officially present
 			}
 		}
 		if d.OutMode == errors_only {
-			fmt.Println(" ")
+			fmt.Fprintln(d.Output, " ")
 		}
 	} else {
 		// Check that the current font definition matches the old one 60
-		if fontchecksum[f] != c {
-			fmt.Println("---check sum doesn't match previous definition!")
+		if d.fontchecksum[f] != c {
+			d.warn(d.curloc, "---check sum doesn't match previous definition!\n")
 		}
-		if fontscaledsize[f] != q {
-			fmt.Println("--- scaled size doesn't match previous definition!")
+		if d.fontscaledsize[f] != q {
+			d.warn(d.curloc, "--- scaled size doesn't match previous definition!\n")
 		}
-		if fontdesignsize[f] != _d {
-			fmt.Println("--- design size doesn't match previous definition!")
+		if d.fontdesignsize[f] != _d {
+			d.warn(d.curloc, "--- design size doesn't match previous definition!\n")
 		}
-		j = fontname[f]
-		k = fontname[nf]
-		if fontname[f+1]-j != fontname[nf+1]-k {
+		j = d.fontname[f]
+		k = d.fontname[d.nf]
+		if d.fontname[f+1]-j != d.fontname[d.nf+1]-k {
 			mismatch = true
 		} else {
 			mismatch = false
-			for j < fontname[f+1] {
-				if names[j] != names[k] {
+			for j < d.fontname[f+1] {
+				if d.names[j] != d.names[k] {
 					mismatch = true
 				}
 				j++
@@ -628,10 +592,11 @@ func (d *Dvitype) defineFont(e int) {
 			}
 		}
 		if mismatch {
-			fmt.Println("---font name doesn't match previous definition!")
+			d.warn(d.curloc, "---font name doesn't match previous definition!\n")
 		}
 		// :60
 	}
+	return nil
 }
 
 func abs(j int) int {
@@ -642,6 +607,20 @@ func abs(j int) int {
 	}
 }
 
+// openFile opens a font file with the Finder or below Basedir.
+func (d *Dvitype) openFile(name string) (io.ReadCloser, error) {
+	if d.Finder != nil {
+		return d.Finder.OpenFile(name)
+	}
+	if d.Basedir != "" {
+		if d.basedir == nil || d.basedirName != d.Basedir {
+			d.basedir, d.basedirName = simplefilefinder.NewDir(d.Basedir), d.Basedir
+		}
+		return d.basedir.OpenFile(name)
+	}
+	return os.Open(name)
+}
+
 func New(f io.ReadSeeker) *Dvitype {
 	d := new(Dvitype)
 	d.MaxPages = 1000000
@@ -649,50 +628,59 @@ func New(f io.ReadSeeker) *Dvitype {
 	d.PageSpec = "*"
 	d.Resolution = 300.0
 	d.dvifile = f
+	d.Output = os.Stdout
 	return d
 }
 
-func (d *Dvitype) readPostamble() {
+func (d *Dvitype) readPostamble() error {
 	var (
-		k int // loop index
-	// p, q, m int //general purpose registers
+		k int   // loop index
+		m int   // general purpose register
+		q int64 // general purpose register
 	)
-	showing = false
-	post_loc = d.curloc - 5
-	fmt.Printf("Postamble starts at byte %d.\n", post_loc)
+	d.showing = false
+	d.post_loc = d.curloc - 5
+	fmt.Fprintf(d.Output, "Postamble starts at byte %d.\n", d.post_loc)
 
-	if a := d.signedquad(); a != numerator {
-		fmt.Println("numerator doesn't match the preamble!")
+	if a := d.signedquad(); a != d.numerator {
+		d.warn(d.post_loc, "numerator doesn't match the preamble!\n")
 	}
 
-	if a := d.signedquad(); a != denominator {
-		fmt.Println("denominator doesn't match the preamble!")
+	if a := d.signedquad(); a != d.denominator {
+		d.warn(d.post_loc, "denominator doesn't match the preamble!\n")
 	}
 
-	if a := d.signedquad(); a != mag {
-		if new_mag == 0 {
-			fmt.Println("magnification doesn't match the preamble!")
+	if a := d.signedquad(); a != d.mag {
+		if d.new_mag == 0 {
+			d.warn(d.post_loc, "magnification doesn't match the preamble!\n")
 		}
 	}
-	maxv = d.signedquad()
-	maxh = d.signedquad()
-	fmt.Printf("maxv=%d, maxh=%d", maxv, maxh)
-	maxs = d.gettwobytes()
-	totalpages = d.gettwobytes()
-	fmt.Printf(", maxstackdepth=%d, totalpages=%d\n", maxs, totalpages)
+	d.maxv = d.signedquad()
+	d.maxh = d.signedquad()
+	fmt.Fprintf(d.Output, "maxv=%d, maxh=%d", d.maxv, d.maxh)
+	d.maxs = d.gettwobytes()
+	d.totalpages = d.gettwobytes()
+	fmt.Fprintf(d.Output, ", maxstackdepth=%d, totalpages=%d\n", d.maxs, d.totalpages)
+	post := Postamble{MaxV: d.maxv, MaxH: d.maxh, MaxStackDepth: d.maxs, TotalPages: d.totalpages}
+	if d.doc != nil {
+		d.doc.Postamble = post
+	}
+	if dh, ok := d.Handler.(DocumentHandler); ok {
+		dh.Postamble(post)
+	}
 	if d.OutMode < the_works {
 		// Compare the lust parameters with the accumulated facts 104
-		if maxv+99 < maxvsofar {
-			fmt.Println("warning: observed maxv was", maxvsofar)
+		if d.maxv+99 < d.maxvsofar {
+			d.warn(d.post_loc, fmt.Sprintln("warning: observed maxv was", d.maxvsofar))
 		}
-		if maxh+99 < maxhsofar {
-			fmt.Println("warning: observed maxh was  ", maxhsofar)
+		if d.maxh+99 < d.maxhsofar {
+			d.warn(d.post_loc, fmt.Sprintln("warning: observed maxh was  ", d.maxhsofar))
 		}
-		if maxs < maxssofar {
-			fmt.Println("warning: observed maxstackdepth was  ", maxssofar)
+		if d.maxs < d.maxssofar {
+			d.warn(d.post_loc, fmt.Sprintln("warning: observed maxstackdepth was  ", d.maxssofar))
 		}
-		if pagecount != totalpages {
-			fmt.Println("there are really", pagecount, " pages, not  ", totalpages, "!")
+		if d.pagecount != d.totalpages {
+			d.warn(d.post_loc, fmt.Sprintln("there are really", d.pagecount, " pages, not  ", d.totalpages, "!"))
 		}
 	}
 	// Process the font definitions of the postamble 106:
@@ -700,8 +688,16 @@ func (d *Dvitype) readPostamble() {
 		k = d.getbyte()
 		if k >= fnt_def1 && k < fnt_def1+4 {
 			p := d.firstpar(eightbits(k))
-			d.defineFont(p)
-			fmt.Println()
+			if err := d.defineFont(p); err != nil {
+				return err
+			}
+			fmt.Fprintln(d.Output)
+			k = nop
+		} else if k == native_font_def && d.xdv {
+			if err := d.defineNativeFont(d.firstpar(eightbits(k))); err != nil {
+				return err
+			}
+			fmt.Fprintln(d.Output)
 			k = nop
 		}
 		if k != nop {
@@ -709,287 +705,372 @@ func (d *Dvitype) readPostamble() {
 		}
 	}
 	if k != post_post {
-		fmt.Println("byte", d.curloc-1, "is not postpost!")
+		d.warn(d.curloc-1, fmt.Sprintln("byte", d.curloc-1, "is not postpost!"))
 	}
 	// ⟨ Make sure that the end of the file is well-formed 105 ⟩;
 	q = int64(d.signedquad())
-	if q != post_loc {
-		fmt.Println("bad postamble pointer in byte  ", d.curloc-4, "!")
+	if q != d.post_loc {
+		d.warn(d.curloc-4, fmt.Sprintln("bad postamble pointer in byte  ", d.curloc-4, "!"))
 	}
 	m = d.getbyte()
-	if m != ID_BYTE {
-		fmt.Println("identification in byte  ", d.curloc-1, " should be  ", ID_BYTE, "!")
+	if !d.goodID(m) {
+		d.warn(d.curloc-1, fmt.Sprintln("identification in byte  ", d.curloc-1, " should be  ", d.id, "!"))
 	}
 	k = int(d.curloc)
 	m = 223
-
-	// while (m = 223) && ¬eof (dvi file) do m = get byte;
-	// if ¬eof (dvi file ) then bad dvi ( "signature in byte  ", d.curloc - 1 ,  " should be 223 ") else if d.curloc < k + 4 then
-	// fmt.Println ( "not enough signature bytes at end of file ( ", d.curloc - k ,  ") ");
+	for m == 223 && !d.eof {
+		m = d.getbyte()
+	}
+	if !d.eof {
+		return d.bad_dvi(d.curloc-1, -1, "signature in byte %d should be 223", d.curloc-1)
+	} else if int(d.curloc) < k+4 {
+		d.warn(d.curloc, fmt.Sprintln("not enough signature bytes at end of file (", int(d.curloc)-k, ")"))
+	}
+	return nil
 }
 
-func (d Dvitype) Run() {
+// Run prints the listing of the DVI file. It returns a *DVIError if the
+// DVI file is bad. If the DVI file is fine but a font could not be loaded
+// because of a bad TFM file, Run returns a *FontError after the complete
+// listing has been written.
+func (d *Dvitype) Run() error {
 	var (
-		k int
+		k    int
+		p, q int64 // general purpose registers
+		err  error
 	)
 	// Set initial values 11
+	d.state = state{}
+	if d.ExpandVirtual && d.Handler != nil {
+		h := d.Handler
+		d.Handler = newExpander(d, h)
+		defer func() { d.Handler = h }()
+	}
+	if err = d.moveToByte(0); err != nil {
+		return err
+	}
 	// 74
-	maxv = 017777777777 - 99
-	maxh = 017777777777 - 99
-	maxs = stack_size + 1
-	maxvsofar = 0
-	maxhsofar = 0
-	maxssofar = 0
-	pagecount = 0
+	d.maxv = 017777777777 - 99
+	d.maxh = 017777777777 - 99
+	d.maxs = stack_size + 1
+	// 31:
+	d.fontbc[invalid_font] = 1
+	d.fontec[invalid_font] = 0
 	// 98:
-	old_backpointer = -1
-	simplefilefinder.Basedir = d.Basedir
-	var err error
+	d.old_backpointer = -1
 	// 50 dialog
-	fmt.Println("This is DVItype, Version 3.6")
-
-	start_there = make([]bool, 0)
-	start_count = make([]int, 0)
-	for k, v := range strings.Split(d.PageSpec, ".") {
-		if v == "*" {
-			start_there = append(start_there, false)
-			start_count = append(start_count, 0)
-		} else {
-			k, err = strconv.Atoi(v)
-			if err != nil {
-				panic("Not a number")
-			}
-			start_there = append(start_there, true)
-			start_count = append(start_count, k)
+	fmt.Fprintln(d.Output, "This is DVItype, Version 3.6")
 
-		}
+	d.start_there, d.start_count, err = parsePageSpec(d.PageSpec)
+	if err != nil {
+		return err
 	}
+	d.start_vals = uint8(len(d.start_count) - 1)
 
-	fmt.Println("Options selected:")
-	fmt.Print("  Starting page = ")
-	for k, v := range start_there {
-		if v {
-			fmt.Print(start_count[k])
+	fmt.Fprintln(d.Output, "Options selected:")
+	fmt.Fprint(d.Output, "  Starting page = ")
+	for k, there := range d.start_there {
+		if there {
+			fmt.Fprint(d.Output, d.start_count[k])
 		} else {
-			fmt.Print("*")
+			fmt.Fprint(d.Output, "*")
 		}
-		if k < len(start_count)-1 {
-			fmt.Print(".")
+		if k < len(d.start_count)-1 {
+			fmt.Fprint(d.Output, ".")
 		} else {
-			fmt.Println()
+			fmt.Fprintln(d.Output)
 		}
 	}
-	fmt.Printf("  Maximum number of pages =  %d\n", d.MaxPages)
-	fmt.Printf("  Output level = %d", d.OutMode)
+	fmt.Fprintf(d.Output, "  Maximum number of pages =  %d\n", d.MaxPages)
+	fmt.Fprintf(d.Output, "  Output level = %d", d.OutMode)
 	switch d.OutMode {
 	case errors_only:
-		fmt.Println(" (showing bops, fonts, and error messages only)")
+		fmt.Fprintln(d.Output, " (showing bops, fonts, and error messages only)")
 	case terse:
-		fmt.Println(" (terse)")
+		fmt.Fprintln(d.Output, " (terse)")
 	case mnemonics_only:
-		fmt.Println(" (mnemonics)")
+		fmt.Fprintln(d.Output, " (mnemonics)")
 	case verbose:
-		fmt.Println(" (verbose)")
+		fmt.Fprintln(d.Output, " (verbose)")
 	case the_works:
-		fmt.Println(" (the works)")
+		fmt.Fprintln(d.Output, " (the works)")
 	}
-	fmt.Printf("  Resolution = %12.8f pixels per inch\n", d.Resolution)
-	if new_mag > 0 {
-		fmt.Printf("  New magnification factor =  %8.3f\n", new_mag/1000)
+	fmt.Fprintf(d.Output, "  Resolution = %12.8f pixels per inch\n", d.Resolution)
+	if d.new_mag > 0 {
+		fmt.Fprintf(d.Output, "  New magnification factor =  %8.3f\n", float32(d.new_mag)/1000)
 	}
 	// :50
 
 	// A DVI-reading program that reads the postamble first need not look at the preamble; but DVItype looks at the preamble in order to do error checking, and to display the introductory comment.
 	// 109:
 	if d.getbyte() != pre {
-		bad_dvi("First byte isn't start of preamble!")
+		return d.bad_dvi(0, -1, "First byte isn't start of preamble!")
 	}
 
-	if d.getbyte() != ID_BYTE {
-		fmt.Printf("identification in byte 1 should be %d!\n", ID_BYTE)
+	d.id = ID_BYTE
+	switch k := d.getbyte(); k {
+	case ID_BYTE, PTEX_ID_BYTE:
+		d.id = k
+	case XDV_ID_BYTE:
+		d.xdv = true
+		d.id = XDV_ID_BYTE
+	default:
+		d.warn(1, fmt.Sprintf("identification in byte 1 should be %d!\n", ID_BYTE))
 	}
 	// Compute the conversion factors
-	numerator = d.signedquad()
-	denominator = d.signedquad()
+	d.numerator = d.signedquad()
+	d.denominator = d.signedquad()
 
-	if numerator <= 0 {
-		bad_dvi(fmt.Sprintf("numerator is %d", numerator))
+	if d.numerator <= 0 {
+		return d.bad_dvi(2, pre, "numerator is %d", d.numerator)
 	}
-	if numerator <= 0 {
-		bad_dvi(fmt.Sprintf("denominator is %d", denominator))
+	if d.denominator <= 0 {
+		return d.bad_dvi(6, pre, "denominator is %d", d.denominator)
 	}
-	fmt.Printf("numerator/denominator=%d/%d\n", numerator, denominator)
-	tfmconv = (25400000.0 / float32(numerator)) * float32(denominator/473628672) / 16.0
-	conv = (float32(numerator) / 254000.0) * (d.Resolution / float32(denominator))
-	mag = d.signedquad()
-	if new_mag > 0 {
-		mag = new_mag
-	} else if mag <= 0 {
-		bad_dvi(fmt.Sprintf("magnification is %d\n", mag))
+	fmt.Fprintf(d.Output, "numerator/denominator=%d/%d\n", d.numerator, d.denominator)
+	d.tfmconv = (25400000.0 / float32(d.numerator)) * float32(d.denominator/473628672) / 16.0
+	d.conv = (float32(d.numerator) / 254000.0) * (d.Resolution / float32(d.denominator))
+	d.mag = d.signedquad()
+	if d.new_mag > 0 {
+		d.mag = d.new_mag
+	} else if d.mag <= 0 {
+		return d.bad_dvi(10, pre, "magnification is %d", d.mag)
 	}
-	true_conv = conv
-	conv = true_conv * (float32(mag) / 1000.0)
-	fmt.Printf("magnification=%d; %16.8f pixels per DVI unit\n", mag, conv)
+	d.true_conv = d.conv
+	d.conv = d.true_conv * (float32(d.mag) / 1000.0)
+	fmt.Fprintf(d.Output, "magnification=%d; %16.8f pixels per DVI unit\n", d.mag, d.conv)
 
 	c := d.getbyte()
 	buf := make([]byte, c)
-	d.dvifile.Read(buf)
-	fmt.Printf("'%s'\n", string(buf))
+	if _, err = io.ReadFull(d.dvifile, buf); err != nil {
+		return &DVIError{Offset: d.curloc, Opcode: pre, Msg: "the file ended prematurely", Err: err}
+	}
+	fmt.Fprintf(d.Output, "'%s'\n", string(buf))
 	d.curloc += int64(c)
-	afterpre = d.curloc
+	pre := Preamble{Num: d.numerator, Den: d.denominator, Mag: d.mag, Comment: string(buf)}
+	if d.doc != nil {
+		d.doc.Preamble = pre
+	}
+	if dh, ok := d.Handler.(DocumentHandler); ok {
+		dh.Preamble(pre)
+	}
+	d.afterpre = d.curloc
 	// :109
 
 	if d.OutMode == the_works {
 		//   Find the postamble, working back from the end  100:
-		pos, err := d.dvifile.Seek(0, os.SEEK_END)
+		pos, err := d.dvifile.Seek(0, io.SeekEnd)
 		if err != nil {
-			log.Fatal(err)
+			return &DVIError{Offset: d.curloc, Opcode: -1, Msg: "can't find the end of the file", Err: err}
 		}
 		d.dvisize = pos
 		n := d.dvisize
 		if n < 53 {
-			bad_dvi(fmt.Sprintf("only %d bytes long", n))
+			return d.bad_dvi(n, -1, "only %d bytes long", n)
 		}
 		m := n - 4
 		for {
 			if m == 0 {
-				bad_dvi("all 223s")
+				return d.bad_dvi(0, -1, "all 223s")
+			}
+			if err = d.moveToByte(m); err != nil {
+				return err
 			}
-			d.moveToByte(m)
 			k = d.getbyte()
 			m--
 			if k != 223 {
 				break
 			}
 		}
-		if k != ID_BYTE {
-			bad_dvi(fmt.Sprintf("ID byte is %d", k))
+		if !d.goodID(k) {
+			return d.bad_dvi(m+1, -1, "ID byte is %d", k)
+		}
+		if err = d.moveToByte(m - 3); err != nil {
+			return err
 		}
-		d.moveToByte(m - 3)
 		q = int64(d.signedquad())
 		if (q < 0) || (q > m-33) {
-			bad_dvi(fmt.Sprintf("post pointer %d at byte %d", q, m-3))
+			return d.bad_dvi(m-3, -1, "post pointer %d at byte %d", q, m-3)
 		}
 
-		d.moveToByte(q)
+		if err = d.moveToByte(q); err != nil {
+			return err
+		}
 		k = d.getbyte()
 		if k != post {
-			bad_dvi(fmt.Sprintf("byte %d is not post", q))
+			return d.bad_dvi(q, k, "byte %d is not post", q)
 		}
 
-		post_loc = q
-		first_backpointer = int64(d.signedquad())
+		d.post_loc = q
+		d.first_backpointer = int64(d.signedquad())
 
-		in_postamble = true
-		d.readPostamble()
-		in_postamble = false
+		d.in_postamble = true
+		if err = d.readPostamble(); err != nil {
+			return err
+		}
+		d.in_postamble = false
 
 		// Count the pages and move to the starting page 102
-		q = post_loc
-		p = first_backpointer
-		startloc = -1
+		q = d.post_loc
+		p = d.first_backpointer
+		d.startloc = -1
 		if p < 0 {
-			in_postamble = true
+			d.in_postamble = true
 		} else {
 			// now q points to a post or bop command; p >= 0 is prev pointer
 			for {
 				if p > q-46 {
-					bad_dvi(fmt.Sprintf("page link %d after byte %d", p, q))
+					return d.bad_dvi(q, -1, "page link %d after byte %d", p, q)
 				}
 				q = p
-				d.moveToByte(q)
+				if err = d.moveToByte(q); err != nil {
+					return err
+				}
 				k = d.getbyte()
 				if k == bop {
-					pagecount++
+					d.pagecount++
 				} else {
-					bad_dvi(fmt.Sprintf("byte %d is not bop (1)", q))
+					return d.bad_dvi(q, k, "byte %d is not bop (1)", q)
 				}
 				for k := 0; k < 10; k++ {
-					count[k] = d.signedquad()
+					d.count[k] = d.signedquad()
 				}
 				p = int64(d.signedquad())
-				if start_match() {
-					startloc = q
-					old_backpointer = p
+				if d.start_match() {
+					d.startloc = q
+					d.old_backpointer = p
 				}
 				if p < 0 {
 					// link to previous bop is -1 for the first page
 					break
 				}
 			}
-			if startloc < 0 {
-				bad_dvi("starting page number could not be found!")
+			if d.startloc < 0 {
+				return d.bad_dvi(d.post_loc, -1, "starting page number could not be found!")
 			}
-			if old_backpointer < 0 {
-				startloc = afterpre // we want to check everything
+			if d.old_backpointer < 0 {
+				d.startloc = d.afterpre // we want to check everything
+			}
+			if err = d.moveToByte(d.startloc); err != nil {
+				return err
 			}
-			d.moveToByte(startloc)
 		}
-		if pagecount != totalpages {
-			fmt.Println("there are really", pagecount, "pages, not", totalpages, "!")
+		if d.pagecount != d.totalpages {
+			d.warn(d.post_loc, fmt.Sprintln("there are really", d.pagecount, "pages, not", d.totalpages, "!"))
 		}
 		// :102
 	}
-	d.skip_pages(false)
-	if !in_postamble {
+	if err = d.skip_pages(false); err != nil {
+		return err
+	}
+	if !d.in_postamble {
 		// Translate up to max pages pages 111
-		for d.MaxPages > 0 {
-			d.MaxPages--
-			fmt.Println()
-			fmt.Print(d.curloc-45, ": beginning of page ")
-			for k := 0; k <= int(start_vals); k++ {
-				fmt.Print(count[k])
-				if k < int(start_vals) {
-					fmt.Print(".")
+		for maxpages := d.MaxPages; maxpages > 0; maxpages-- {
+			fmt.Fprintln(d.Output)
+			fmt.Fprint(d.Output, d.curloc-45, ": beginning of page ")
+			if d.doc != nil {
+				d.doc.Pages = append(d.doc.Pages, Page{Pos: d.curloc - 45, Counts: d.count})
+			}
+			if d.Handler != nil {
+				var counts [10]int32
+				for k, n := range d.count {
+					counts[k] = int32(n)
+				}
+				d.Handler.BeginPage(counts, d.curloc-45)
+			}
+			for k := 0; k <= int(d.start_vals); k++ {
+				fmt.Fprint(d.Output, d.count[k])
+				if k < int(d.start_vals) {
+					fmt.Fprint(d.Output, ".")
 				} else {
-					fmt.Println()
+					fmt.Fprintln(d.Output)
 				}
 			}
-			if !d.doPage() {
-				bad_dvi("page ended unexpectedly")
+			if err = d.doPage(); err != nil {
+				return err
+			}
+			if err = d.scan_bop(); err != nil {
+				return err
 			}
-			d.scan_bop()
-			if in_postamble {
+			if d.in_postamble {
 				break
 			}
 		}
 	}
 	if d.OutMode < the_works {
-		if !in_postamble {
-			d.skip_pages(true)
+		if !d.in_postamble {
+			if err = d.skip_pages(true); err != nil {
+				return err
+			}
+		}
+		if int64(d.signedquad()) != d.old_backpointer {
+			d.warn(d.curloc-4, fmt.Sprintln("backpointer in byte", d.curloc-4, " should be ", d.old_backpointer, "!"))
+		}
+		if err = d.readPostamble(); err != nil {
+			return err
 		}
-		if int64(d.signedquad()) != old_backpointer {
-			fmt.Println("backpointer in byte", d.curloc-4, " should be ", old_backpointer, "!")
+	}
+	return d.fonterr
+}
+
+// parsePageSpec splits a page specification such as `5.*.-2' into the
+// values of \count0 to \count9 and whether they are relevant.
+func parsePageSpec(spec string) ([]bool, []int, error) {
+	parts := strings.Split(spec, ".")
+	if len(parts) > 10 {
+		return nil, nil, fmt.Errorf("dvitype: %w %q: more than ten parts", ErrBadPageSpec, spec)
+	}
+	there := make([]bool, len(parts))
+	count := make([]int, len(parts))
+	for k, part := range parts {
+		if part == "*" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dvitype: %w %q: %q is not a number", ErrBadPageSpec, spec, part)
 		}
-		d.readPostamble()
+		there[k] = true
+		count[k] = n
 	}
+	return there, count, nil
 }
-func pixelround(a int) int {
-	x := conv * float32(a)
-	return round(x)
+func (d *Dvitype) pixelround(a int) int {
+	return round(d.conv * float32(a))
 }
 
 func (d *Dvitype) outText(c uint8) {
-	if textptr == line_length-2 {
+	if d.textptr == line_length-2 {
 		d.flushText()
 	}
-	textptr++
-	textbuf[textptr] = c
+	d.textptr++
+	d.textbuf[d.textptr] = c
 }
 
 func (d *Dvitype) flushText() {
-	if textptr > 0 {
+	if d.textptr > 0 {
 		if d.OutMode > errors_only {
-			fmt.Printf("[%s]\n", string(textbuf[1:textptr+1]))
+			fmt.Fprintf(d.Output, "[%s]\n", string(d.textbuf[1:d.textptr+1]))
 		}
 	}
-	textptr = 0
+	d.textptr = 0
+}
+
+// warn reports a problem with the DVI or TFM file at byte pos. msg is
+// printed as is to the listing unless Log is set.
+func (d *Dvitype) warn(pos int64, msg string) {
+	if d.Log == nil {
+		fmt.Fprint(d.Output, msg)
+		return
+	}
+	msg = strings.Join(strings.Fields(msg), " ")
+	fmt.Fprintf(d.Log, "byte %d: %s\n", pos, strings.TrimLeft(msg, "- "))
 }
 
 func (d *Dvitype) show(pos, a interface{}) {
 	d.flushText()
-	showing = true
-	fmt.Printf("%d: %v", pos, a)
+	d.showing = true
+	fmt.Fprintf(d.Output, "%d: %v", pos, a)
 }
 
 func (d *Dvitype) major(pos int, a interface{}) {
@@ -999,19 +1080,25 @@ func (d *Dvitype) major(pos int, a interface{}) {
 }
 func (d *Dvitype) minor(pos int, a interface{}) {
 	if d.OutMode > terse {
-		showing = true
-		fmt.Printf("%d: %v", pos, a)
+		d.showing = true
+		fmt.Fprintf(d.Output, "%d: %v", pos, a)
 	}
 }
 func (d *Dvitype) error(cmd int, a interface{}) {
-	if !showing {
+	if d.Log != nil {
+		d.warn(int64(cmd), fmt.Sprint(a))
+		return
+	}
+	if !d.showing {
 		d.show(cmd, a)
 	} else {
-		fmt.Print(" ", a)
+		fmt.Fprint(d.Output, " ", a)
 	}
 }
 
-func (d *Dvitype) specialcases(o eightbits, p, a int) bool {
+// specialcases translates the commands not handled in doPage. It returns
+// false if the page has to be abandoned.
+func (d *Dvitype) specialcases(o eightbits, p, a int) (bool, error) {
 	var (
 		q       int  // parameter of the current command
 		badchar bool //  has a non-ASCII character code appeared in this xxx ?
@@ -1019,32 +1106,40 @@ func (d *Dvitype) specialcases(o eightbits, p, a int) bool {
 		vvv     int  // v, rounded to the nearest pixel
 	)
 	pure = true
+	if !d.xdv && o == dir {
+		d.dirCommand(a, p)
+		return pure, nil
+	}
+	if d.xdv && o == native_font_def {
+		d.major(a, fmt.Sprintf("nativefontdef %d", p))
+		return pure, d.defineNativeFont(p)
+	}
 	switch o {
 	// 85:
 	case down1, down1 + 1, down1 + 2, down1 + 3:
 		//outvmove
-		if abs(p) >= 5*fontspace[curfont] {
-			vv = pixelround(v + p)
+		if abs(p) >= 5*d.fontspace[d.curfont] {
+			d.vv = d.pixelround(d.v + p)
 		} else {
-			vv = vv + pixelround(p)
+			d.vv = d.vv + d.pixelround(p)
 		}
 		d.major(a, fmt.Sprintf("down%d %d", o-down1+1, p))
 		goto movedown
 	case y0, y1, y1 + 1, y1 + 2, y1 + 3:
-		y = p
-		if abs(p) >= 5*fontspace[curfont] {
-			vv = pixelround(v + p)
+		d.y = p
+		if abs(p) >= 5*d.fontspace[d.curfont] {
+			d.vv = d.pixelround(d.v + p)
 		} else {
-			vv = vv + pixelround(p)
+			d.vv = d.vv + d.pixelround(p)
 		}
 		d.major(a, fmt.Sprintf("y%d %d", o-y0, p))
 		goto movedown
 	case z0, z1, z1 + 1, z1 + 2, z1 + 3:
-		z = p
-		if abs(p) >= 5*fontspace[curfont] {
-			vv = pixelround(v + p)
+		d.z = p
+		if abs(p) >= 5*d.fontspace[d.curfont] {
+			d.vv = d.pixelround(d.v + p)
 		} else {
-			vv = vv + pixelround(p)
+			d.vv = d.vv + d.pixelround(p)
 		}
 		d.major(a, fmt.Sprintf("z%d %d", o-z0, p))
 		goto movedown
@@ -1061,12 +1156,12 @@ func (d *Dvitype) specialcases(o eightbits, p, a int) bool {
 		goto changefont
 	case fnt_def1, fnt_def1 + 1, fnt_def1 + 2, fnt_def1 + 3:
 		d.major(a, fmt.Sprintf("fntdef%d %d", o-fnt_def1+1, p))
-		d.defineFont(p)
-		return pure
+		return pure, d.defineFont(p)
 	// :86
 	case xxx1, xxx1 + 1, xxx1 + 2, xxx1 + 3:
 		// 87:
 		d.major(a, "xxx '")
+		d.xxx = nil
 		badchar = false
 		if p < 0 {
 			d.error(a, "string of negative length!")
@@ -1076,98 +1171,106 @@ func (d *Dvitype) specialcases(o eightbits, p, a int) bool {
 			if q < ' ' || q > '~' {
 				badchar = true
 			}
-			if showing {
-				fmt.Printf("%c", q)
+			if d.doc != nil || d.Handler != nil {
+				d.xxx = append(d.xxx, byte(q))
+			}
+			if d.showing {
+				fmt.Fprintf(d.Output, "%c", q)
 			}
 		}
-		if showing {
-			fmt.Print("'")
+		if d.showing {
+			fmt.Fprint(d.Output, "'")
 		}
 		if badchar {
 			d.error(a, "non-ASCII character in xxx command!")
 		}
-		return pure
+		if d.Handler != nil {
+			h, v := d.here()
+			d.Handler.Special(d.xxx, h, v)
+		}
+		return pure, nil
 		// :87
 	case pre:
 		d.error(a, "preamble command within a page!")
-		return false
+		return false, nil
 	case post, post_post:
 		d.error(a, "postamble command within a page!")
-		return false
+		return false, nil
 	default:
 		d.error(a, fmt.Sprintf("undefined command %d!", o))
-		return true
+		return true, nil
 	}
 movedown:
 	// Finish a command that sets v=v+p, then goto done 92⟩;
-	if (v > 0) && (p > 0) {
-		if v > infinity-p {
-			d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from %d to %d", p, infinity-v))
-			p = infinity - v
+	if (d.v > 0) && (p > 0) {
+		if d.v > infinity-p {
+			d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from %d to %d", p, infinity-d.v))
+			p = infinity - d.v
 		}
 	}
-	if (v < 0) && (p < 0) {
-		if -v > p+infinity {
-			d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from %d to %d", p, (-v)-infinity))
-			p = (-v) - infinity
+	if (d.v < 0) && (p < 0) {
+		if -d.v > p+infinity {
+			d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from %d to %d", p, (-d.v)-infinity))
+			p = (-d.v) - infinity
 		}
 	}
-	vvv = pixelround(v + p)
-	if abs(vvv-vv) > maxdrift {
-		if vvv > vv {
-			vv = vvv - maxdrift
+	vvv = d.pixelround(d.v + p)
+	if abs(vvv-d.vv) > maxdrift {
+		if vvv > d.vv {
+			d.vv = vvv - maxdrift
 		} else {
-			vv = vvv + maxdrift
+			d.vv = vvv + maxdrift
 		}
 	}
 
-	if showing {
+	if d.showing {
 		if d.OutMode > mnemonics_only {
-			fmt.Print(" v:=", v)
+			fmt.Fprint(d.Output, " v:=", d.v)
 			if p >= 0 {
-				fmt.Print("+")
+				fmt.Fprint(d.Output, "+")
 			}
-			fmt.Printf("%d=%d, vv:=%d", p, v+p, vv)
+			fmt.Fprintf(d.Output, "%d=%d, vv:=%d", p, d.v+p, d.vv)
 
 		}
 	}
 
-	v = v + p
+	d.v = d.v + p
 
-	if abs(v) > maxvsofar {
-		if abs(v) > maxv+99 {
-			d.error(a, fmt.Sprintf("warning: |v|>%d!", maxv))
-			maxv = abs(v)
+	if abs(d.v) > d.maxvsofar {
+		if abs(d.v) > d.maxv+99 {
+			d.error(a, fmt.Sprintf("warning: |v|>%d!", d.maxv))
+			d.maxv = abs(d.v)
 		}
-		maxvsofar = abs(v)
+		d.maxvsofar = abs(d.v)
 	}
-	return pure
+	return pure, nil
 	// :92
 changefont:
 	// ⟨ Finish a command that changes the current font, then goto done 94 ⟩;
-	font_num[nf] = p
-	curfont = 0
-	for font_num[curfont] != p {
-		curfont++
-	}
-	if curfont == nf {
-		curfont = invalid_font
+	d.curfontnum = p
+	d.font_num[d.nf] = p
+	d.curfont = 0
+	for d.font_num[d.curfont] != p {
+		d.curfont++
+	}
+	if d.curfont == d.nf {
+		d.curfont = invalid_font
 		d.error(a, fmt.Sprintf("invalid font selection: font %d was never defined!", p))
 	}
 
-	if showing {
+	if d.showing {
 		if d.OutMode > mnemonics_only {
-			fmt.Print(" current font is ")
-			d.printFont(curfont)
+			fmt.Fprint(d.Output, " current font is ")
+			d.printFont(d.curfont)
 		}
 	}
-	return pure
+	return pure, nil
 }
 
-func rulepixels(x int) int {
+func (d *Dvitype) rulepixels(a int) int {
 	var n int
-	n = int(conv * float32(x))
-	if float32(n) < conv*float32(x) {
+	n = int(d.conv * float32(a))
+	if float32(n) < d.conv*float32(a) {
 		return n + 1
 	} else {
 		return n
@@ -1175,26 +1278,34 @@ func rulepixels(x int) int {
 }
 
 // 79 doPage()
-func (d *Dvitype) doPage() bool {
-	var o eightbits        //  operation code of the current command
-	var p, q int           // parameters of the current command
-	var a int              // byte number of the current command
-	var hhh int            // h, rounded to the nearest pixel
-	curfont = invalid_font // set current font undefined
-	s = 0
-	h = 0
-	v = 0
-	x = 0
-	y = 0
-	z = 0
-	hh = 0
-	vv = 0 // initialize the state variables
+func (d *Dvitype) doPage() error {
+	var o eightbits          //  operation code of the current command
+	var p, q int             // parameters of the current command
+	var a int                // byte number of the current command
+	var hhh int              // h, rounded to the nearest pixel
+	var k int                // index into the width table
+	var cause error          // why the page has been abandoned
+	d.curfont = invalid_font // set current font undefined
+	d.curfontnum = -1
+	d.s = 0
+	d.h = 0
+	d.v = 0
+	d.x = 0
+	d.y = 0
+	d.z = 0
+	d.hh = 0
+	d.vv = 0 // initialize the state variables
+	d.dir = DirYoko
 	for {
 		//  Translate the next command in the DVI file; goto 9999 with do page = true if it was eop ; goto 9998 if premature termination is needed 80:
 		a = int(d.curloc)
-		showing = false
+		d.showing = false
 		o = eightbits(d.getbyte())
 		p = d.firstpar(o)
+		q = 0
+		if d.eof {
+			return d.bad_dvi(int64(a), int(o), "the file ended prematurely")
+		}
 		// if eof (dvi file ) then bad dvi ( "the file ended prematurely")
 
 		// Start translation of command o and goto the appropriate label to finish the job 81:
@@ -1208,6 +1319,26 @@ func (d *Dvitype) doPage() bool {
 			}
 			goto finset
 			// :88
+		} else if d.xdv && (o == set_glyphs || o == set_text_and_glyphs) {
+			d.major(a, opname(o, true))
+			q = d.readGlyphs(o)
+			if d.showing {
+				fmt.Fprintf(d.Output, " width %d, %d glyphs", q, len(d.glyphs))
+			}
+			for _, r := range d.text {
+				if r >= ' ' && r <= '~' {
+					d.outText(uint8(r))
+				}
+			}
+			if gh, ok := d.Handler.(GlyphHandler); ok {
+				h, v := d.here()
+				gh.SetGlyphs(d.curfontnum, d.glyphs, d.text, h, v)
+			}
+			if d.curfont == invalid_font {
+				d.error(a, "glyphs without a font!")
+			}
+			d.hh = d.hh + d.pixelround(q)
+			goto moveright
 		} else {
 			switch o {
 			case set1, set1 + 1, set1 + 2, set1 + 3:
@@ -1232,92 +1363,114 @@ func (d *Dvitype) doPage() bool {
 			case eop:
 				d.major(a, "eop")
 
-				if s != 0 {
-					d.error(a, fmt.Sprintf("stack not empty at end of page (level %d)!", s))
+				if d.s != 0 {
+					d.error(a, fmt.Sprintf("stack not empty at end of page (level %d)!", d.s))
+				}
+				fmt.Fprintln(d.Output)
+				d.record(a, o, p, q)
+				if d.Handler != nil {
+					d.Handler.EndPage()
 				}
-				fmt.Println()
-				return true
+				return nil
 			case push:
 				d.major(a, "push")
-				if s == maxhsofar {
-					maxssofar = s + 1
-					if s == maxs {
+				if d.s == d.maxssofar {
+					d.maxssofar = d.s + 1
+					if d.s == d.maxs {
 						d.error(a, "deeper than claimed in postamble!")
 					}
-					if s == stack_size {
+					if d.s == stack_size {
 						d.error(a, fmt.Sprintf("DVItype capacity exceeded (stack size= %d) ", stack_size))
+						cause = ErrCapacityExceeded
 						goto l9998
 					}
 				}
-				hstack[s] = h
-				vstack[s] = v
-				wstack[s] = w
-				xstack[s] = x
-				ystack[s] = y
-				zstack[s] = z
-				hhstack[s] = hh
-				vvstack[s] = vv
-				s++
-				ss = s - 1
+				d.hstack[d.s] = d.h
+				d.vstack[d.s] = d.v
+				d.wstack[d.s] = d.w
+				d.xstack[d.s] = d.x
+				d.ystack[d.s] = d.y
+				d.zstack[d.s] = d.z
+				d.hhstack[d.s] = d.hh
+				d.vvstack[d.s] = d.vv
+				d.dirstack[d.s] = d.dir
+				d.s++
+				d.ss = d.s - 1
+				if d.Handler != nil {
+					d.Handler.Push()
+				}
 				goto showstate
 			case pop:
 				d.major(a, "pop")
-				if s == 0 {
+				if d.s == 0 {
 					d.error(a, "(illegal at level zero)! ")
 				} else {
-					s--
-					hh = hhstack[s]
-					vv = vvstack[s]
-					h = hstack[s]
-					v = vstack[s]
-					w = wstack[s]
-					x = xstack[s]
-					y = ystack[s]
-					z = zstack[s]
+					d.s--
+					d.hh = d.hhstack[d.s]
+					d.vv = d.vvstack[d.s]
+					d.h = d.hstack[d.s]
+					d.v = d.vstack[d.s]
+					d.w = d.wstack[d.s]
+					d.x = d.xstack[d.s]
+					d.y = d.ystack[d.s]
+					d.z = d.zstack[d.s]
+					if d.Handler != nil {
+						d.Handler.Pop()
+					}
+					if d.dir != d.dirstack[d.s] {
+						d.dir = d.dirstack[d.s]
+						if dh, ok := d.Handler.(DirectionHandler); ok {
+							dh.SetDirection(d.dir)
+						}
+					}
 				}
 
-				ss = s
+				d.ss = d.s
 				goto showstate
 				// :83
 				// 84:
 			case right1, right1 + 1, right1 + 2, right1 + 3:
 				// outspace
-				if (p >= fontspace[curfont]) || (p <= -4*fontspace[curfont]) {
+				if (p >= d.fontspace[d.curfont]) || (p <= -4*d.fontspace[d.curfont]) {
 					d.outText(' ')
-					hh = pixelround(h + p)
+					d.hh = d.pixelround(d.h + p)
 				} else {
-					hh = hh + pixelround(p)
+					d.hh = d.hh + d.pixelround(p)
 				}
 				d.minor(a, fmt.Sprintf("right%d %d", o-right1+1, p))
 				q = p
 				goto moveright
 			case w0, w1, w1 + 1, w1 + 2, w1 + 3:
-				w = p
+				d.w = p
 				// outspace
-				if (p >= fontspace[curfont]) || (p <= -4*fontspace[curfont]) {
+				if (p >= d.fontspace[d.curfont]) || (p <= -4*d.fontspace[d.curfont]) {
 					d.outText(' ')
-					hh = pixelround(h + p)
+					d.hh = d.pixelround(d.h + p)
 				} else {
-					hh = hh + pixelround(p)
+					d.hh = d.hh + d.pixelround(p)
 				}
 				d.minor(a, fmt.Sprintf("w%d %d", int(o)-w0, p))
 				q = p
 				goto moveright
 			case x0, x1, x1 + 1, x1 + 2, x1 + 3:
-				x = p
+				d.x = p
 				// outspace
-				if (p >= fontspace[curfont]) || (p <= -4*fontspace[curfont]) {
+				if (p >= d.fontspace[d.curfont]) || (p <= -4*d.fontspace[d.curfont]) {
 					d.outText(' ')
-					hh = pixelround(h + p)
+					d.hh = d.pixelround(d.h + p)
 				} else {
-					hh = hh + pixelround(p)
+					d.hh = d.hh + d.pixelround(p)
 				}
 				d.minor(a, fmt.Sprintf("x%d %d", int(o)-x0, p))
 				q = p
 				goto moveright
 				// :84
 			default:
-				if d.specialcases(o, p, a) {
+				pure, err := d.specialcases(o, p, a)
+				if err != nil {
+					return err
+				}
+				if pure {
 					goto done
 				} else {
 					goto l9998
@@ -1328,22 +1481,33 @@ func (d *Dvitype) doPage() bool {
 		//:81
 
 	finset: //  Finish a command that either sets or puts a character, then goto move right or done 89 ⟩
-		if p < 0 {
-			p = 255 - ((-1 - p) % 256)
+		if d.Handler != nil {
+			if ph, ok := d.Handler.(PixelHandler); ok {
+				hh, vv := physical(d.dir, d.hh, d.vv)
+				ph.SetCharPixels(d.curfontnum, p, hh, vv)
+			}
+			h, v := d.here()
+			d.charloc = a
+			d.Handler.SetChar(d.curfontnum, p, h, v)
+		}
+		if jfm := d.fontjfm[d.curfont]; jfm != nil {
+			k = jfm.CharType(p) // the widths of JFM files belong to char types
+		} else if k = p; p < 0 {
+			k = 255 - ((-1 - p) % 256)
 		} else if p >= 256 {
-			p = p % 256 // width computation for oriental fonts
+			k = p % 256 // width computation for oriental fonts
 		}
-		if (p < fontbc[curfont]) || p > fontec[curfont] {
+		if (k < d.fontbc[d.curfont]) || k > d.fontec[d.curfont] {
 			q = invalid_width
 		} else {
-			q = width[widthbase[curfont]+p]
+			q = d.width[d.widthbase[d.curfont]+k]
 		}
 		if q == invalid_width {
-			d.error(a, fmt.Sprintf("character %d invalid in font", p))
-			d.printFont(curfont)
-			if curfont != invalid_font {
-				fmt.Print("!") // the invalid font has ‘!’ in its name
+			msg := fmt.Sprintf("character %d invalid in font %s", p, d.fontName(d.curfont))
+			if d.curfont != invalid_font {
+				msg += "!" // the invalid font has ‘!’ in its name
 			}
+			d.error(a, msg)
 		}
 		if o >= put1 {
 			goto done
@@ -1351,133 +1515,164 @@ func (d *Dvitype) doPage() bool {
 		if q == invalid_width {
 			q = 0
 		} else {
-			hh = hh + pixelwidth[widthbase[curfont]+p]
+			d.hh = d.hh + d.pixelwidth[d.widthbase[d.curfont]+k]
 		}
 		goto moveright
 		// :89
 	finrule: // Finish a command that either sets or puts a rule, then goto move right or done 90 ⟩
 		q = d.signedquad()
-		if showing {
-			fmt.Printf(" height %d, width %d", p, q)
+		if d.Handler != nil && p > 0 && q > 0 {
+			if ph, ok := d.Handler.(PixelHandler); ok {
+				ph.SetRulePixels(physicalRule(d.dir, d.hh, d.vv, d.rulepixels(p), d.rulepixels(q)))
+			}
+			d.Handler.SetRule(physicalRule(d.dir, d.h, d.v, p, q))
+		}
+		if d.showing {
+			fmt.Fprintf(d.Output, " height %d, width %d", p, q)
 			if d.OutMode > mnemonics_only {
 				if p <= 0 || q <= 0 {
-					fmt.Print(" (invisible) ")
+					fmt.Fprint(d.Output, " (invisible) ")
 				} else {
-					fmt.Printf(" (%dx%d pixels)", rulepixels(p), rulepixels(q))
+					fmt.Fprintf(d.Output, " (%dx%d pixels)", d.rulepixels(p), d.rulepixels(q))
 				}
 			}
 		}
 		if o == put_rule {
 			goto done
 		}
-		if showing {
+		if d.showing {
 			if d.OutMode > mnemonics_only {
-				fmt.Println()
+				fmt.Fprintln(d.Output)
 			}
 		}
-		hh = hh + rulepixels(q)
+		d.hh = d.hh + d.rulepixels(q)
 		goto moveright
 		// :90
 	moveright: // Finish a command that sets h = h + q, then goto done 91
-		if h > 0 && q > 0 {
-			if h > infinity-q {
-				d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from  %d to %d", q, infinity-h))
-				q = infinity - h
+		if d.h > 0 && q > 0 {
+			if d.h > infinity-q {
+				d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from  %d to %d", q, infinity-d.h))
+				q = infinity - d.h
 			}
 		}
-		if h < 0 && q < 0 {
-			if -h > q+infinity {
-				d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from  %d to %d", q, (-h)-infinity))
-				q = (-h) - infinity
+		if d.h < 0 && q < 0 {
+			if -d.h > q+infinity {
+				d.error(a, fmt.Sprintf("arithmetic overflow! parameter changed from  %d to %d", q, (-d.h)-infinity))
+				q = (-d.h) - infinity
 			}
 		}
-		hhh = pixelround(h + q)
-		if abs(hhh-hh) > maxdrift {
-			if hhh > hh {
-				hh = hhh - maxdrift
+		hhh = d.pixelround(d.h + q)
+		if abs(hhh-d.hh) > maxdrift {
+			if hhh > d.hh {
+				d.hh = hhh - maxdrift
 			} else {
-				hh = hhh + maxdrift
+				d.hh = hhh + maxdrift
 			}
 		}
-		if showing {
+		if d.showing {
 			if d.OutMode > mnemonics_only {
-				fmt.Printf(" h:=%d", h)
+				fmt.Fprintf(d.Output, " h:=%d", d.h)
 				if q >= 0 {
-					fmt.Print("+")
+					fmt.Fprint(d.Output, "+")
 				}
-				fmt.Printf("%d=%d, hh:=%d", q, h+q, hh)
+				fmt.Fprintf(d.Output, "%d=%d, hh:=%d", q, d.h+q, d.hh)
 			}
 		}
-		h = h + q
-		if abs(h) > maxhsofar {
-			if abs(h) > maxh+99 {
-				d.error(a, fmt.Sprintf("warning: |h|>%d!", maxh))
-				maxh = abs(h)
+		d.h = d.h + q
+		if abs(d.h) > d.maxhsofar {
+			if abs(d.h) > d.maxh+99 {
+				d.error(a, fmt.Sprintf("warning: |h|>%d!", d.maxh))
+				d.maxh = abs(d.h)
 			}
-			maxhsofar = abs(h)
+			d.maxhsofar = abs(d.h)
 		}
 		goto done
 		// :91
 	showstate: // Show the values of ss, h, v, w, x, y, z, hh, and vv then goto done 93⟩
-		if showing {
+		if d.showing {
 			if d.OutMode > mnemonics_only {
-				fmt.Println()
-				fmt.Printf("level %d:(h=%d,v=%d,w=%d,x=%d,y=%d,z=%d,hh=%d,vv=%d)", ss, h, v, w, x, y, z, hh, vv)
+				fmt.Fprintln(d.Output)
+				fmt.Fprintf(d.Output, "level %d:(h=%d,v=%d,w=%d,x=%d,y=%d,z=%d,hh=%d,vv=%d)", d.ss, d.h, d.v, d.w, d.x, d.y, d.z, d.hh, d.vv)
 			}
 		}
 		goto done
 		// :93
 	done:
-		if showing {
-			fmt.Println()
+		if d.showing {
+			fmt.Fprintln(d.Output)
+		}
+		if d.eof {
+			return d.bad_dvi(int64(a), int(o), "the file ended prematurely")
 		}
+		d.record(a, o, p, q)
 		//:80
 	}
 l9998:
-	fmt.Println("!")
-	return false
+	fmt.Fprintln(d.Output, "!")
+	return &DVIError{Offset: int64(a), Opcode: int(o), Msg: "page ended unexpectedly", Err: cause}
 }
 
 // :79
 
 // 95:
-func (d *Dvitype) skip_pages(bop_seen bool) {
+func (d *Dvitype) skip_pages(bop_seen bool) error {
 	var (
 		p int       // a parameter
 		k eightbits // command code
 	)
-	showing = false
+	d.showing = false
 	for {
 		if !bop_seen {
-			d.scan_bop()
-			if in_postamble {
-				return
+			if err := d.scan_bop(); err != nil {
+				return err
 			}
-			if !started {
-				if start_match() {
-					started = true
-					return
+			if d.in_postamble {
+				return nil
+			}
+			if !d.started {
+				if d.start_match() {
+					d.started = true
+					return nil
 				}
 			}
 		}
 		// skip until finding eop 96
-		for k != eop {
-			// if eof -> error
+		for k = nop; k != eop; {
 			k = eightbits(d.getbyte())
 			p = d.firstpar(k)
+			if d.eof {
+				return d.bad_dvi(d.curloc, int(k), "the file ended prematurely")
+			}
+			if d.xdv {
+				switch k {
+				case native_font_def:
+					if err := d.defineNativeFont(p); err != nil {
+						return err
+					}
+					fmt.Fprintln(d.Output)
+					continue
+				case set_glyphs, set_text_and_glyphs:
+					d.readGlyphs(k) // ignore
+					continue
+				}
+			} else if k == dir {
+				continue
+			}
 			switch k {
 			case set_rule, put_rule:
 				d.signedquad() // ignore
 			case fnt_def1, fnt_def1 + 1, fnt_def1 + 2, fnt_def1 + 3:
-				d.defineFont(p)
-				fmt.Println()
+				if err := d.defineFont(p); err != nil {
+					return err
+				}
+				fmt.Fprintln(d.Output)
 			case xxx1, xxx1 + 1, xxx1 + 2, xxx1 + 3:
 				for p > 0 {
 					d.getbyte() // ignore
 					p--
 				}
 			case bop, pre, post, post_post, undef1, undef2, undef3, undef4, undef5, undef6:
-				bad_dvi(fmt.Sprintf("illegal command at byte %d", d.curloc))
+				return d.bad_dvi(d.curloc-1, int(k), "illegal command at byte %d", d.curloc-1)
 			default:
 				// ignore
 			}
@@ -1490,40 +1685,50 @@ func (d *Dvitype) skip_pages(bop_seen bool) {
 // :95
 
 // 99
-func (d *Dvitype) scan_bop() {
+func (d *Dvitype) scan_bop() error {
 	k := eightbits(nop)
 	for k == nop {
-		//  if eof (dvi file ) then bad dvi ("the file ended prematurely");
 		k = eightbits(d.getbyte())
+		if d.eof {
+			return d.bad_dvi(d.curloc, -1, "the file ended prematurely")
+		}
 		if k >= fnt_def1 && k < fnt_def1+4 {
-			d.defineFont(d.firstpar(k))
+			if err := d.defineFont(d.firstpar(k)); err != nil {
+				return err
+			}
+			k = nop
+		} else if k == native_font_def && d.xdv {
+			if err := d.defineNativeFont(d.firstpar(k)); err != nil {
+				return err
+			}
 			k = nop
 		}
 	}
 	if k == post {
-		in_postamble = true
+		d.in_postamble = true
 	} else {
 		if k != bop {
-			bad_dvi(fmt.Sprintf("byte %d is not bop (2)", d.curloc))
+			return d.bad_dvi(d.curloc-1, int(k), "byte %d is not bop (2)", d.curloc-1)
 		}
-		new_backpointer = d.curloc - 1
-		pagecount++
+		d.new_backpointer = d.curloc - 1
+		d.pagecount++
 		for k := 0; k < 10; k++ {
-			count[k] = d.signedquad()
+			d.count[k] = d.signedquad()
 		}
-		if x := int64(d.signedquad()); x != old_backpointer {
-			fmt.Println("backpointer in byte", d.curloc-4, "should be", old_backpointer, ", but is", x, "!")
+		if bp := int64(d.signedquad()); bp != d.old_backpointer {
+			d.warn(d.curloc-4, fmt.Sprintln("backpointer in byte", d.curloc-4, "should be", d.old_backpointer, ", but is", bp, "!"))
 		}
-		old_backpointer = new_backpointer
+		d.old_backpointer = d.new_backpointer
 	}
+	return nil
 }
 
 // does count match the starting spec?
-func start_match() bool {
+func (d *Dvitype) start_match() bool {
 	var match bool // does everything match so far?
 	match = true
-	for k := 0; k <= int(start_vals); k++ {
-		if start_there[k] && (start_count[k] != count[k]) {
+	for k := 0; k <= int(d.start_vals); k++ {
+		if d.start_there[k] && (d.start_count[k] != d.count[k]) {
 			match = false
 		}
 	}
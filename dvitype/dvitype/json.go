@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/speedata/gotex/dvitype"
+)
+
+// The records of -format=json and -format=jsonl. Type is only set for
+// jsonl, where every line is one record.
+
+type jsonPreamble struct {
+	Type    string `json:"type,omitempty"`
+	Num     int    `json:"num"`
+	Den     int    `json:"den"`
+	Mag     int    `json:"mag"`
+	Comment string `json:"comment"`
+}
+
+type jsonNative struct {
+	Index    int    `json:"index"`
+	Flags    int    `json:"flags"`
+	Color    uint32 `json:"color"`
+	Extend   int    `json:"extend"`
+	Slant    int    `json:"slant"`
+	Embolden int    `json:"embolden"`
+}
+
+type jsonFont struct {
+	Type       string      `json:"type,omitempty"`
+	Num        int         `json:"font"`
+	Checksum   int         `json:"checksum"`
+	ScaledSize int         `json:"scaled_size"`
+	DesignSize int         `json:"design_size"`
+	Area       string      `json:"area"`
+	Name       string      `json:"name"`
+	Native     *jsonNative `json:"native,omitempty"`
+}
+
+type jsonGlyph struct {
+	ID int `json:"id"`
+	X  int `json:"x"`
+	Y  int `json:"y"`
+}
+
+type jsonCommand struct {
+	Type    string      `json:"type,omitempty"`
+	Offset  int64       `json:"offset"`
+	Opcode  int         `json:"opcode"`
+	Name    string      `json:"name"`
+	P       int         `json:"p"`
+	Q       int         `json:"q"`
+	Special []byte      `json:"special,omitempty"` // base64, since specials need not be text
+	Glyphs  []jsonGlyph `json:"glyphs,omitempty"`
+	Text    string      `json:"text,omitempty"`
+	H       int         `json:"h"`
+	V       int         `json:"v"`
+	HH      int         `json:"hh"`
+	VV      int         `json:"vv"`
+	Dir     int         `json:"dir"`
+}
+
+type jsonPage struct {
+	Type     string         `json:"type,omitempty"`
+	Offset   int64          `json:"offset"`
+	Counts   [10]int32      `json:"counts"`
+	Commands []*jsonCommand `json:"commands,omitempty"`
+}
+
+type jsonPostamble struct {
+	Type          string `json:"type,omitempty"`
+	MaxV          int    `json:"max_v"`
+	MaxH          int    `json:"max_h"`
+	MaxStackDepth int    `json:"max_stack_depth"`
+	TotalPages    int    `json:"total_pages"`
+}
+
+type jsonDocument struct {
+	Preamble  *jsonPreamble  `json:"preamble"`
+	Fonts     []*jsonFont    `json:"fonts"`
+	Pages     []*jsonPage    `json:"pages"`
+	Postamble *jsonPostamble `json:"postamble"`
+}
+
+// jsonHandler collects the document for -format=json or, if stream is
+// set, writes each record as a line for -format=jsonl.
+type jsonHandler struct {
+	dvitype.NopHandler
+	enc    *json.Encoder
+	stream bool
+	doc    jsonDocument
+	err    error // the first write error
+}
+
+func newJSONHandler(w io.Writer, stream bool) *jsonHandler {
+	return &jsonHandler{enc: json.NewEncoder(w), stream: stream, doc: jsonDocument{Fonts: []*jsonFont{}, Pages: []*jsonPage{}}}
+}
+
+func (j *jsonHandler) write(v any) {
+	if j.err == nil {
+		j.err = j.enc.Encode(v)
+	}
+}
+
+func (j *jsonHandler) Preamble(p dvitype.Preamble) {
+	r := &jsonPreamble{Num: p.Num, Den: p.Den, Mag: p.Mag, Comment: p.Comment}
+	if j.stream {
+		r.Type = "preamble"
+		j.write(r)
+		return
+	}
+	j.doc.Preamble = r
+}
+
+func (j *jsonHandler) FontDef(fd dvitype.FontDef) {
+	r := &jsonFont{Num: fd.Num, Checksum: fd.Checksum, ScaledSize: fd.ScaledSize, DesignSize: fd.DesignSize, Area: fd.Area, Name: fd.Name}
+	if n := fd.Native; n != nil {
+		r.Native = &jsonNative{Index: n.Index, Flags: n.Flags, Color: n.Color, Extend: n.Extend, Slant: n.Slant, Embolden: n.Embolden}
+	}
+	if j.stream {
+		r.Type = "fontdef"
+		j.write(r)
+		return
+	}
+	j.doc.Fonts = append(j.doc.Fonts, r)
+}
+
+func (j *jsonHandler) BeginPage(counts [10]int32, pos int64) {
+	r := &jsonPage{Offset: pos, Counts: counts}
+	if j.stream {
+		r.Type = "bop"
+		j.write(r)
+		return
+	}
+	j.doc.Pages = append(j.doc.Pages, r)
+}
+
+func (j *jsonHandler) Command(c dvitype.Command) {
+	r := &jsonCommand{Offset: c.Pos, Opcode: c.Opcode, Name: c.Name, P: c.P, Q: c.Q, Special: c.Special, Text: c.Text, H: c.H, V: c.V, HH: c.HH, VV: c.VV, Dir: c.Dir}
+	for _, g := range c.Glyphs {
+		r.Glyphs = append(r.Glyphs, jsonGlyph{ID: g.ID, X: g.X, Y: g.Y})
+	}
+	if j.stream {
+		r.Type = "command"
+		j.write(r)
+		return
+	}
+	if n := len(j.doc.Pages); n > 0 {
+		j.doc.Pages[n-1].Commands = append(j.doc.Pages[n-1].Commands, r)
+	}
+}
+
+func (j *jsonHandler) Postamble(p dvitype.Postamble) {
+	r := &jsonPostamble{MaxV: p.MaxV, MaxH: p.MaxH, MaxStackDepth: p.MaxStackDepth, TotalPages: p.TotalPages}
+	if j.stream {
+		r.Type = "postamble"
+		j.write(r)
+		return
+	}
+	j.doc.Postamble = r
+}
+
+// flush writes the document of -format=json and returns the first write
+// error.
+func (j *jsonHandler) flush() error {
+	if !j.stream {
+		j.write(&j.doc)
+	}
+	return j.err
+}
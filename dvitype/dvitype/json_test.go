@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/internal/testfont"
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func testDVI(t *testing.T) []byte {
+	return testfont.DVI(t, func(w *dviwriter.Writer) {
+		w.FontDef(dviwriter.FontDef{Num: 0, ScaledSize: 10 << 16, DesignSize: 10 << 16, Name: "test"})
+		w.BeginPage([10]int{1, 2})
+		w.Down(10 << 16)
+		w.Push()
+		w.SetFont(0)
+		w.SetChar('A', 5<<16)
+		w.PutChar('A')
+		w.Pop()
+		w.Special([]byte("color push"))
+		w.Special([]byte{0xff, 0, 'x'}) // not UTF-8
+		w.SetRule(1<<16, 20<<16)
+		w.EndPage()
+		w.BeginPage([10]int{2})
+		w.EndPage()
+	})
+}
+
+func TestJSON(t *testing.T) {
+	for _, golden := range []string{"test.json", "test.jsonl"} {
+		var out bytes.Buffer
+		d := dvitype.New(bytes.NewReader(testDVI(t)))
+		d.Finder = simplefilefinder.Map{"test.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'A', Width: 1 << 19})}
+		if status := runJSON(&out, d, filepath.Ext(golden) == ".jsonl"); status != 0 {
+			t.Fatalf("%s: exit status %d", golden, status)
+		}
+		path := filepath.Join("testdata", golden)
+		if *update {
+			if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", golden, out.Bytes(), want)
+		}
+	}
+
+	// the specials survive the round trip
+	var out bytes.Buffer
+	d := dvitype.New(bytes.NewReader(testDVI(t)))
+	d.Finder = simplefilefinder.Map{}
+	runJSON(&out, d, false)
+	var doc jsonDocument
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var specials []string
+	for _, c := range doc.Pages[0].Commands {
+		if c.Special != nil {
+			specials = append(specials, string(c.Special))
+		}
+	}
+	if len(specials) != 2 || specials[0] != "color push" || specials[1] != "\xff\x00x" {
+		t.Errorf("unexpected specials %q", specials)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for _, td := range []struct {
+		spec string
+		exp  int
+	}{{"1.x", 1}, {"*", 0}} {
+		d := dvitype.New(bytes.NewReader(testDVI(t)))
+		d.Output = io.Discard
+		d.Finder = simplefilefinder.Map{"test.tfm": testfont.TFM(t, testfont.Chars{BC: 'A', EC: 'A', Width: 1 << 19})}
+		d.PageSpec = td.spec
+		status := 0
+		if err := d.Run(); err != nil {
+			status = exitCode(err)
+		}
+		if status != td.exp {
+			t.Errorf("page spec %q: want exit status %d, got %d", td.spec, td.exp, status)
+		}
+	}
+}
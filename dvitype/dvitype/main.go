@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/internal/cmdline"
 )
 
 func main() {
@@ -28,8 +32,16 @@ func main() {
 	var pagespec = flag.String("page-start", "*", "start at PAGE-SPEC, for example `2' or `5.*.-2'")
 	var maxpages = flag.Int("max-pages", 1000000, "process NUMBER pages; default one million")
 	var basedir = flag.String("basedir", curdir, "Set the root directory with TFM files")
+	var texmf = flag.String("texmf", "", "search TFM files like kpathsea in these TEXMF trees (a path list); default $TEXMF")
+	var warnings = flag.Bool("stderr-warnings", false, "print warnings to stderr instead of the listing")
+	var format = flag.String("format", "text", "output format: text (the listing), json (one object) or jsonl (one record per line)")
 	flag.Parse()
 
+	if *format != "text" && *format != "json" && *format != "jsonl" {
+		fmt.Fprintf(os.Stderr, "dvitype: Unknown format %q.\n", *format)
+		os.Exit(1)
+	}
+
 	if len(flag.Args()) != 1 {
 		fmt.Fprintln(os.Stderr, "dvitype: Need exactly one file argument.")
 		fmt.Fprintln(os.Stderr, "Try `dvitype --help' for more information.")
@@ -45,6 +57,64 @@ func main() {
 	d.OutMode = *outmode
 	d.PageSpec = *pagespec
 	d.MaxPages = *maxpages
-	d.Basedir = *basedir
-	d.Run()
+	d.Finder = cmdline.Finder(*basedir, *texmf)
+	if *warnings {
+		d.Log = os.Stderr
+	}
+	if *format != "text" {
+		os.Exit(runJSON(os.Stdout, d, *format == "jsonl"))
+	}
+	if err = d.Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// runJSON runs d with the listing replaced by JSON on out and returns the
+// exit status. Warnings go to stderr. Like dvitype.Parse, the document
+// of json is written if only a TFM file is bad; jsonl keeps the records
+// written before any error.
+func runJSON(out io.Writer, d *dvitype.Dvitype, stream bool) int {
+	w := bufio.NewWriter(out)
+	h := newJSONHandler(w, stream)
+	d.Output = io.Discard
+	d.Log = os.Stderr
+	d.Handler = h
+	err := d.Run()
+	var fe *dvitype.FontError
+	if err != nil && !stream && !errors.As(err, &fe) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	werr := h.flush()
+	if werr == nil {
+		werr = w.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	if werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+		return 1
+	}
+	return 0
+}
+
+// exitCode returns the exit status for an error returned by Run:
+// 1 for invalid options, 2 for a bad DVI file, 3 if DVItype's capacity is
+// exceeded and 4 if a TFM file is bad.
+func exitCode(err error) int {
+	var dviErr *dvitype.DVIError
+	switch {
+	case errors.Is(err, dvitype.ErrBadPageSpec):
+		return 1
+	case errors.Is(err, dvitype.ErrCapacityExceeded):
+		return 3
+	case errors.As(err, &dviErr):
+		return 2
+	case errors.Is(err, dvitype.ErrBadTFM):
+		return 4
+	}
+	return 1
 }
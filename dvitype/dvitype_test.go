@@ -2,7 +2,18 @@ package dvitype
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/speedata/gotex/simplefilefinder"
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/vf"
 )
 
 var a = []byte{1, 2, 3, 4}
@@ -83,3 +94,839 @@ func TestRound(t *testing.T) {
 		t.Errorf("Should be %d but is %d\n", exp, res)
 	}
 }
+
+type dviBuilder struct {
+	bytes.Buffer
+}
+
+func (b *dviBuilder) quad(i int) {
+	b.Write([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+}
+
+func (b *dviBuilder) fntdef() {
+	b.Write([]byte{fnt_def1, 0})
+	b.quad(0x12345678) // checksum
+	b.quad(655360)
+	b.quad(655360)
+	b.Write([]byte{0, 8})
+	b.WriteString("testfont")
+}
+
+// testDVI returns a DVI file with one page and one font.
+func testDVI() []byte {
+	b := &dviBuilder{}
+	b.Write([]byte{pre, ID_BYTE})
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.WriteByte(11)
+	b.WriteString(" TeX output")
+
+	bopLoc := b.Len()
+	b.WriteByte(bop)
+	b.quad(1)
+	for i := 1; i < 10; i++ {
+		b.quad(0)
+	}
+	b.quad(-1)
+	b.fntdef()
+	b.WriteByte(fnt_num_0)
+	b.Write([]byte{push, down1 + 1, 0x10, 0})
+	b.WriteString("AB")
+	b.Write([]byte{pop, xxx1, 5})
+	b.WriteString("hello")
+	b.WriteByte(set_rule)
+	b.quad(100)
+	b.quad(200)
+	b.WriteByte(eop)
+
+	postLoc := b.Len()
+	b.WriteByte(post)
+	b.quad(bopLoc)
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.quad(4096)
+	b.quad(819200)
+	b.Write([]byte{0, 1, 0, 1})
+	b.fntdef()
+	b.WriteByte(post_post)
+	b.quad(postLoc)
+	b.Write([]byte{ID_BYTE, 223, 223, 223, 223})
+	return b.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(bytes.NewReader(testDVI()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Preamble.Comment != " TeX output" || doc.Preamble.Mag != 1000 {
+		t.Errorf("unexpected preamble %+v", doc.Preamble)
+	}
+	if doc.Postamble.TotalPages != 1 || doc.Postamble.MaxV != 4096 {
+		t.Errorf("unexpected postamble %+v", doc.Postamble)
+	}
+	if len(doc.Fonts) != 1 || doc.Fonts[0].Name != "testfont" || doc.Fonts[0].ScaledSize != 655360 {
+		t.Fatalf("unexpected fonts %+v", doc.Fonts)
+	}
+	if len(doc.Pages) != 1 {
+		t.Fatalf("want 1 page, got %d", len(doc.Pages))
+	}
+	pg := doc.Pages[0]
+	if pg.Pos != 15+11 || pg.Counts[0] != 1 {
+		t.Errorf("unexpected page header pos %d counts %v", pg.Pos, pg.Counts)
+	}
+	var names []string
+	for _, c := range pg.Commands {
+		names = append(names, c.Name)
+	}
+	exp := "fntdef1 fntnum0 push down2 setchar65 setchar66 pop xxx1 setrule eop"
+	if res := strings.Join(names, " "); res != exp {
+		t.Errorf("Should be %q, but is %q", exp, res)
+	}
+	if c := pg.Commands[3]; c.V != 4096 || c.P != 4096 {
+		t.Errorf("down2: want v=4096, got %+v", c)
+	}
+	if c := pg.Commands[7]; string(c.Special) != "hello" {
+		t.Errorf("xxx1: want special hello, got %q", c.Special)
+	}
+	if c := pg.Commands[8]; c.P != 100 || c.Q != 200 || c.H != 200 {
+		t.Errorf("setrule: unexpected %+v", c)
+	}
+}
+
+func TestRunTwice(t *testing.T) {
+	var first, second bytes.Buffer
+	d := New(bytes.NewReader(testDVI()))
+	d.Output = &first
+	d.Run()
+	d.Output = &second
+	d.Run()
+	if first.String() != second.String() {
+		t.Errorf("second run differs from the first:\n%s\n---\n%s", first.String(), second.String())
+	}
+}
+
+// TestConcurrent is meant to be run with the race detector (go test -race).
+func TestConcurrent(t *testing.T) {
+	want, err := Parse(bytes.NewReader(testDVI()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			doc, err := Parse(bytes.NewReader(testDVI()))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(doc, want) {
+				t.Errorf("concurrent parse differs: %+v", doc)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestErrors(t *testing.T) {
+	dvi := testDVI()
+	notpre := append([]byte{nop}, dvi[1:]...)
+	testdata := []struct {
+		name     string
+		dvi      []byte
+		pagespec string
+		outmode  int
+		offset   int64
+	}{
+		{"not pre", notpre, "*", the_works, 0},
+		{"truncated", dvi[:80], "*", errors_only, 71},
+		{"no post", dvi[:len(dvi)-8], "*", the_works, int64(len(dvi) - 12)},
+		{"page spec", dvi, "1.x", the_works, -1},
+		{"long page spec", dvi, "1.2.3.4.5.6.7.8.9.10.11", the_works, -1},
+	}
+	for _, td := range testdata {
+		d := New(bytes.NewReader(td.dvi))
+		d.Output = io.Discard
+		d.PageSpec = td.pagespec
+		d.OutMode = td.outmode
+		err := d.Run()
+		if err == nil {
+			t.Errorf("%s: want an error", td.name)
+			continue
+		}
+		var dviErr *DVIError
+		if !errors.As(err, &dviErr) {
+			if td.offset >= 0 {
+				t.Errorf("%s: want a *DVIError, got %v", td.name, err)
+			} else if !errors.Is(err, ErrBadPageSpec) {
+				t.Errorf("%s: want ErrBadPageSpec, got %v", td.name, err)
+			}
+			continue
+		}
+		if td.offset < 0 || dviErr.Offset != td.offset {
+			t.Errorf("%s: want an error at byte %d, got %v at %d", td.name, td.offset, err, dviErr.Offset)
+		}
+		want := fmt.Sprintf("(byte %d)", td.offset)
+		if dviErr.Opcode >= 0 {
+			want = fmt.Sprintf("(byte %d, opcode %d)", td.offset, dviErr.Opcode)
+		}
+		if !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("%s: the message %q should contain %q", td.name, err, want)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	dvi := testDVI()
+	copy(dvi[67:71], []byte{0, 0, 0, 5}) // backpointer of the first page
+	var listing, log bytes.Buffer
+	d := New(bytes.NewReader(dvi))
+	d.OutMode = errors_only
+	d.Output = &listing
+	d.Log = &log
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(listing.String(), "backpointer") {
+		t.Errorf("warning should not be in the listing:\n%s", listing.String())
+	}
+	exp := "byte 67: backpointer in byte 67 should be -1 , but is 5 !\n"
+	if !strings.Contains(log.String(), exp) {
+		t.Errorf("log should contain %q, but is\n%s", exp, log.String())
+	}
+}
+
+type eventHandler struct {
+	NopHandler
+	events []string
+}
+
+func (e *eventHandler) FontDef(f FontDef) {
+	e.events = append(e.events, fmt.Sprintf("fontdef %d %s", f.Num, f.Name))
+}
+
+func (e *eventHandler) BeginPage(counts [10]int32, pos int64) {
+	e.events = append(e.events, fmt.Sprintf("bop %d %d", counts[0], pos))
+}
+
+func (e *eventHandler) SetChar(font, code, h, v int) {
+	e.events = append(e.events, fmt.Sprintf("char %d %d %d,%d", font, code, h, v))
+}
+
+func (e *eventHandler) SetRule(h, v, height, width int) {
+	e.events = append(e.events, fmt.Sprintf("rule %d,%d %dx%d", h, v, height, width))
+}
+
+func (e *eventHandler) Special(data []byte, h, v int) {
+	e.events = append(e.events, fmt.Sprintf("special %q %d,%d", data, h, v))
+}
+
+func (e *eventHandler) Push()    { e.events = append(e.events, "push") }
+func (e *eventHandler) Pop()     { e.events = append(e.events, "pop") }
+func (e *eventHandler) EndPage() { e.events = append(e.events, "eop") }
+
+func TestVisit(t *testing.T) {
+	h := &eventHandler{}
+	if err := Visit(bytes.NewReader(testDVI()), h); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"fontdef 0 testfont",
+		"bop 1 26",
+		"push",
+		"char 0 65 0,4096",
+		"char 0 66 0,4096",
+		"pop",
+		`special "hello" 0,0`,
+		"rule 0,0 100x200",
+		"eop",
+	}
+	if !reflect.DeepEqual(h.events, exp) {
+		t.Errorf("Should be\n%s\nbut is\n%s", strings.Join(exp, "\n"), strings.Join(h.events, "\n"))
+	}
+}
+
+type documentHandler struct {
+	eventHandler
+	commands []Command
+}
+
+func (e *documentHandler) Preamble(p Preamble) {
+	e.events = append(e.events, fmt.Sprintf("pre %q", p.Comment))
+}
+
+func (e *documentHandler) Command(c Command) { e.commands = append(e.commands, c) }
+
+func (e *documentHandler) Postamble(p Postamble) {
+	e.events = append(e.events, fmt.Sprintf("post %d", p.TotalPages))
+}
+
+func TestDocumentHandler(t *testing.T) {
+	h := &documentHandler{}
+	if err := Visit(bytes.NewReader(testDVI()), h); err != nil {
+		t.Fatal(err)
+	}
+	// the postamble is read first at output level 4
+	exp := []string{`pre " TeX output"`, "post 1", "fontdef 0 testfont", "bop 1 26"}
+	if !reflect.DeepEqual(h.events[:4], exp) {
+		t.Errorf("Should start with %q, but is %q", exp, h.events)
+	}
+	doc, err := Parse(bytes.NewReader(testDVI()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h.commands, doc.Pages[0].Commands) {
+		t.Errorf("Should be\n%+v\nbut is\n%+v", doc.Pages[0].Commands, h.commands)
+	}
+}
+
+func TestWidths(t *testing.T) {
+	h := &eventHandler{}
+	d := New(bytes.NewReader(testDVI()))
+	d.Output = io.Discard
+	d.Finder = simplefilefinder.NewDir("testdata")
+	d.Handler = h
+	d.doc = &Document{}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"char 0 65 0,4096", "char 0 66 327680,4096"}
+	if res := h.events[3:5]; !reflect.DeepEqual(res, exp) {
+		t.Errorf("Should be %q, but is %q", exp, res)
+	}
+	if c := d.doc.Pages[0].Commands[5]; c.Q != 491520 || c.H != 819200 || c.HH != 52 {
+		t.Errorf("setchar66: unexpected %+v", c)
+	}
+
+	// put1 has the width as well, but doesn't move
+	dvi := bytes.Replace(testDVI(), []byte("AB"), []byte{put1, 'B'}, 1)
+	d = New(bytes.NewReader(dvi))
+	d.Output = io.Discard
+	d.Finder = simplefilefinder.NewDir("testdata")
+	d.doc = &Document{}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if c := d.doc.Pages[0].Commands[4]; c.Name != "put1" || c.P != 66 || c.Q != 491520 || c.H != 0 {
+		t.Errorf("put1: unexpected %+v", c)
+	}
+}
+
+type testFinder []string
+
+func (f *testFinder) OpenFile(name string) (io.ReadCloser, error) {
+	*f = append(*f, name)
+	return os.Open("testdata/" + name)
+}
+
+func TestFinder(t *testing.T) {
+	var finder testFinder
+	d := New(bytes.NewReader(testDVI()))
+	d.Output = io.Discard
+	d.Finder = &finder
+	d.doc = &Document{}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(finder) != 1 || finder[0] != "testfont.tfm" {
+		t.Errorf("unexpected files %q", finder)
+	}
+	if c := d.doc.Pages[0].Commands[5]; c.H != 819200 {
+		t.Errorf("setchar66: font not loaded, h is %d", c.H)
+	}
+
+	// the deprecated Basedir
+	d = New(bytes.NewReader(testDVI()))
+	d.Output = io.Discard
+	d.Basedir = "testdata"
+	d.doc = &Document{}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if c := d.doc.Pages[0].Commands[5]; c.H != 819200 {
+		t.Errorf("Basedir: font not loaded, h is %d", c.H)
+	}
+}
+
+// testVF returns a virtual font for testfont with the local font 0 (name
+// at scale). A is C moved right by 0.1 followed by B, B is AA.
+func testVF(name string, scale int) []byte {
+	b := &dviBuilder{}
+	b.Write([]byte{247, 202, 0})
+	b.quad(0x12345678)
+	b.quad(10 << 20)
+	b.Write([]byte{fnt_def1, 0})
+	b.quad(0x12345678)
+	b.quad(scale)
+	b.quad(10 << 20)
+	b.Write([]byte{0, byte(len(name))})
+	b.WriteString(name)
+	packetA := []byte{push, right1 + 2, 0x01, 0x99, 0x9a, 'C', pop, 'B'}
+	b.Write([]byte{byte(len(packetA)), 'A', 0x08, 0, 0})
+	b.Write(packetA)
+	b.Write([]byte{2, 'B', 0x0c, 0, 0, 'A', 'A'})
+	b.Write([]byte{post, post, post})
+	return b.Bytes()
+}
+
+func TestExpandVirtual(t *testing.T) {
+	tfmData, err := os.ReadFile("testdata/testfont.tfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &eventHandler{}
+	d := New(bytes.NewReader(testDVI()))
+	d.Output = io.Discard
+	d.Handler = h
+	d.ExpandVirtual = true
+	d.Finder = simplefilefinder.Map{
+		"testfont.tfm": tfmData,
+		"testfont.vf":  testVF("real", 1<<20),
+		"real.tfm":     tfmData,
+	}
+	if err = d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"bop 1 26",
+		"push",
+		"fontdef 1 real",
+		"push",
+		"char 1 67 65536,4096",
+		"pop",
+		"char 1 66 0,4096",
+		"char 1 65 327680,4096",
+		"char 1 65 655360,4096",
+		"pop",
+		`special "hello" 0,0`,
+		"rule 0,0 100x200",
+		"eop",
+	}
+	if !reflect.DeepEqual(h.events, exp) {
+		t.Errorf("Should be\n%s\nbut is\n%s", strings.Join(exp, "\n"), strings.Join(h.events, "\n"))
+	}
+	if d.Handler != h {
+		t.Error("Run should restore the handler")
+	}
+
+	// a DocumentHandler gets the commands of the DVI file itself
+	dh := &documentHandler{}
+	d = New(bytes.NewReader(testDVI()))
+	d.Output = io.Discard
+	d.Handler = dh
+	d.ExpandVirtual = true
+	d.Finder = simplefilefinder.Map{
+		"testfont.tfm": tfmData,
+		"testfont.vf":  testVF("real", 1<<20),
+		"real.tfm":     tfmData,
+	}
+	if err = d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range dh.commands {
+		names = append(names, c.Name)
+	}
+	if len(dh.events) == 0 || dh.events[0] != `pre " TeX output"` || strings.Join(names, " ") != "fntdef1 fntnum0 push down2 setchar65 setchar66 pop xxx1 setrule eop" {
+		t.Errorf("unexpected records %q, commands %q", dh.events, names)
+	}
+
+	// characters that are missing in the virtual font are reported
+	var log bytes.Buffer
+	dvi := bytes.Replace(testDVI(), []byte("AB"), []byte("AC"), 1)
+	d = New(bytes.NewReader(dvi))
+	d.Output = io.Discard
+	d.Log = &log
+	d.Handler = &eventHandler{}
+	d.ExpandVirtual = true
+	d.Finder = simplefilefinder.Map{
+		"testfont.tfm": tfmData,
+		"testfont.vf":  testVF("real", 1<<20),
+		"real.tfm":     tfmData,
+	}
+	if err = d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := fmt.Sprintf("byte %d: character 67 invalid in virtual font testfont!\n", bytes.Index(dvi, []byte("AC"))+1); !strings.Contains(log.String(), exp) {
+		t.Errorf("the log should contain %q, but is %q", exp, log.String())
+	}
+
+	// a virtual font that uses itself
+	d = New(bytes.NewReader(testDVI()))
+	d.Output = io.Discard
+	d.Handler = &eventHandler{}
+	d.ExpandVirtual = true
+	d.Finder = simplefilefinder.Map{
+		"testfont.tfm": tfmData,
+		"testfont.vf":  testVF("testfont", 1<<20),
+	}
+	if err = d.Run(); !errors.Is(err, ErrVirtualFontLoop) {
+		t.Errorf("want ErrVirtualFontLoop, got %v", err)
+	}
+
+	// a local font of 4096pt
+	big := bytes.ReplaceAll(testDVI(), []byte{0, 0x0a, 0, 0}, []byte{4, 0, 0, 0}) // 1024pt
+	d = New(bytes.NewReader(big))
+	d.Output = io.Discard
+	d.Handler = &eventHandler{}
+	d.ExpandVirtual = true
+	d.Finder = simplefilefinder.Map{
+		"testfont.tfm": tfmData,
+		"testfont.vf":  testVF("real", 4<<20),
+		"real.tfm":     tfmData,
+	}
+	if err = d.Run(); !errors.Is(err, tfm.ErrBadSize) || !errors.Is(err, vf.ErrBadVF) {
+		t.Errorf("want ErrBadVF and ErrBadSize, got %v", err)
+	}
+}
+
+type pixelHandler struct {
+	eventHandler
+}
+
+func (e *pixelHandler) SetCharPixels(font, code, hh, vv int) {
+	e.events = append(e.events, fmt.Sprintf("pixels %d %d %d,%d", font, code, hh, vv))
+}
+
+func (e *pixelHandler) SetRulePixels(hh, vv, height, width int) {
+	e.events = append(e.events, fmt.Sprintf("rulepixels %d,%d %dx%d", hh, vv, height, width))
+}
+
+func TestPixels(t *testing.T) {
+	tfmData, err := os.ReadFile("testdata/testfont.tfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &pixelHandler{}
+	d := New(bytes.NewReader(testDVI()))
+	d.Output = io.Discard
+	d.Handler = h
+	d.ExpandVirtual = true
+	d.Resolution = 7227
+	d.Finder = simplefilefinder.Map{
+		"testfont.tfm": tfmData,
+		"testfont.vf":  testVF("real", 1<<20),
+		"real.tfm":     tfmData,
+	}
+	if err = d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, e := range h.events {
+		if strings.Contains(e, "pixels") {
+			res = append(res, e)
+		}
+	}
+	exp := []string{
+		"pixels 1 67 100,6",
+		"pixels 1 66 0,6",
+		"pixels 1 65 500,6",
+		"pixels 1 65 1000,6",
+		"rulepixels 0,0 1x1",
+	}
+	if !reflect.DeepEqual(res, exp) {
+		t.Errorf("Should be\n%s\nbut is\n%s", strings.Join(exp, "\n"), strings.Join(res, "\n"))
+	}
+}
+
+func (e *eventHandler) SetGlyphs(font int, glyphs []Glyph, text string, h, v int) {
+	e.events = append(e.events, fmt.Sprintf("glyphs %d %v %q %d,%d", font, glyphs, text, h, v))
+}
+
+func (b *dviBuilder) nativefontdef(flags int, extra ...int) {
+	b.WriteByte(native_font_def)
+	b.quad(1)
+	b.quad(655360)
+	b.Write([]byte{byte(flags >> 8), byte(flags), 11})
+	b.WriteString("lmroman.otf")
+	b.quad(2)
+	for _, e := range extra {
+		b.quad(e)
+	}
+}
+
+// testXDV returns an XDV file with a native font and two glyph runs.
+func testXDV() []byte {
+	b := &dviBuilder{}
+	b.Write([]byte{pre, XDV_ID_BYTE})
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.WriteByte(0)
+
+	bopLoc := b.Len()
+	b.WriteByte(bop)
+	b.quad(1)
+	for i := 1; i < 10; i++ {
+		b.quad(0)
+	}
+	b.quad(-1)
+	b.nativefontdef(NativeColored|NativeSlant, 0xff0000ff, 0x3000)
+	b.WriteByte(fnt_num_0 + 1)
+	b.WriteByte(set_text_and_glyphs)
+	b.Write([]byte{0, 2, 0, 'H', 0, 'i'})
+	b.quad(1000)
+	b.Write([]byte{0, 2})
+	b.quad(0)
+	b.quad(0)
+	b.quad(600)
+	b.quad(-5)
+	b.Write([]byte{0, 43, 0, 76})
+	b.WriteByte(set_glyphs)
+	b.quad(300)
+	b.Write([]byte{0, 1})
+	b.quad(0)
+	b.quad(0)
+	b.Write([]byte{1, 2})
+	b.WriteByte(eop)
+
+	postLoc := b.Len()
+	b.WriteByte(post)
+	b.quad(bopLoc)
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.quad(0)
+	b.quad(1300)
+	b.Write([]byte{0, 0, 0, 1})
+	b.nativefontdef(NativeColored|NativeSlant, 0xff0000ff, 0x3000)
+	b.WriteByte(post_post)
+	b.quad(postLoc)
+	b.Write([]byte{XDV_ID_BYTE, 223, 223, 223, 223})
+	return b.Bytes()
+}
+
+func TestXDV(t *testing.T) {
+	var listing bytes.Buffer
+	h := &eventHandler{}
+	d := New(bytes.NewReader(testXDV()))
+	d.Output = &listing
+	d.Handler = h
+	d.doc = &Document{}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"fontdef 1 lmroman.otf",
+		"bop 1 15",
+		`glyphs 1 [{43 0 0} {76 600 -5}] "Hi" 0,0`,
+		`glyphs 1 [{258 0 0}] "" 1000,0`,
+		"eop",
+	}
+	if !reflect.DeepEqual(h.events, exp) {
+		t.Errorf("Should be\n%s\nbut is\n%s", strings.Join(exp, "\n"), strings.Join(h.events, "\n"))
+	}
+	fd := d.doc.Fonts[0]
+	if n := fd.Native; n == nil || n.Index != 2 || n.Color != 0xff0000ff || n.Slant != 0x3000 || n.Extend != 0x10000 {
+		t.Errorf("unexpected native font %+v", n)
+	}
+	var names []string
+	for _, c := range d.doc.Pages[0].Commands {
+		names = append(names, c.Name)
+	}
+	if res := strings.Join(names, " "); res != "nativefontdef fntnum1 settextandglyphs setglyphs eop" {
+		t.Errorf("unexpected commands %q", res)
+	}
+	if c := d.doc.Pages[0].Commands[3]; c.Q != 300 || c.H != 1300 || len(c.Glyphs) != 1 {
+		t.Errorf("setglyphs: unexpected %+v", c)
+	}
+	for _, s := range []string{"Font 1: lmroman.otf[2] color FF0000FF slant 12288---native font at size 655360 DVI units", "[Hi]"} {
+		if !strings.Contains(listing.String(), s) {
+			t.Errorf("listing should contain %q:\n%s", s, listing.String())
+		}
+	}
+	if strings.Contains(listing.String(), "undefined") || strings.Contains(listing.String(), "should be") {
+		t.Errorf("unexpected warning:\n%s", listing.String())
+	}
+}
+
+// testXDVSkip returns an XDV file whose native font is defined on the
+// first of two pages.
+func testXDVSkip() []byte {
+	b := &dviBuilder{}
+	b.Write([]byte{pre, XDV_ID_BYTE})
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.WriteByte(0)
+
+	prev := -1
+	for page := 1; page <= 2; page++ {
+		bopLoc := b.Len()
+		b.WriteByte(bop)
+		b.quad(page)
+		for i := 1; i < 10; i++ {
+			b.quad(0)
+		}
+		b.quad(prev)
+		prev = bopLoc
+		if page == 1 {
+			b.nativefontdef(0)
+		}
+		b.WriteByte(fnt_num_0 + 1)
+		b.WriteByte(set_glyphs)
+		b.quad(300)
+		b.Write([]byte{0, 1})
+		b.quad(0)
+		b.quad(0)
+		b.Write([]byte{0, 43})
+		b.WriteByte(eop)
+	}
+
+	postLoc := b.Len()
+	b.WriteByte(post)
+	b.quad(prev)
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.quad(0)
+	b.quad(300)
+	b.Write([]byte{0, 0, 0, 2})
+	b.nativefontdef(0)
+	b.WriteByte(post_post)
+	b.quad(postLoc)
+	b.Write([]byte{XDV_ID_BYTE, 223, 223, 223, 223})
+	return b.Bytes()
+}
+
+func TestXDVSkipPages(t *testing.T) {
+	for _, outmode := range []int{errors_only, the_works} {
+		var listing bytes.Buffer
+		h := &eventHandler{}
+		d := New(bytes.NewReader(testXDVSkip()))
+		d.Output = &listing
+		d.OutMode = outmode
+		d.PageSpec = "2"
+		d.Handler = h
+		if err := d.Run(); err != nil {
+			t.Fatalf("output level %d: %v", outmode, err)
+		}
+		exp := []string{
+			"fontdef 1 lmroman.otf",
+			"bop 2 106",
+			`glyphs 1 [{43 0 0}] "" 0,0`,
+			"eop",
+		}
+		if !reflect.DeepEqual(h.events, exp) {
+			t.Errorf("output level %d: should be\n%s\nbut is\n%s", outmode, strings.Join(exp, "\n"), strings.Join(h.events, "\n"))
+		}
+		for _, s := range []string{"null font name", "there are really"} {
+			if strings.Contains(listing.String(), s) {
+				t.Errorf("output level %d: unexpected %q in listing:\n%s", outmode, s, listing.String())
+			}
+		}
+	}
+}
+
+func (e *eventHandler) SetDirection(dir int) {
+	e.events = append(e.events, fmt.Sprintf("dir %d", dir))
+}
+
+// testJFM returns a JFM file where the characters of type 1 are half as
+// wide as the others.
+func testJFM(t *testing.T) []byte {
+	f := &tfm.Font{
+		JFM:        tfm.JFMTate,
+		DesignSize: 10 << 20,
+		EC:         1,
+		CharInfo:   []tfm.CharInfo{{WidthIndex: 1, HeightIndex: 1}, {WidthIndex: 2, HeightIndex: 1}},
+		Width:      []tfm.FixWord{0, 1 << 20, 1 << 19},
+		Height:     []tfm.FixWord{0, 1 << 19},
+		Depth:      []tfm.FixWord{0},
+		Italic:     []tfm.FixWord{0},
+		CharTypes:  map[int]int{0x3001: 1},
+	}
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// testPTeX returns a DVI file with a vertical box of two Japanese
+// characters and a rule.
+func testPTeX() []byte {
+	b := &dviBuilder{}
+	b.Write([]byte{pre, ID_BYTE})
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.WriteByte(0)
+
+	bopLoc := b.Len()
+	b.WriteByte(bop)
+	b.quad(1)
+	for i := 1; i < 10; i++ {
+		b.quad(0)
+	}
+	b.quad(-1)
+	b.Write([]byte{fnt_def1, 0})
+	b.quad(0)
+	b.quad(655360)
+	b.quad(655360)
+	b.Write([]byte{0, 3})
+	b.WriteString("jis")
+	b.Write([]byte{fnt_num_0, push, dir, DirTate})
+	b.Write([]byte{set1 + 1, 0x30, 0x42, set1 + 1, 0x30, 0x01, down1, 10, set_rule})
+	b.quad(100)
+	b.quad(200)
+	b.Write([]byte{pop, eop})
+
+	postLoc := b.Len()
+	b.WriteByte(post)
+	b.quad(bopLoc)
+	b.quad(25400000)
+	b.quad(473628672)
+	b.quad(1000)
+	b.quad(0)
+	b.quad(0)
+	b.Write([]byte{0, 1, 0, 1})
+	b.WriteByte(post_post)
+	b.quad(postLoc)
+	b.Write([]byte{PTEX_ID_BYTE, 223, 223, 223, 223})
+	return b.Bytes()
+}
+
+func TestPTeX(t *testing.T) {
+	var listing bytes.Buffer
+	h := &eventHandler{}
+	d := New(bytes.NewReader(testPTeX()))
+	d.Output = &listing
+	d.Handler = h
+	d.Finder = simplefilefinder.Map{"jis.tfm": testJFM(t)}
+	d.doc = &Document{}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"bop 1 15",
+		"fontdef 0 jis",
+		"push",
+		"dir 1",
+		"char 0 12354 0,0",
+		"char 0 12289 0,655360",
+		"rule -10,983240 200x100",
+		"pop",
+		"dir 0",
+		"eop",
+	}
+	if !reflect.DeepEqual(h.events, exp) {
+		t.Errorf("Should be\n%s\nbut is\n%s", strings.Join(exp, "\n"), strings.Join(h.events, "\n"))
+	}
+	cmds := d.doc.Pages[0].Commands
+	if c := cmds[5]; c.Name != "set2" || c.Q != 327680 || c.Dir != DirTate || c.H != 0 || c.V != 983040 {
+		t.Errorf("set2: unexpected %+v", c)
+	}
+	if c := cmds[8]; c.Name != "pop" || c.Dir != DirYoko || c.H != 0 || c.V != 0 {
+		t.Errorf("pop: unexpected %+v", c)
+	}
+	for _, s := range []string{"dir 1", "identification", "invalid"} {
+		if strings.Contains(listing.String(), s) != (s == "dir 1") {
+			t.Errorf("unexpected listing for %q:\n%s", s, listing.String())
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package dvitype
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/speedata/gotex/tfm"
+)
+
+var (
+	// ErrCapacityExceeded is wrapped by errors that occur when a DVI file
+	// needs more fonts, font name space or stack depth than DVItype
+	// provides.
+	ErrCapacityExceeded = errors.New("DVItype capacity exceeded")
+	// ErrBadTFM is wrapped by errors about TFM files that can't be used.
+	// A font with a bad TFM file is not loaded, but the DVI file is
+	// processed nonetheless.
+	ErrBadTFM = tfm.ErrBadTFM
+	// ErrBadPageSpec is wrapped by the error that is returned if
+	// PageSpec can't be parsed.
+	ErrBadPageSpec = errors.New("bad page spec")
+)
+
+// DVIError is returned when a DVI file can't be processed.
+type DVIError struct {
+	Offset int64 // byte position in the DVI file
+	Opcode int   // the command at Offset or -1 if not applicable
+	Msg    string
+	Err    error // underlying error, if any
+}
+
+func (e *DVIError) Error() string {
+	if e.Opcode >= 0 {
+		return fmt.Sprintf("Bad DVI file: %s (byte %d, opcode %d)", e.Msg, e.Offset, e.Opcode)
+	}
+	return fmt.Sprintf("Bad DVI file: %s (byte %d)", e.Msg, e.Offset)
+}
+
+func (e *DVIError) Unwrap() error {
+	return e.Err
+}
+
+// FontError is returned by Run after the DVI file has been processed if
+// the TFM file of a font could not be loaded because it is bad.
+type FontError struct {
+	Name string // the file name of the TFM file
+	Err  error  // wraps ErrBadTFM
+}
+
+func (e *FontError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err)
+}
+
+func (e *FontError) Unwrap() error {
+	return e.Err
+}
+
+func (d *Dvitype) bad_dvi(pos int64, o int, format string, a ...interface{}) error {
+	return &DVIError{Offset: pos, Opcode: o, Msg: fmt.Sprintf(format, a...)}
+}
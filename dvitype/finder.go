@@ -0,0 +1,13 @@
+package dvitype
+
+import (
+	"io"
+)
+
+// A FileFinder opens the font files a DVI file needs. The name is the
+// file name with suffix, for example cmr10.tfm. The package
+// simplefilefinder has implementations for a directory tree, an fs.FS, a
+// zip archive and a map, a *kpathsea.Resolver searches like TeX does.
+type FileFinder interface {
+	OpenFile(name string) (io.ReadCloser, error)
+}
@@ -0,0 +1,98 @@
+package dvitype
+
+import (
+	"io"
+)
+
+// Handler receives the contents of the pages while the DVI file is being
+// interpreted. Positions are in DVI units, v grows downwards. Fonts are
+// identified by their external font number (FontDef.Num).
+type Handler interface {
+	// FontDef is called once for every font, the first time it is defined.
+	FontDef(f FontDef)
+	// BeginPage is called for each bop. pos is the byte offset of the bop.
+	BeginPage(counts [10]int32, pos int64)
+	// SetChar is called for each set and put command with the position of
+	// the reference point of the character.
+	SetChar(font, code, h, v int)
+	// SetRule is called for each visible rule. h and v is the lower left
+	// corner of the rule.
+	SetRule(h, v, height, width int)
+	// Special is called for each xxx command.
+	Special(data []byte, h, v int)
+	Push()
+	Pop()
+	EndPage()
+}
+
+// GlyphHandler is implemented by handlers that want the glyphs of XDV
+// files. The glyphs of other handlers are dropped.
+type GlyphHandler interface {
+	// SetGlyphs is called for each set_glyphs and set_text_and_glyphs
+	// command. text is empty for set_glyphs.
+	SetGlyphs(font int, glyphs []Glyph, text string, h, v int)
+}
+
+// DirectionHandler is implemented by handlers that want to know the
+// typesetting direction of pTeX files. Every page starts with DirYoko.
+type DirectionHandler interface {
+	// SetDirection is called when the direction changes by a dir
+	// command or by a pop. In the directions DirTate and DirDtou the
+	// characters are rotated, their positions are still on the page.
+	SetDirection(dir int)
+}
+
+// PixelHandler is implemented by handlers that want the positions in
+// pixels at Dvitype.Resolution. They are rounded like DVItype does it: the
+// pixel position advances by the rounded widths of the characters and is
+// kept within two pixels of the exact position.
+type PixelHandler interface {
+	// SetCharPixels is called before each SetChar with the pixel position
+	// of the reference point of the character.
+	SetCharPixels(font, code, hh, vv int)
+	// SetRulePixels is called before each SetRule with the lower left
+	// corner and the size of the rule in pixels.
+	SetRulePixels(hh, vv, height, width int)
+}
+
+// DocumentHandler is implemented by handlers that want the records of
+// Parse while the file is being read: the preamble, every command of the
+// pages with its byte offset and the positions after it, and the
+// postamble. NopHandler does not implement it, since building the
+// commands costs time.
+type DocumentHandler interface {
+	Preamble(p Preamble)
+	// Command is called after each command between bop and eop, the
+	// bop itself is passed to BeginPage.
+	Command(c Command)
+	// Postamble is called when the postamble has been read, which is
+	// before the pages if Dvitype.OutMode is 4.
+	Postamble(p Postamble)
+}
+
+// NopHandler implements Handler, GlyphHandler, DirectionHandler and
+// PixelHandler and does nothing. It can be embedded in handlers that only
+// need some of the callbacks.
+type NopHandler struct{}
+
+func (NopHandler) FontDef(f FontDef)                                         {}
+func (NopHandler) BeginPage(counts [10]int32, pos int64)                     {}
+func (NopHandler) SetChar(font, code, h, v int)                              {}
+func (NopHandler) SetRule(h, v, height, width int)                           {}
+func (NopHandler) Special(data []byte, h, v int)                             {}
+func (NopHandler) Push()                                                     {}
+func (NopHandler) Pop()                                                      {}
+func (NopHandler) EndPage()                                                  {}
+func (NopHandler) SetGlyphs(font int, glyphs []Glyph, text string, h, v int) {}
+func (NopHandler) SetDirection(dir int)                                      {}
+func (NopHandler) SetCharPixels(font, code, hh, vv int)                      {}
+func (NopHandler) SetRulePixels(hh, vv, height, width int)                   {}
+
+// Visit interprets the DVI file from r and calls the methods of h. No
+// listing is printed and the pages are not kept in memory.
+func Visit(r io.ReadSeeker, h Handler) error {
+	d := New(r)
+	d.Output = io.Discard
+	d.Handler = h
+	return d.Run()
+}
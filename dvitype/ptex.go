@@ -0,0 +1,82 @@
+package dvitype
+
+import "fmt"
+
+// Typesetting directions of pTeX, the parameter of the dir command.
+const (
+	DirYoko = 0 // horizontal
+	DirTate = 1 // vertical, lines run from top to bottom
+	DirDtou = 3 // rotated by 90 degrees counter-clockwise
+)
+
+// physical converts the position h, v of the interpreter in direction dir
+// to a position on the page. In vertical mode moving right goes down the
+// page and moving down goes to the left.
+func physical(dir, h, v int) (int, int) {
+	switch dir {
+	case DirTate:
+		return -v, h
+	case DirDtou:
+		return v, -h
+	}
+	return h, v
+}
+
+// logical is the inverse of physical.
+func logical(dir, h, v int) (int, int) {
+	switch dir {
+	case DirTate:
+		return v, -h
+	case DirDtou:
+		return -v, h
+	}
+	return h, v
+}
+
+// physicalRule converts a rule at h, v in direction dir to the lower left
+// corner and the size of the rule on the page.
+func physicalRule(dir, h, v, height, width int) (int, int, int, int) {
+	switch dir {
+	case DirTate:
+		return -v, h + width, width, height
+	case DirDtou:
+		return v - height, -h, width, height
+	}
+	return h, v, height, width
+}
+
+// here returns the current position on the page.
+func (d *Dvitype) here() (int, int) {
+	return physical(d.dir, d.h, d.v)
+}
+
+// setDirection changes the direction to dir. h, v, hh and vv are converted
+// so that the position on the page stays the same.
+func (d *Dvitype) setDirection(dir int) {
+	if dir == d.dir {
+		return
+	}
+	h, v := physical(d.dir, d.h, d.v)
+	d.h, d.v = logical(dir, h, v)
+	h, v = physical(d.dir, d.hh, d.vv)
+	d.hh, d.vv = logical(dir, h, v)
+	d.dir = dir
+	if dh, ok := d.Handler.(DirectionHandler); ok {
+		dh.SetDirection(dir)
+	}
+}
+
+// dirCommand interprets the dir command at byte a with the parameter p.
+func (d *Dvitype) dirCommand(a, p int) {
+	d.major(a, fmt.Sprintf("dir %d", p))
+	switch p {
+	case DirYoko, DirTate, DirDtou:
+	default:
+		d.error(a, fmt.Sprintf("direction %d is undefined!", p))
+		return
+	}
+	d.setDirection(p)
+	if d.showing && d.OutMode > mnemonics_only {
+		fmt.Fprintf(d.Output, " h:=%d, v:=%d", d.h, d.v)
+	}
+}
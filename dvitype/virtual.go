@@ -0,0 +1,388 @@
+package dvitype
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/vf"
+)
+
+// ErrVirtualFontLoop is wrapped by the error that Run returns if a
+// virtual font refers to itself, directly or through other virtual fonts.
+var ErrVirtualFontLoop = errors.New("virtual font loop")
+
+// maxVFDepth limits the nesting of virtual fonts.
+const maxVFDepth = 32
+
+// vfont is a font as seen by the expander.
+type vfont struct {
+	def     FontDef
+	vf      *vf.Font    // nil if the font is not virtual
+	metrics *tfm.Font   // loaded when the font is used in a packet
+	local   map[int]int // local font number of the VF -> expander font number
+}
+
+type fontKey struct {
+	name string
+	size int
+}
+
+// expander is a Handler that replaces the characters of virtual fonts by
+// the contents of their packets before they are passed on to h.
+type expander struct {
+	d     *Dvitype
+	h     Handler
+	fonts map[int]*vfont
+	byKey map[fontKey]int
+	next  int    // next free font number for fonts from VF files
+	stack []int  // fonts whose packets are being expanded
+	pixel [2]int // the pixel position of the next virtual character
+}
+
+// newExpander returns an expander for h, which implements
+// DocumentHandler if h does.
+func newExpander(d *Dvitype, h Handler) Handler {
+	x := &expander{d: d, h: h, fonts: make(map[int]*vfont), byKey: make(map[fontKey]int)}
+	if dh, ok := h.(DocumentHandler); ok {
+		return &documentExpander{x, dh}
+	}
+	return x
+}
+
+// documentExpander passes the records of Parse on to a DocumentHandler.
+type documentExpander struct {
+	*expander
+	dh DocumentHandler
+}
+
+func (x *documentExpander) Preamble(p Preamble)   { x.dh.Preamble(p) }
+func (x *documentExpander) Command(c Command)     { x.dh.Command(c) }
+func (x *documentExpander) Postamble(p Postamble) { x.dh.Postamble(p) }
+
+// fail records the first error, Run returns it.
+func (x *expander) fail(name string, err error) {
+	if x.d.fonterr == nil {
+		x.d.fonterr = &FontError{Name: name, Err: err}
+	}
+}
+
+// load finds out whether the font fd is virtual.
+func (x *expander) load(fd FontDef) *vfont {
+	f := &vfont{def: fd}
+	x.fonts[fd.Num] = f
+	x.byKey[fontKey{fd.Area + fd.Name, fd.ScaledSize}] = fd.Num
+	if fd.Num >= x.next {
+		x.next = fd.Num + 1
+	}
+	// DVItype has reported a bad scale already
+	if fd.Native != nil || tfm.CheckSize(fd.ScaledSize) != nil {
+		return f
+	}
+	name := fd.Name + ".vf"
+	r, err := x.d.openFile(name)
+	if err != nil {
+		return f
+	}
+	defer r.Close()
+	if f.vf, err = vf.Parse(r); err != nil {
+		x.fail(name, err)
+		f.vf = nil
+		return f
+	}
+	f.local = make(map[int]int)
+	return f
+}
+
+func (x *expander) FontDef(fd FontDef) {
+	if f := x.load(fd); f.vf == nil {
+		x.h.FontDef(fd)
+	}
+}
+
+func (x *expander) BeginPage(counts [10]int32, pos int64) { x.h.BeginPage(counts, pos) }
+func (x *expander) SetRule(h, v, height, width int)       { x.h.SetRule(h, v, height, width) }
+func (x *expander) Special(data []byte, h, v int)         { x.h.Special(data, h, v) }
+func (x *expander) Push()                                 { x.h.Push() }
+func (x *expander) Pop()                                  { x.h.Pop() }
+func (x *expander) EndPage()                              { x.h.EndPage() }
+
+func (x *expander) SetGlyphs(font int, glyphs []Glyph, text string, h, v int) {
+	if gh, ok := x.h.(GlyphHandler); ok {
+		gh.SetGlyphs(font, glyphs, text, h, v)
+	}
+}
+
+// SetCharPixels passes the position on or keeps it for the packet of a
+// virtual character.
+func (x *expander) SetCharPixels(font, code, hh, vv int) {
+	if f := x.fonts[font]; f != nil && f.vf != nil {
+		x.pixel = [2]int{hh, vv}
+		return
+	}
+	if ph, ok := x.h.(PixelHandler); ok {
+		ph.SetCharPixels(font, code, hh, vv)
+	}
+}
+
+func (x *expander) SetRulePixels(hh, vv, height, width int) {
+	if ph, ok := x.h.(PixelHandler); ok {
+		ph.SetRulePixels(hh, vv, height, width)
+	}
+}
+
+func (x *expander) SetDirection(dir int) {
+	if dh, ok := x.h.(DirectionHandler); ok {
+		dh.SetDirection(dir)
+	}
+}
+
+// SetChar passes the character on or expands it if the font is virtual.
+func (x *expander) SetChar(font, code, h, v int) {
+	f := x.fonts[font]
+	if f == nil || f.vf == nil {
+		x.h.SetChar(font, code, h, v)
+		return
+	}
+	for _, g := range x.stack {
+		if g == font {
+			x.fail(f.def.Name+".vf", fmt.Errorf("%w: %s refers to itself", ErrVirtualFontLoop, f.def.Name))
+			return
+		}
+	}
+	if len(x.stack) >= maxVFDepth {
+		x.fail(f.def.Name+".vf", fmt.Errorf("%w: virtual fonts nested too deeply", ErrVirtualFontLoop))
+		return
+	}
+	c, ok := f.vf.Chars[code]
+	if !ok {
+		x.d.error(x.d.charloc, fmt.Sprintf("character %d invalid in virtual font %s!", code, f.def.Name))
+		return
+	}
+	x.stack = append(x.stack, font)
+	if err := x.packet(f, c.DVI, h, v); err != nil {
+		x.fail(f.def.Name+".vf", err)
+	}
+	x.stack = x.stack[:len(x.stack)-1]
+}
+
+// localFont returns the expander font number of the local font num of f.
+func (x *expander) localFont(f *vfont, num int) (int, error) {
+	if n, ok := f.local[num]; ok {
+		return n, nil
+	}
+	lf, ok := f.vf.Font(num)
+	if !ok {
+		return 0, fmt.Errorf("%w (font %d is not defined)", vf.ErrBadVF, num)
+	}
+	size := tfm.Scale(lf.Scale, f.def.ScaledSize)
+	if err := tfm.CheckSize(size); err != nil {
+		return 0, fmt.Errorf("%w (font %d: %w)", vf.ErrBadVF, num, err)
+	}
+	n, ok := x.byKey[fontKey{lf.Area + lf.Name, size}]
+	if !ok {
+		n = x.next
+		x.FontDef(FontDef{
+			Num:        n,
+			Checksum:   int(lf.Checksum),
+			ScaledSize: size,
+			DesignSize: int(lf.DesignSize) / 16,
+			Area:       lf.Area,
+			Name:       lf.Name,
+		})
+	}
+	f.local[num] = n
+	return n, nil
+}
+
+// width returns the width of character c of font n in DVI units.
+func (x *expander) width(n, c int) int {
+	f := x.fonts[n]
+	if f.metrics == nil {
+		f.metrics = &tfm.Font{}
+		name := f.def.Name + ".tfm"
+		r, err := x.d.openFile(name)
+		if err != nil {
+			x.fail(name, err)
+			return 0
+		}
+		defer r.Close()
+		if f.metrics, err = tfm.Parse(r); err != nil {
+			f.metrics = &tfm.Font{}
+			x.fail(name, err)
+			return 0
+		}
+	}
+	ch, ok := f.metrics.Char(c)
+	if !ok {
+		return 0
+	}
+	return tfm.Scale(ch.Width, f.def.ScaledSize)
+}
+
+// packet interprets the DVI commands of a character packet of the virtual
+// font f at the position h, v on the page. The packet is typeset in the
+// current direction of the DVI file. Pixel positions in the packet are
+// rounded relative to the pixel position of the virtual character.
+func (x *expander) packet(f *vfont, dvi []byte, h, v int) error {
+	dir := x.d.dir
+	h0, v0, hh0, vv0 := h, v, x.pixel[0], x.pixel[1]
+	ph, _ := x.h.(PixelHandler)
+	h, v = logical(dir, h, v)
+	badVF := func(format string, a ...interface{}) error {
+		return fmt.Errorf("%w (%s)", vf.ErrBadVF, fmt.Sprintf(format, a...))
+	}
+	z := f.def.ScaledSize
+	pos := 0
+	num := func(n int, signed bool) (int, error) {
+		if pos+n > len(dvi) {
+			return 0, badVF("packet ends unexpectedly")
+		}
+		a := 0
+		for i := 0; i < n; i++ {
+			a = a<<8 | int(dvi[pos+i])
+		}
+		if signed && dvi[pos] > 127 {
+			a -= 1 << (8 * uint(n))
+		}
+		pos += n
+		return a, nil
+	}
+	// dimensions in packets are relative to the size of the virtual font
+	dim := func(n int) (int, error) {
+		a, err := num(n, true)
+		return tfm.Scale(tfm.FixWord(a), z), err
+	}
+	var w, xx, y, zz int
+	type frame struct{ h, v, w, x, y, z int }
+	var stack []frame
+	cur := -1
+	if len(f.vf.Fonts) > 0 {
+		n, err := x.localFont(f, f.vf.Fonts[0].Num)
+		if err != nil {
+			return err
+		}
+		cur = n
+	}
+	for pos < len(dvi) {
+		o := int(dvi[pos])
+		pos++
+		var err error
+		var a, b int
+		switch {
+		case o < set1 || o >= set1 && o < set_rule || o >= put1 && o < put_rule:
+			c := o
+			if o >= set1 {
+				n := (o-set1)%5 + 1
+				if o >= put1 {
+					n = o - put1 + 1
+				}
+				if c, err = num(n, n == 4); err != nil {
+					return err
+				}
+			}
+			if cur < 0 {
+				return badVF("character in a packet without fonts")
+			}
+			ch, cv := physical(dir, h, v)
+			x.SetCharPixels(cur, c, hh0+x.d.pixelround(ch-h0), vv0+x.d.pixelround(cv-v0))
+			x.SetChar(cur, c, ch, cv)
+			if o < put1 {
+				h += x.width(cur, c)
+			}
+		case o == set_rule || o == put_rule:
+			if a, err = dim(4); err != nil {
+				return err
+			}
+			if b, err = dim(4); err != nil {
+				return err
+			}
+			if a > 0 && b > 0 {
+				rh, rv, height, width := physicalRule(dir, h, v, a, b)
+				if ph != nil {
+					ph.SetRulePixels(hh0+x.d.pixelround(rh-h0), vv0+x.d.pixelround(rv-v0), x.d.rulepixels(height), x.d.rulepixels(width))
+				}
+				x.h.SetRule(rh, rv, height, width)
+			}
+			if o == set_rule {
+				h += b
+			}
+		case o == nop:
+		case o == push:
+			stack = append(stack, frame{h, v, w, xx, y, zz})
+			x.h.Push()
+		case o == pop:
+			if len(stack) == 0 {
+				return badVF("pop without push in a packet")
+			}
+			fr := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			h, v, w, xx, y, zz = fr.h, fr.v, fr.w, fr.x, fr.y, fr.z
+			x.h.Pop()
+		case o >= right1 && o < w0:
+			if a, err = dim(o - right1 + 1); err != nil {
+				return err
+			}
+			h += a
+		case o >= w0 && o < x0:
+			if o > w0 {
+				if w, err = dim(o - w0); err != nil {
+					return err
+				}
+			}
+			h += w
+		case o >= x0 && o < down1:
+			if o > x0 {
+				if xx, err = dim(o - x0); err != nil {
+					return err
+				}
+			}
+			h += xx
+		case o >= down1 && o < y0:
+			if a, err = dim(o - down1 + 1); err != nil {
+				return err
+			}
+			v += a
+		case o >= y0 && o < z0:
+			if o > y0 {
+				if y, err = dim(o - y0); err != nil {
+					return err
+				}
+			}
+			v += y
+		case o >= z0 && o < fnt_num_0:
+			if o > z0 {
+				if zz, err = dim(o - z0); err != nil {
+					return err
+				}
+			}
+			v += zz
+		case o >= fnt_num_0 && o < fnt1 || o >= fnt1 && o < xxx1:
+			a = o - fnt_num_0
+			if o >= fnt1 {
+				if a, err = num(o-fnt1+1, o == fnt1+3); err != nil {
+					return err
+				}
+			}
+			if cur, err = x.localFont(f, a); err != nil {
+				return err
+			}
+		case o >= xxx1 && o <= xxx4:
+			if a, err = num(o-xxx1+1, false); err != nil {
+				return err
+			}
+			if a < 0 || pos+a > len(dvi) {
+				return badVF("special in a packet is too long")
+			}
+			sh, sv := physical(dir, h, v)
+			x.h.Special(dvi[pos:pos+a], sh, sv)
+			pos += a
+		default:
+			return badVF("command %d is not allowed in a packet", o)
+		}
+	}
+	if len(stack) > 0 {
+		return badVF("push without pop in a packet")
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package dvitype
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+// Flags of a native font definition.
+const (
+	NativeVertical = 0x0100
+	NativeColored  = 0x0200
+	NativeExtend   = 0x1000
+	NativeSlant    = 0x2000
+	NativeEmbolden = 0x4000
+)
+
+// NativeFont holds the parameters of a native_font_def command of an XDV
+// file that are not part of an ordinary font definition. Native fonts are
+// OpenType or TrueType fonts that XeTeX uses directly, without TFM file.
+type NativeFont struct {
+	Index    int    // index of the font in a font collection
+	Flags    int    // NativeVertical, NativeColored, ...
+	Color    uint32 // RGBA, if Flags has NativeColored
+	Extend   int    // horizontal scale as 16.16 fixed point number, 0x10000 if not set
+	Slant    int    // 16.16 fixed point number
+	Embolden int    // 16.16 fixed point number
+}
+
+// Glyph is a glyph of a set_glyphs or set_text_and_glyphs command.
+type Glyph struct {
+	ID   int // glyph index in the native font
+	X, Y int // offset from the position of the command in DVI units
+}
+
+// defineNativeFont reads the rest of a native_font_def command for the
+// external font number e. Native fonts have no widths, the glyph commands
+// tell how far to move.
+func (d *Dvitype) defineNativeFont(e int) error {
+	var f int
+	if d.nf == max_fonts {
+		return &DVIError{Offset: d.curloc - 1, Opcode: -1, Msg: fmt.Sprintf("DVItype capacity exceeded (max fonts=%d)!", max_fonts), Err: ErrCapacityExceeded}
+	}
+	d.font_num[d.nf] = e
+	for d.font_num[f] != e {
+		f++
+	}
+	q := d.signedquad()
+	nat := &NativeFont{Flags: d.gettwobytes(), Extend: 0x10000}
+	n := d.getbyte()
+	if d.fontname[d.nf]+n > name_size {
+		return &DVIError{Offset: d.curloc - 1, Opcode: -1, Msg: fmt.Sprintf("DVItype capacity exceeded (name size=%d)!", name_size), Err: ErrCapacityExceeded}
+	}
+	d.fontname[d.nf+1] = d.fontname[d.nf] + n
+	for k := d.fontname[d.nf]; k < d.fontname[d.nf+1]; k++ {
+		d.names[k] = uint8(d.getbyte())
+	}
+	nat.Index = d.signedquad()
+	if nat.Flags&NativeColored != 0 {
+		nat.Color = uint32(d.signedquad())
+	}
+	if nat.Flags&NativeExtend != 0 {
+		nat.Extend = d.signedquad()
+	}
+	if nat.Flags&NativeSlant != 0 {
+		nat.Slant = d.signedquad()
+	}
+	if nat.Flags&NativeEmbolden != 0 {
+		nat.Embolden = d.signedquad()
+	}
+
+	if d.showing {
+		fmt.Fprint(d.Output, ": ")
+	} else {
+		fmt.Fprintf(d.Output, "Font %d: ", e)
+	}
+	if n == 0 {
+		fmt.Fprint(d.Output, "null font name!")
+	}
+	d.printFont(d.nf)
+	if nat.Index != 0 {
+		fmt.Fprintf(d.Output, "[%d]", nat.Index)
+	}
+	if nat.Flags&NativeVertical != 0 {
+		fmt.Fprint(d.Output, " vertical")
+	}
+	if nat.Flags&NativeColored != 0 {
+		fmt.Fprintf(d.Output, " color %08X", nat.Color)
+	}
+	if nat.Flags&NativeExtend != 0 {
+		fmt.Fprintf(d.Output, " extend %d", nat.Extend)
+	}
+	if nat.Flags&NativeSlant != 0 {
+		fmt.Fprintf(d.Output, " slant %d", nat.Slant)
+	}
+	if nat.Flags&NativeEmbolden != 0 {
+		fmt.Fprintf(d.Output, " embolden %d", nat.Embolden)
+	}
+	if ((d.OutMode == the_works) && d.in_postamble) || ((d.OutMode < the_works) && !d.in_postamble) {
+		if f < d.nf {
+			d.warn(d.curloc, "---this font was already defined!\n")
+		}
+	} else {
+		if f == d.nf {
+			d.warn(d.curloc, "---this font wasn't loaded before!\n")
+		}
+	}
+
+	if f < d.nf {
+		if d.fontscaledsize[f] != q {
+			d.warn(d.curloc, "--- scaled size doesn't match previous definition!\n")
+		}
+		if d.fontName(f) != d.fontName(d.nf) {
+			d.warn(d.curloc, "---font name doesn't match previous definition!\n")
+		}
+		return nil
+	}
+	d.fontDefined(FontDef{
+		Num:        e,
+		ScaledSize: q,
+		DesignSize: q,
+		Name:       d.fontName(d.nf),
+		Native:     nat,
+	})
+	if q <= 0 || q >= 01000000000 {
+		d.warn(d.curloc, fmt.Sprintf("---not loaded, bad scale (%d)!", q))
+	} else {
+		d.fontchecksum[d.nf] = 0
+		d.fontscaledsize[d.nf] = q
+		d.fontdesignsize[d.nf] = q
+		d.fontspace[d.nf] = q / 6
+		// no characters, only glyphs
+		d.fontbc[d.nf] = 1
+		d.fontec[d.nf] = 0
+		fmt.Fprint(d.Output, "---native font at size ", q, " DVI units")
+		d.nf++
+	}
+	if d.OutMode == errors_only {
+		fmt.Fprintln(d.Output, " ")
+	}
+	return nil
+}
+
+// readGlyphs reads the parameters of a set_glyphs or set_text_and_glyphs
+// command into glyphs and text and returns the width of the glyph run.
+func (d *Dvitype) readGlyphs(o eightbits) int {
+	d.text = ""
+	if o == set_text_and_glyphs {
+		u := make([]uint16, d.gettwobytes())
+		for i := range u {
+			u[i] = uint16(d.gettwobytes())
+		}
+		d.text = string(utf16.Decode(u))
+	}
+	w := d.signedquad()
+	d.glyphs = make([]Glyph, d.gettwobytes())
+	for i := range d.glyphs {
+		d.glyphs[i].X = d.signedquad()
+		d.glyphs[i].Y = d.signedquad()
+	}
+	for i := range d.glyphs {
+		d.glyphs[i].ID = d.gettwobytes()
+	}
+	return w
+}
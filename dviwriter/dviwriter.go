@@ -0,0 +1,546 @@
+// Package dviwriter writes DVI files.
+//
+// The movements are encoded the way TeX does it (section 607ff of TeX: The
+// Program): a movement by an amount that has been used before is turned
+// into w0, x0, y0 or z0 and the earlier command is changed to set the
+// register. Therefore a page is kept in memory until EndPage.
+package dviwriter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUsage is wrapped by the errors caused by calling the methods in the
+// wrong order, for example SetChar outside of a page.
+var ErrUsage = errors.New("dviwriter: invalid call")
+
+const (
+	set1     = 128
+	setRule  = 132
+	put1     = 133
+	putRule  = 137
+	bop      = 139
+	eop      = 140
+	push     = 141
+	pop      = 142
+	right1   = 143
+	w0       = 147
+	w1       = 148
+	x0       = 152
+	x1       = 153
+	down1    = 157
+	y0       = 161
+	y1       = 162
+	z0       = 166
+	z1       = 167
+	fntNum0  = 171
+	fnt1     = 235
+	xxx1     = 239
+	xxx4     = 242
+	fntDef1  = 243
+	pre      = 247
+	post     = 248
+	postPost = 249
+	idByte   = 2
+)
+
+// FontDef is a font definition.
+type FontDef struct {
+	Num        int // external font number
+	Checksum   uint32
+	ScaledSize int // in DVI units
+	DesignSize int // in DVI units
+	Area       string
+	Name       string
+}
+
+// Writer writes a DVI file. The fields must be set before the first page.
+type Writer struct {
+	Num, Den int    // unit of measurement, the default is sp
+	Mag      int    // magnification times 1000
+	Comment  string // at most 255 bytes
+	// MaxH and MaxV are the width of the widest page and the height plus
+	// depth of the tallest page. If they are smaller than the largest h
+	// and v seen on the pages, these are written to the postamble.
+	MaxH, MaxV int
+
+	w       io.Writer
+	err     error
+	off     int64 // bytes written to w
+	started bool  // has the preamble been written?
+
+	fonts   []FontDef
+	written map[int]bool // fonts whose definition is in the file
+
+	page     []byte // the current page, nil outside of pages
+	pages    int
+	lastBop  int64
+	font     int // current font, -1 if none
+	h, v     int
+	stack    []level
+	maxStack int
+
+	rights, downs []movement
+}
+
+type level struct {
+	h, v int
+	loc  int // position of the push in page
+}
+
+// movement is a right or down command of the current page, see section
+// 608 of TeX: The Program.
+type movement struct {
+	width int
+	loc   int // position in page
+	info  int
+}
+
+// values of movement.info
+const (
+	yHere  = 1 // the command sets y or w
+	zHere  = 2 // the command sets z or x
+	yzOK   = 3 // may be changed to y or z
+	yOK    = 4 // may be changed to y
+	zOK    = 5 // may be changed to z
+	dFixed = 6 // may not be changed
+)
+
+// New returns a Writer that writes to w. The unit is sp (1/65536 pt) and
+// the magnification is 1000.
+func New(w io.Writer) *Writer {
+	return &Writer{
+		Num:     25400000,
+		Den:     473628672,
+		Mag:     1000,
+		w:       w,
+		written: make(map[int]bool),
+		lastBop: -1,
+		font:    -1,
+	}
+}
+
+func (w *Writer) fail(format string, a ...interface{}) {
+	if w.err == nil {
+		w.err = fmt.Errorf("%w: %s", ErrUsage, fmt.Sprintf(format, a...))
+	}
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	var n int
+	n, w.err = w.w.Write(b)
+	w.off += int64(n)
+}
+
+func appendNum(b []byte, x, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(x>>(8*uint(i))))
+	}
+	return b
+}
+
+// size returns the number of bytes of the signed number x.
+func size(x int) int {
+	switch {
+	case x >= -0x80 && x < 0x80:
+		return 1
+	case x >= -0x8000 && x < 0x8000:
+		return 2
+	case x >= -0x800000 && x < 0x800000:
+		return 3
+	}
+	return 4
+}
+
+// usize returns the number of bytes of the unsigned number x.
+func usize(x int) int {
+	switch {
+	case x < 0:
+		return 4
+	case x < 0x100:
+		return 1
+	case x < 0x10000:
+		return 2
+	case x < 0x1000000:
+		return 3
+	}
+	return 4
+}
+
+func (w *Writer) preamble() {
+	if w.started {
+		return
+	}
+	w.started = true
+	if len(w.Comment) > 255 {
+		w.fail("comment is longer than 255 bytes")
+		return
+	}
+	b := []byte{pre, idByte}
+	b = appendNum(b, w.Num, 4)
+	b = appendNum(b, w.Den, 4)
+	b = appendNum(b, w.Mag, 4)
+	b = append(b, byte(len(w.Comment)))
+	w.write(append(b, w.Comment...))
+}
+
+// FontDef defines a font. The definition is written before the font is
+// selected for the first time and in the postamble.
+func (w *Writer) FontDef(fd FontDef) {
+	if len(fd.Area) > 255 || len(fd.Name) > 255 {
+		w.fail("font name of font %d is too long", fd.Num)
+		return
+	}
+	for _, f := range w.fonts {
+		if f.Num == fd.Num {
+			w.fail("font %d is defined twice", fd.Num)
+			return
+		}
+	}
+	w.fonts = append(w.fonts, fd)
+}
+
+func appendFontDef(b []byte, fd FontDef) []byte {
+	n := usize(fd.Num)
+	b = append(b, byte(fntDef1+n-1))
+	b = appendNum(b, fd.Num, n)
+	b = appendNum(b, int(fd.Checksum), 4)
+	b = appendNum(b, fd.ScaledSize, 4)
+	b = appendNum(b, fd.DesignSize, 4)
+	b = append(b, byte(len(fd.Area)), byte(len(fd.Name)))
+	b = append(b, fd.Area...)
+	return append(b, fd.Name...)
+}
+
+// inPage reports whether a page has been started, what is an error for
+// the command cmd otherwise.
+func (w *Writer) inPage(cmd string) bool {
+	if w.page == nil {
+		w.fail("%s outside of a page", cmd)
+		return false
+	}
+	return w.err == nil
+}
+
+// BeginPage starts a new page with the values of \count0 to \count9.
+func (w *Writer) BeginPage(counts [10]int) {
+	if w.page != nil {
+		w.fail("BeginPage inside a page")
+		return
+	}
+	w.preamble()
+	if w.pages == 0xffff {
+		w.fail("too many pages")
+	}
+	if w.err != nil {
+		return
+	}
+	w.page = []byte{bop}
+	for _, c := range counts {
+		w.page = appendNum(w.page, c, 4)
+	}
+	w.page = appendNum(w.page, int(w.lastBop), 4)
+	w.lastBop = w.off
+	w.pages++
+	w.font = -1
+	w.h, w.v = 0, 0
+	w.stack = w.stack[:0]
+	w.rights, w.downs = w.rights[:0], w.downs[:0]
+}
+
+// EndPage writes the page to the file.
+func (w *Writer) EndPage() error {
+	if !w.inPage("EndPage") {
+		return w.err
+	}
+	if len(w.stack) > 0 {
+		w.fail("%d pushes without pop at the end of the page", len(w.stack))
+		return w.err
+	}
+	w.write(append(w.page, eop))
+	w.page = nil
+	return w.err
+}
+
+// SetFont selects the font num for the next characters.
+func (w *Writer) SetFont(num int) {
+	if !w.inPage("SetFont") || num == w.font {
+		return
+	}
+	if !w.written[num] {
+		var fd *FontDef
+		for i := range w.fonts {
+			if w.fonts[i].Num == num {
+				fd = &w.fonts[i]
+			}
+		}
+		if fd == nil {
+			w.fail("font %d is not defined", num)
+			return
+		}
+		w.page = appendFontDef(w.page, *fd)
+		w.written[num] = true
+	}
+	if num >= 0 && num < 64 {
+		w.page = append(w.page, byte(fntNum0+num))
+	} else {
+		n := usize(num)
+		w.page = append(w.page, byte(fnt1+n-1))
+		w.page = appendNum(w.page, num, n)
+	}
+	w.font = num
+}
+
+func (w *Writer) char(o, c int) {
+	if w.font < 0 {
+		w.fail("character %d without a font", c)
+		return
+	}
+	if o == set1 && c >= 0 && c < 128 {
+		w.page = append(w.page, byte(c))
+		return
+	}
+	n := usize(c)
+	w.page = append(w.page, byte(o+n-1))
+	w.page = appendNum(w.page, c, n)
+}
+
+// SetChar typesets the character c of the current font and moves right by
+// its width. The width is only needed for the maximum page width in the
+// postamble, DVI readers take it from the font metrics.
+func (w *Writer) SetChar(c, width int) {
+	if w.inPage("SetChar") {
+		w.char(set1, c)
+		w.h += width
+		w.track()
+	}
+}
+
+// PutChar typesets the character c of the current font without moving.
+func (w *Writer) PutChar(c int) {
+	if w.inPage("PutChar") {
+		w.char(put1, c)
+	}
+}
+
+func (w *Writer) rule(o, height, width int) {
+	w.page = append(w.page, byte(o))
+	w.page = appendNum(w.page, height, 4)
+	w.page = appendNum(w.page, width, 4)
+}
+
+// SetRule typesets a rule with its lower left corner at the current
+// position and moves right by its width.
+func (w *Writer) SetRule(height, width int) {
+	if w.inPage("SetRule") {
+		w.rule(setRule, height, width)
+		w.h += width
+		w.track()
+	}
+}
+
+// PutRule typesets a rule without moving.
+func (w *Writer) PutRule(height, width int) {
+	if w.inPage("PutRule") {
+		w.rule(putRule, height, width)
+	}
+}
+
+// Special writes an xxx command.
+func (w *Writer) Special(data []byte) {
+	if !w.inPage("Special") {
+		return
+	}
+	n := usize(len(data))
+	w.page = append(w.page, byte(xxx1+n-1))
+	w.page = appendNum(w.page, len(data), n)
+	w.page = append(w.page, data...)
+}
+
+// Push saves the current position.
+func (w *Writer) Push() {
+	if !w.inPage("Push") {
+		return
+	}
+	w.stack = append(w.stack, level{w.h, w.v, len(w.page)})
+	if len(w.stack) > w.maxStack {
+		w.maxStack = len(w.stack)
+	}
+	w.page = append(w.page, push)
+}
+
+// Pop restores the position saved by the last Push.
+func (w *Writer) Pop() {
+	if !w.inPage("Pop") {
+		return
+	}
+	if len(w.stack) == 0 {
+		w.fail("Pop without Push")
+		return
+	}
+	l := w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+	w.h, w.v = l.h, l.v
+	w.page = append(w.page, pop)
+	// the registers set after the push are lost
+	w.rights = prune(w.rights, l.loc)
+	w.downs = prune(w.downs, l.loc)
+}
+
+// prune removes the movements at or after loc.
+func prune(m []movement, loc int) []movement {
+	for len(m) > 0 && m[len(m)-1].loc >= loc {
+		m = m[:len(m)-1]
+	}
+	return m
+}
+
+// Right moves right by b.
+func (w *Writer) Right(b int) {
+	if w.inPage("Right") && b != 0 {
+		w.rights = w.movement(w.rights, b, right1)
+		w.h += b
+		w.track()
+	}
+}
+
+// Down moves down by a.
+func (w *Writer) Down(a int) {
+	if w.inPage("Down") && a != 0 {
+		w.downs = w.movement(w.downs, a, down1)
+		w.v += a
+		w.track()
+	}
+}
+
+func (w *Writer) track() {
+	if h := abs(w.h); h > w.MaxH {
+		w.MaxH = h
+	}
+	if v := abs(w.v); v > w.MaxV {
+		w.MaxV = v
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// movement writes a right or down command (o is right1 or down1) for the
+// amount b and returns the updated list of movements. This is procedure
+// movement of TeX.
+func (w *Writer) movement(m []movement, b, o int) []movement {
+	const (
+		noneSeen = 0
+		ySeen    = 6
+		zSeen    = 12
+	)
+	q := movement{width: b, loc: len(w.page)}
+	mstate := noneSeen
+	found := -1
+search:
+	for i := len(m) - 1; i >= 0; i-- {
+		p := &m[i]
+		if p.width == b {
+			switch mstate + p.info {
+			case noneSeen + yzOK, noneSeen + yOK, zSeen + yzOK, zSeen + yOK:
+				// change the earlier command to y or w
+				w.page[p.loc] += y1 - down1
+				p.info = yHere
+				found = i
+				break search
+			case noneSeen + zOK, ySeen + yzOK, ySeen + zOK:
+				// change the earlier command to z or x
+				w.page[p.loc] += z1 - down1
+				p.info = zHere
+				found = i
+				break search
+			case noneSeen + yHere, noneSeen + zHere, ySeen + zHere, zSeen + yHere:
+				found = i
+				break search
+			}
+		} else {
+			switch mstate + p.info {
+			case noneSeen + yHere:
+				mstate = ySeen
+			case noneSeen + zHere:
+				mstate = zSeen
+			case ySeen + zHere, zSeen + yHere:
+				break search
+			}
+		}
+	}
+	if found < 0 {
+		q.info = yzOK
+		n := size(b)
+		w.page = append(w.page, byte(o+n-1))
+		w.page = appendNum(w.page, b, n)
+		return append(m, q)
+	}
+	// reuse the register set by m[found]
+	q.info = m[found].info
+	if q.info == yHere {
+		w.page = append(w.page, byte(o+y0-down1))
+		for i := found + 1; i < len(m); i++ {
+			switch m[i].info {
+			case yzOK:
+				m[i].info = zOK
+			case yOK:
+				m[i].info = dFixed
+			}
+		}
+	} else {
+		w.page = append(w.page, byte(o+z0-down1))
+		for i := found + 1; i < len(m); i++ {
+			switch m[i].info {
+			case yzOK:
+				m[i].info = yOK
+			case zOK:
+				m[i].info = dFixed
+			}
+		}
+	}
+	return append(m, q)
+}
+
+// Close writes the postamble. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.page != nil {
+		w.fail("Close inside a page")
+	}
+	w.preamble()
+	if w.err != nil {
+		return w.err
+	}
+	postLoc := w.off
+	b := []byte{post}
+	b = appendNum(b, int(w.lastBop), 4)
+	b = appendNum(b, w.Num, 4)
+	b = appendNum(b, w.Den, 4)
+	b = appendNum(b, w.Mag, 4)
+	b = appendNum(b, w.MaxV, 4)
+	b = appendNum(b, w.MaxH, 4)
+	b = appendNum(b, w.maxStack, 2)
+	b = appendNum(b, w.pages, 2)
+	for _, fd := range w.fonts {
+		if w.written[fd.Num] {
+			b = appendFontDef(b, fd)
+		}
+	}
+	b = append(b, postPost)
+	b = appendNum(b, int(postLoc), 4)
+	b = append(b, idByte, 223, 223, 223, 223)
+	for (w.off+int64(len(b)))%4 != 0 {
+		b = append(b, 223)
+	}
+	w.write(b)
+	return w.err
+}
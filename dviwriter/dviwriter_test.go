@@ -0,0 +1,170 @@
+package dviwriter
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/simplefilefinder"
+	"github.com/speedata/gotex/tfm"
+)
+
+func testTFM(t *testing.T) []byte {
+	f := &tfm.Font{
+		Checksum:   0x12345678,
+		DesignSize: 10 << 20,
+		BC:         'A',
+		EC:         'B',
+		CharInfo:   []tfm.CharInfo{{WidthIndex: 1}, {WidthIndex: 1}},
+		Width:      []tfm.FixWord{0, 1 << 19},
+		Height:     []tfm.FixWord{0},
+		Depth:      []tfm.FixWord{0},
+		Italic:     []tfm.FixWord{0},
+	}
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func testDVI(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := New(&buf)
+	w.Comment = " dviwriter"
+	w.FontDef(FontDef{Num: 0, Checksum: 0x12345678, ScaledSize: 655360, DesignSize: 655360, Name: "test"})
+	w.FontDef(FontDef{Num: 300, Checksum: 0x12345678, ScaledSize: 1310720, DesignSize: 655360, Name: "test"})
+	w.FontDef(FontDef{Num: 1, Name: "unused"})
+
+	w.BeginPage([10]int{1})
+	w.Down(1000)
+	w.SetFont(0)
+	w.SetChar('A', 327680)
+	w.Right(100)
+	w.SetChar('B', 327680)
+	w.Right(100)
+	w.Push()
+	w.Down(1000)
+	w.Right(100)
+	w.SetRule(10, 20)
+	w.Special([]byte("hi"))
+	w.Pop()
+	w.Right(200)
+	w.Right(200)
+	if err := w.EndPage(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.BeginPage([10]int{2, 5})
+	w.SetFont(300)
+	w.PutChar('A')
+	w.Down(-70000)
+	w.PutRule(5, 5)
+	if err := w.EndPage(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := testDVI(t)
+	if len(data)%4 != 0 {
+		t.Errorf("file length %d is not a multiple of 4", len(data))
+	}
+	doc, err := dvitype.Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Preamble.Comment != " dviwriter" || doc.Postamble.TotalPages != 2 || doc.Postamble.MaxStackDepth != 1 || doc.Postamble.MaxV != 70000 {
+		t.Errorf("unexpected preamble %+v or postamble %+v", doc.Preamble, doc.Postamble)
+	}
+	if len(doc.Fonts) != 2 || doc.Fonts[1].Num != 300 || doc.Fonts[1].ScaledSize != 1310720 {
+		t.Errorf("unexpected fonts %+v", doc.Fonts)
+	}
+	exp := []string{
+		"y2 fntdef1 fntnum0 setchar65 w1 setchar66 w0 push y0 w0 setrule xxx1 pop w2 w0 eop",
+		"fntdef2 fnt2 put1 down3 putrule eop",
+	}
+	for i, pg := range doc.Pages {
+		var names []string
+		for _, c := range pg.Commands {
+			names = append(names, c.Name)
+		}
+		if res := strings.Join(names, " "); res != exp[i] {
+			t.Errorf("page %d: Should be %q, but is %q", i+1, exp[i], res)
+		}
+	}
+	if c := doc.Pages[0].Commands[8]; c.V != 2000 {
+		t.Errorf("y0: want v=2000, got %+v", c)
+	}
+	if c := doc.Pages[0].Commands[14]; c.P != 200 || c.V != 1000 {
+		t.Errorf("last w0: want 200 at v=1000, got %+v", c)
+	}
+	if pg := doc.Pages[1]; pg.Counts[1] != 5 || pg.Commands[3].P != -70000 {
+		t.Errorf("unexpected second page %+v", pg)
+	}
+
+	// dvitype must not find anything to complain about
+	for _, mode := range []int{1, 4} {
+		var log bytes.Buffer
+		d := dvitype.New(bytes.NewReader(data))
+		d.OutMode = mode
+		d.Output = &bytes.Buffer{}
+		d.Log = &log
+		d.Finder = simplefilefinder.Map{"test.tfm": testTFM(t)}
+		if err = d.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if log.Len() > 0 {
+			t.Errorf("output level %d: unexpected warnings\n%s", mode, log.String())
+		}
+	}
+}
+
+func TestMovement(t *testing.T) {
+	// the third 3 can't use y or z, both hold values that are needed later
+	var buf bytes.Buffer
+	w := New(&buf)
+	w.BeginPage([10]int{})
+	for _, a := range []int{1, 2, 3, 1, 2, 3, 2, 1} {
+		w.Down(a)
+	}
+	w.EndPage()
+	w.Close()
+	doc, err := dvitype.Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range doc.Pages[0].Commands {
+		names = append(names, c.Name)
+	}
+	if res, exp := strings.Join(names, " "), "y1 z1 down1 y0 z0 down1 z0 y0 eop"; res != exp {
+		t.Errorf("Should be %q, but is %q", exp, res)
+	}
+	if c := doc.Pages[0].Commands[7]; c.V != 15 {
+		t.Errorf("want v=15, got %d", c.V)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for name, f := range map[string]func(w *Writer){
+		"char outside page": func(w *Writer) { w.SetChar('A', 0) },
+		"pop":               func(w *Writer) { w.BeginPage([10]int{}); w.Pop() },
+		"font":              func(w *Writer) { w.BeginPage([10]int{}); w.SetFont(3) },
+		"no font":           func(w *Writer) { w.BeginPage([10]int{}); w.SetChar('A', 0) },
+		"push":              func(w *Writer) { w.BeginPage([10]int{}); w.Push(); w.EndPage() },
+	} {
+		w := New(&bytes.Buffer{})
+		f(w)
+		w.page = nil
+		if err := w.Close(); !errors.Is(err, ErrUsage) {
+			t.Errorf("%s: want ErrUsage, got %v", name, err)
+		}
+	}
+}
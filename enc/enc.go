@@ -0,0 +1,148 @@
+// Package enc reads PostScript encoding vectors (.enc files) such as
+// ec.enc or texnansx.enc, which give the glyph names of the character
+// codes of a font:
+//
+//	% comments
+//	/ECEncoding [ % the name of the vector
+//	/grave /acute /circumflex ...
+//	] def
+//
+// It also maps glyph names to Unicode following the conventions of the
+// Adobe Glyph List.
+package enc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrBadEncoding is wrapped by the errors for files that can't be parsed.
+var ErrBadEncoding = errors.New("bad encoding file")
+
+// Encoding is an encoding vector.
+type Encoding struct {
+	Name   string      // the name of the vector without the slash
+	Glyphs [256]string // the glyph names by code, empty if the vector is shorter
+}
+
+// isDelim reports whether c ends a PostScript name.
+func isDelim(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f()<>[]{}/%", c) >= 0
+}
+
+// tokens returns the names, brackets and other words of r, without the
+// comments. Names keep their slash.
+func tokens(r io.Reader) ([]string, error) {
+	var toks []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		for i := 0; i < len(line); {
+			c := line[i]
+			switch {
+			case c == '%':
+				i = len(line)
+			case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+				i++
+			case c == '[' || c == ']' || c == '{' || c == '}':
+				toks = append(toks, line[i:i+1])
+				i++
+			default:
+				j := i + 1
+				for j < len(line) && !isDelim(line[j]) {
+					j++
+				}
+				toks = append(toks, line[i:j])
+				i = j
+			}
+		}
+	}
+	return toks, sc.Err()
+}
+
+// Parse reads an encoding file. Only the first vector of the file is read,
+// entries after code 255 are an error.
+func Parse(r io.Reader) (*Encoding, error) {
+	toks, err := tokens(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) < 2 || !strings.HasPrefix(toks[0], "/") || toks[1] != "[" {
+		return nil, fmt.Errorf("%w (no encoding vector found)", ErrBadEncoding)
+	}
+	e := &Encoding{Name: toks[0][1:]}
+	code := 0
+	for _, t := range toks[2:] {
+		if t == "]" {
+			return e, nil
+		}
+		if !strings.HasPrefix(t, "/") || len(t) == 1 {
+			return nil, fmt.Errorf("%w (unexpected %q in the vector)", ErrBadEncoding, t)
+		}
+		if code > 255 {
+			return nil, fmt.Errorf("%w (more than 256 entries)", ErrBadEncoding)
+		}
+		e.Glyphs[code] = t[1:]
+		code++
+	}
+	return nil, fmt.Errorf("%w (vector without ])", ErrBadEncoding)
+}
+
+// isHex reports whether s consists of upper case hexadecimal digits.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'A' <= s[i] && s[i] <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// component maps a part of a glyph name, see ToUnicode.
+func component(c string) string {
+	if u, ok := glyphList[c]; ok {
+		return u
+	}
+	var x rune
+	switch {
+	case strings.HasPrefix(c, "uni") && len(c) > 3 && (len(c)-3)%4 == 0 && isHex(c[3:]):
+		var b strings.Builder
+		for i := 3; i < len(c); i += 4 {
+			fmt.Sscanf(c[i:i+4], "%X", &x)
+			if x >= 0xd800 && x <= 0xdfff {
+				return ""
+			}
+			b.WriteRune(x)
+		}
+		return b.String()
+	case strings.HasPrefix(c, "u") && len(c) >= 5 && len(c) <= 7 && isHex(c[1:]):
+		fmt.Sscanf(c[1:], "%X", &x)
+		if x >= 0xd800 && x <= 0xdfff || x > 0x10ffff {
+			return ""
+		}
+		return string(x)
+	}
+	return ""
+}
+
+// ToUnicode returns the characters of a glyph name like the Adobe Glyph
+// List specification describes it: everything after the first period is
+// dropped, the rest is split at underscores and each part is looked up in
+// the glyph list or read as uniXXXX (any number of groups of four
+// hexadecimal digits) or uXXXX to uXXXXXX. Parts that are not understood
+// map to nothing. The glyph list has the names of the Adobe Glyph List
+// that appear in the encodings of TeX fonts, together with a few TeX
+// names such as compwordmark and visiblespace.
+func ToUnicode(glyph string) (string, bool) {
+	if i := strings.IndexByte(glyph, '.'); i >= 0 {
+		glyph = glyph[:i]
+	}
+	var b strings.Builder
+	for _, c := range strings.Split(glyph, "_") {
+		b.WriteString(component(c))
+	}
+	return b.String(), b.Len() > 0
+}
@@ -0,0 +1,68 @@
+package enc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	e, err := Parse(strings.NewReader("% ec.enc\n%% the first line\n/ECEncoding [ % now the glyphs\n/grave/acute /circumflex % 0x02\n\n/.notdef\n/uni0041 ] def\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "ECEncoding" {
+		t.Errorf("unexpected name %q", e.Name)
+	}
+	want := []string{"grave", "acute", "circumflex", ".notdef", "uni0041", ""}
+	for i, g := range want {
+		if e.Glyphs[i] != g {
+			t.Errorf("code %d: got %q, want %q", i, e.Glyphs[i], g)
+		}
+	}
+
+	full := "/Full [" + strings.Repeat("/a ", 256) + "] def"
+	if _, err := Parse(strings.NewReader(full)); err != nil {
+		t.Error(err)
+	}
+	for _, data := range []string{"", "% only comments\n", "[ /a ] def", "/A /a ] def", "/A [ /a 12 ] def", "/A [ /a", "/A [ / ] def", "/Long [" + strings.Repeat("/a ", 257) + "] def"} {
+		if _, err := Parse(strings.NewReader(data)); !errors.Is(err, ErrBadEncoding) {
+			t.Errorf("%.20q: want ErrBadEncoding, got %v", data, err)
+		}
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	for _, tc := range []struct {
+		glyph, want string
+	}{
+		{"A", "A"},
+		{"z", "z"},
+		{"eacute", "é"},
+		{"ffi", "ﬃ"},
+		{"quotedblright", "”"},
+		{"compwordmark", "\u200c"},
+		{"dotlessj", "ȷ"},
+		{"a.sc", "a"},
+		{"f_f_i", "ffi"},
+		{"uni20AC", "€"},
+		{"uni00410042", "AB"},
+		{"u1F600", "😀"},
+		{"u0041.alt", "A"},
+		{"Lcommaaccent_uni20AC0308_u1040C.alternate", "Ļ€\u0308\U0001040C"},
+		{"T_nonsense_x", "Tx"},
+		{"uni20ac", ""},  // lower case hex
+		{"uniD801", ""},  // surrogate
+		{"uni004", ""},   // not four digits
+		{"u110000", ""},  // too large
+		{"u0041000", ""}, // too long
+		{".notdef", ""},
+		{"nonsense", ""},
+		{"", ""},
+	} {
+		got, ok := ToUnicode(tc.glyph)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("%s: got %q %v, want %q", tc.glyph, got, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package enc
+
+// glyphList maps glyph names to Unicode, see ToUnicode.
+var glyphList = map[string]string{
+	// ASCII, the letters are added in init
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$",
+	"percent": "%", "ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")",
+	"asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6",
+	"seven": "7", "eight": "8", "nine": "9", "colon": ":", "semicolon": ";", "less": "<",
+	"equal": "=", "greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_", "grave": "`",
+	"braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~",
+
+	// Latin-1
+	"nbspace": "\u00a0", "exclamdown": "¡", "cent": "¢", "sterling": "£", "currency": "¤",
+	"yen": "¥", "brokenbar": "¦", "section": "§", "dieresis": "¨", "copyright": "©",
+	"ordfeminine": "ª", "guillemotleft": "«", "logicalnot": "¬", "sfthyphen": "\u00ad",
+	"registered": "®", "macron": "¯", "degree": "°", "plusminus": "±", "twosuperior": "²",
+	"threesuperior": "³", "acute": "´", "mu": "µ", "paragraph": "¶", "periodcentered": "·",
+	"cedilla": "¸", "onesuperior": "¹", "ordmasculine": "º", "guillemotright": "»",
+	"onequarter": "¼", "onehalf": "½", "threequarters": "¾", "questiondown": "¿",
+	"Agrave": "À", "Aacute": "Á", "Acircumflex": "Â", "Atilde": "Ã", "Adieresis": "Ä",
+	"Aring": "Å", "AE": "Æ", "Ccedilla": "Ç", "Egrave": "È", "Eacute": "É", "Ecircumflex": "Ê",
+	"Edieresis": "Ë", "Igrave": "Ì", "Iacute": "Í", "Icircumflex": "Î", "Idieresis": "Ï",
+	"Eth": "Ð", "Ntilde": "Ñ", "Ograve": "Ò", "Oacute": "Ó", "Ocircumflex": "Ô", "Otilde": "Õ",
+	"Odieresis": "Ö", "multiply": "×", "Oslash": "Ø", "Ugrave": "Ù", "Uacute": "Ú",
+	"Ucircumflex": "Û", "Udieresis": "Ü", "Yacute": "Ý", "Thorn": "Þ", "germandbls": "ß",
+	"agrave": "à", "aacute": "á", "acircumflex": "â", "atilde": "ã", "adieresis": "ä",
+	"aring": "å", "ae": "æ", "ccedilla": "ç", "egrave": "è", "eacute": "é", "ecircumflex": "ê",
+	"edieresis": "ë", "igrave": "ì", "iacute": "í", "icircumflex": "î", "idieresis": "ï",
+	"eth": "ð", "ntilde": "ñ", "ograve": "ò", "oacute": "ó", "ocircumflex": "ô", "otilde": "õ",
+	"odieresis": "ö", "divide": "÷", "oslash": "ø", "ugrave": "ù", "uacute": "ú",
+	"ucircumflex": "û", "udieresis": "ü", "yacute": "ý", "thorn": "þ", "ydieresis": "ÿ",
+
+	// Latin Extended-A and B
+	"Amacron": "Ā", "amacron": "ā", "Abreve": "Ă", "abreve": "ă", "Aogonek": "Ą", "aogonek": "ą",
+	"Cacute": "Ć", "cacute": "ć", "Ccircumflex": "Ĉ", "ccircumflex": "ĉ", "Cdotaccent": "Ċ",
+	"cdotaccent": "ċ", "Ccaron": "Č", "ccaron": "č", "Dcaron": "Ď", "dcaron": "ď",
+	"Dcroat": "Đ", "dcroat": "đ", "Dslash": "Đ", "dmacron": "đ", "Emacron": "Ē", "emacron": "ē",
+	"Ebreve": "Ĕ", "ebreve": "ĕ", "Edotaccent": "Ė", "edotaccent": "ė", "Eogonek": "Ę",
+	"eogonek": "ę", "Ecaron": "Ě", "ecaron": "ě", "Gcircumflex": "Ĝ", "gcircumflex": "ĝ",
+	"Gbreve": "Ğ", "gbreve": "ğ", "Gdotaccent": "Ġ", "gdotaccent": "ġ", "Gcommaaccent": "Ģ",
+	"gcommaaccent": "ģ", "Hcircumflex": "Ĥ", "hcircumflex": "ĥ", "Hbar": "Ħ", "hbar": "ħ",
+	"Itilde": "Ĩ", "itilde": "ĩ", "Imacron": "Ī", "imacron": "ī", "Ibreve": "Ĭ", "ibreve": "ĭ",
+	"Iogonek": "Į", "iogonek": "į", "Idotaccent": "İ", "Idot": "İ", "dotlessi": "ı",
+	"IJ": "Ĳ", "ij": "ĳ", "Jcircumflex": "Ĵ", "jcircumflex": "ĵ", "Kcommaaccent": "Ķ",
+	"kcommaaccent": "ķ", "kgreenlandic": "ĸ", "Lacute": "Ĺ", "lacute": "ĺ", "Lcommaaccent": "Ļ",
+	"lcommaaccent": "ļ", "Lcaron": "Ľ", "lcaron": "ľ", "Ldot": "Ŀ", "ldot": "ŀ", "Lslash": "Ł",
+	"lslash": "ł", "Nacute": "Ń", "nacute": "ń", "Ncommaaccent": "Ņ", "ncommaaccent": "ņ",
+	"Ncaron": "Ň", "ncaron": "ň", "napostrophe": "ŉ", "Eng": "Ŋ", "eng": "ŋ", "Omacron": "Ō",
+	"omacron": "ō", "Obreve": "Ŏ", "obreve": "ŏ", "Ohungarumlaut": "Ő", "ohungarumlaut": "ő",
+	"OE": "Œ", "oe": "œ", "Racute": "Ŕ", "racute": "ŕ", "Rcommaaccent": "Ŗ", "rcommaaccent": "ŗ",
+	"Rcaron": "Ř", "rcaron": "ř", "Sacute": "Ś", "sacute": "ś", "Scircumflex": "Ŝ",
+	"scircumflex": "ŝ", "Scedilla": "Ş", "scedilla": "ş", "Scaron": "Š", "scaron": "š",
+	"Tcommaaccent": "Ţ", "tcommaaccent": "ţ", "Tcedilla": "Ţ", "tcedilla": "ţ", "Tcaron": "Ť",
+	"tcaron": "ť", "Tbar": "Ŧ", "tbar": "ŧ", "Utilde": "Ũ", "utilde": "ũ", "Umacron": "Ū",
+	"umacron": "ū", "Ubreve": "Ŭ", "ubreve": "ŭ", "Uring": "Ů", "uring": "ů",
+	"Uhungarumlaut": "Ű", "uhungarumlaut": "ű", "Uogonek": "Ų", "uogonek": "ų",
+	"Wcircumflex": "Ŵ", "wcircumflex": "ŵ", "Ycircumflex": "Ŷ", "ycircumflex": "ŷ",
+	"Ydieresis": "Ÿ", "Zacute": "Ź", "zacute": "ź", "Zdotaccent": "Ż", "zdotaccent": "ż",
+	"Zcaron": "Ž", "zcaron": "ž", "longs": "ſ", "florin": "ƒ", "Scommaaccent": "Ș",
+	"scommaaccent": "ș",
+
+	// accents
+	"circumflex": "ˆ", "caron": "ˇ", "breve": "˘", "dotaccent": "˙", "ring": "˚", "ogonek": "˛",
+	"tilde": "˜", "hungarumlaut": "˝",
+
+	// Greek; Delta and Omega are the letters, not the increment and the
+	// ohm sign
+	"Alpha": "Α", "Beta": "Β", "Gamma": "Γ", "Delta": "Δ", "Epsilon": "Ε", "Zeta": "Ζ",
+	"Eta": "Η", "Theta": "Θ", "Iota": "Ι", "Kappa": "Κ", "Lambda": "Λ", "Mu": "Μ", "Nu": "Ν",
+	"Xi": "Ξ", "Omicron": "Ο", "Pi": "Π", "Rho": "Ρ", "Sigma": "Σ", "Tau": "Τ", "Upsilon": "Υ",
+	"Phi": "Φ", "Chi": "Χ", "Psi": "Ψ", "Omega": "Ω", "alpha": "α", "beta": "β", "gamma": "γ",
+	"delta": "δ", "epsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "iota": "ι",
+	"kappa": "κ", "lambda": "λ", "nu": "ν", "xi": "ξ", "omicron": "ο", "pi": "π", "rho": "ρ",
+	"sigma1": "ς", "sigma": "σ", "tau": "τ", "upsilon": "υ", "phi": "φ", "chi": "χ", "psi": "ψ",
+	"omega": "ω", "theta1": "ϑ", "phi1": "ϕ", "omega1": "ϖ",
+
+	// punctuation and symbols
+	"endash": "–", "emdash": "—", "quoteleft": "‘", "quoteright": "’", "quotesinglbase": "‚",
+	"quotedblleft": "“", "quotedblright": "”", "quotedblbase": "„", "dagger": "†",
+	"daggerdbl": "‡", "bullet": "•", "ellipsis": "…", "perthousand": "‰", "guilsinglleft": "‹",
+	"guilsinglright": "›", "fraction": "⁄", "Euro": "€", "trademark": "™", "minus": "−",
+	"arrowleft": "←", "arrowup": "↑", "arrowright": "→", "arrowdown": "↓", "partialdiff": "∂",
+	"product": "∏", "summation": "∑", "radical": "√", "infinity": "∞", "integral": "∫",
+	"approxequal": "≈", "notequal": "≠", "lessequal": "≤", "greaterequal": "≥", "lozenge": "◊",
+	"ff": "ﬀ", "fi": "ﬁ", "fl": "ﬂ", "ffi": "ﬃ", "ffl": "ﬄ",
+
+	// TeX names
+	"compwordmark": "\u200c", "cwm": "\u200c", "visiblespace": "␣", "perthousandzero": "‰",
+	"dotlessj": "ȷ", "Ng": "Ŋ", "ng": "ŋ", "SS": "SS",
+}
+
+func init() {
+	for c := 'A'; c <= 'Z'; c++ {
+		glyphList[string(c)] = string(c)
+		glyphList[string(c+32)] = string(c + 32)
+	}
+}
@@ -0,0 +1,237 @@
+// Package fontmap reads the font map files of dvips and pdfTeX, such as
+// psfonts.map and pdftex.map. A map line tells which PostScript font is
+// used for a TFM file:
+//
+//	ptmr8r Times-Roman 4 "TeXBase1Encoding ReEncodeFont" <8r.enc <utmr8a.pfb
+//
+// The fields are the TFM name, the PostScript name, the font descriptor
+// flags of pdfTeX, PostScript instructions in quotes and the files. A file
+// after < is downloaded (as a subset by pdfTeX), << embeds the whole font
+// and <[ marks an encoding file. A file ending in .enc is an encoding file
+// also after a plain <. Only the TFM name is required.
+//
+// Like with \pdfmapline a line may start with a modifier: + adds the entry
+// unless the TFM name is in the map already, = replaces the entry and -
+// removes it. Lines without a modifier are added like with +.
+package fontmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/speedata/gotex/dvitype"
+)
+
+// ErrBadMapLine is wrapped by the errors for lines that can't be parsed.
+var ErrBadMapLine = errors.New("bad map line")
+
+// Entry is a line of a map file.
+type Entry struct {
+	TFMName  string
+	PSName   string  // the PostScript name of the font, empty if not given
+	Flags    int     // the font descriptor flags for pdfTeX, 0 if not given
+	Special  string  // the PostScript instructions
+	Slant    float64 // the argument of SlantFont, 0 if not given
+	Extend   float64 // the argument of ExtendFont, 1 if not given
+	Encoding string  // the encoding file
+	FontFile string  // the font file, empty if the font is not embedded
+	Full     bool    // the whole font is embedded (<<), not a subset
+}
+
+// Map has the entries of map files by TFM name.
+type Map struct {
+	entries map[string]*Entry
+}
+
+// New returns an empty map.
+func New() *Map {
+	return &Map{entries: make(map[string]*Entry)}
+}
+
+// Lookup returns the entry for the TFM name tfm.
+func (m *Map) Lookup(tfm string) (*Entry, bool) {
+	e, ok := m.entries[tfm]
+	return e, ok
+}
+
+// Len returns the number of entries.
+func (m *Map) Len() int {
+	return len(m.entries)
+}
+
+func isComment(line string) bool {
+	return line == "" || strings.ContainsAny(line[:1], "%#*;")
+}
+
+// AddLine adds, replaces or removes the entry of a map line according to
+// its modifier. Empty lines and comments are ignored.
+func (m *Map) AddLine(line string) error {
+	return m.addLine(strings.TrimSpace(line), '+')
+}
+
+// addLine interprets line with the modifier mode unless the line has a
+// modifier of its own.
+func (m *Map) addLine(line string, mode byte) error {
+	if isComment(line) {
+		return nil
+	}
+	if strings.ContainsAny(line[:1], "+=-") {
+		mode = line[0]
+		line = line[1:]
+	}
+	e, err := ParseLine(line)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case '-':
+		delete(m.entries, e.TFMName)
+	case '=':
+		m.entries[e.TFMName] = e
+	default:
+		if _, ok := m.entries[e.TFMName]; !ok {
+			m.entries[e.TFMName] = e
+		}
+	}
+	return nil
+}
+
+// Read reads the lines of a map file like AddLine.
+func (m *Map) Read(r io.Reader) error {
+	return m.read(r, '+', "")
+}
+
+func (m *Map) read(r io.Reader, mode byte, name string) error {
+	sc := bufio.NewScanner(r)
+	n := 0
+	for sc.Scan() {
+		n++
+		if err := m.addLine(strings.TrimSpace(sc.Text()), mode); err != nil {
+			if name != "" {
+				return fmt.Errorf("%s:%d: %w", name, n, err)
+			}
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return sc.Err()
+}
+
+// ReadFile reads the map file name like \pdfmapfile does. The name may
+// start with a modifier, which applies to all lines without a modifier of
+// their own. The file is opened with f, if f is nil it is opened in the
+// current directory. To search a directory tree like the deprecated
+// simplefilefinder.Locate, pass simplefilefinder.NewDir(basedir).
+func (m *Map) ReadFile(f dvitype.FileFinder, name string) error {
+	mode := byte('+')
+	if name != "" && strings.ContainsAny(name[:1], "+=-") {
+		mode, name = name[0], name[1:]
+	}
+	var r io.ReadCloser
+	var err error
+	if f == nil {
+		r, err = os.Open(name)
+	} else {
+		r, err = f.OpenFile(name)
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return m.read(r, mode, name)
+}
+
+// Parse reads a map file.
+func Parse(r io.Reader) (*Map, error) {
+	m := New()
+	if err := m.Read(r); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// word splits s at the first white space.
+func word(s string) (string, string) {
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+// ParseLine parses a map line without modifier.
+func ParseLine(line string) (*Entry, error) {
+	e := &Entry{Extend: 1}
+	var specials []string
+	for line = strings.TrimSpace(line); line != ""; {
+		switch {
+		case line[0] == '"':
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("%w (unterminated quote)", ErrBadMapLine)
+			}
+			specials = append(specials, strings.TrimSpace(line[1:end+1]))
+			line = strings.TrimSpace(line[end+2:])
+		case line[0] == '<':
+			line = line[1:]
+			full, enc := false, false
+			if strings.HasPrefix(line, "<") {
+				full, line = true, line[1:]
+			} else if strings.HasPrefix(line, "[") {
+				enc, line = true, line[1:]
+			}
+			var name string
+			name, line = word(strings.TrimSpace(line))
+			if name == "" {
+				return nil, fmt.Errorf("%w (file name missing after <)", ErrBadMapLine)
+			}
+			if enc || strings.HasSuffix(name, ".enc") {
+				e.Encoding = name
+			} else {
+				e.FontFile, e.Full = name, full
+			}
+		default:
+			var w string
+			w, line = word(line)
+			if e.TFMName == "" {
+				e.TFMName = w
+			} else if flags, err := strconv.Atoi(w); err == nil {
+				e.Flags = flags
+			} else if e.PSName == "" {
+				e.PSName = w
+			} else {
+				return nil, fmt.Errorf("%w (unexpected %q)", ErrBadMapLine, w)
+			}
+		}
+	}
+	if e.TFMName == "" {
+		return nil, fmt.Errorf("%w (TFM name missing)", ErrBadMapLine)
+	}
+	e.Special = strings.Join(specials, " ")
+	// the instructions are numbers followed by an operator
+	fields := strings.Fields(e.Special)
+	for i, f := range fields {
+		if f != "SlantFont" && f != "ExtendFont" {
+			continue
+		}
+		x := 0.0
+		var err error
+		if i == 0 {
+			err = errors.New("no argument")
+		} else {
+			x, err = strconv.ParseFloat(fields[i-1], 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w (bad %s for %s)", ErrBadMapLine, f, e.TFMName)
+		}
+		if f == "SlantFont" {
+			e.Slant = x
+		} else {
+			e.Extend = x
+		}
+	}
+	return e, nil
+}
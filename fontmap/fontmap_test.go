@@ -0,0 +1,85 @@
+package fontmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+func TestParseLine(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want Entry
+	}{
+		{`ptmr8r Times-Roman "TeXBase1Encoding ReEncodeFont .167 SlantFont" <8r.enc <utmr8a.pfb`,
+			Entry{TFMName: "ptmr8r", PSName: "Times-Roman", Special: "TeXBase1Encoding ReEncodeFont .167 SlantFont", Slant: 0.167, Extend: 1, Encoding: "8r.enc", FontFile: "utmr8a.pfb"}},
+		{`cmr10 CMR10 4 < cmr10.pfb`,
+			Entry{TFMName: "cmr10", PSName: "CMR10", Flags: 4, Extend: 1, FontFile: "cmr10.pfb"}},
+		{`pncr8rn NewCenturySchlbk-Roman "TeXBase1Encoding ReEncodeFont" " .82 ExtendFont " <<uncr8a.pfb <[base1`,
+			Entry{TFMName: "pncr8rn", PSName: "NewCenturySchlbk-Roman", Special: "TeXBase1Encoding ReEncodeFont .82 ExtendFont", Extend: 0.82, Encoding: "base1", FontFile: "uncr8a.pfb", Full: true}},
+		{`psyr Symbol`, Entry{TFMName: "psyr", PSName: "Symbol", Extend: 1}},
+		{`tfmonly <font.pfb`, Entry{TFMName: "tfmonly", Extend: 1, FontFile: "font.pfb"}},
+	} {
+		e, err := ParseLine(tc.line)
+		if err != nil {
+			t.Errorf("%s: %v", tc.line, err)
+			continue
+		}
+		if *e != tc.want {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tc.line, *e, tc.want)
+		}
+	}
+	for _, line := range []string{`x X "unterminated`, `x X <`, `x X Y`, `x "SlantFont"`, `x "a ExtendFont"`, `"Special"`} {
+		if _, err := ParseLine(line); !errors.Is(err, ErrBadMapLine) {
+			t.Errorf("%s: want ErrBadMapLine, got %v", line, err)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	m, err := Parse(strings.NewReader("% comment\n# comment\n\nptmr8r Times-Roman <utmr8a.pfb\nptmr8r Other\n+cmr10 CMR10\n=cmr10 CMR10-New\ncmr12 CMR12\n-cmr12\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := m.Lookup("ptmr8r"); !ok || e.PSName != "Times-Roman" {
+		t.Errorf("the first entry should win, got %+v", e)
+	}
+	if e, ok := m.Lookup("cmr10"); !ok || e.PSName != "CMR10-New" {
+		t.Errorf("= should replace the entry, got %+v", e)
+	}
+	if _, ok := m.Lookup("cmr12"); ok || m.Len() != 2 {
+		t.Errorf("- should remove the entry, %d entries", m.Len())
+	}
+	if err := m.AddLine("=ptmr8r Times"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := m.Lookup("ptmr8r"); e.PSName != "Times" {
+		t.Errorf("AddLine should replace the entry, got %+v", e)
+	}
+
+	f := simplefilefinder.Map{
+		"extra.map": []byte("cmr10 Extra\n+cmr5 CMR5\n-ptmr8r\n"),
+		"bad.map":   []byte("cmr10 CMR10\nx \"oops\n"),
+	}
+	if err := m.ReadFile(f, "=extra.map"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := m.Lookup("cmr10"); e.PSName != "Extra" {
+		t.Errorf("=extra.map should replace cmr10, got %+v", e)
+	}
+	if _, ok := m.Lookup("ptmr8r"); ok {
+		t.Error("-ptmr8r should remove the entry")
+	}
+	if e, ok := m.Lookup("cmr5"); !ok || e.PSName != "CMR5" {
+		t.Errorf("cmr5 missing, got %+v", e)
+	}
+	err = m.ReadFile(f, "bad.map")
+	if !errors.Is(err, ErrBadMapLine) || !strings.HasPrefix(err.Error(), "bad.map:2:") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := m.ReadFile(f, "missing.map"); err == nil {
+		t.Error("want an error for a missing map file")
+	}
+}
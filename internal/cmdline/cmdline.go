@@ -0,0 +1,36 @@
+// Package cmdline has the option handling that the commands of this
+// module share.
+package cmdline
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/speedata/gotex/dvitype"
+	"github.com/speedata/gotex/kpathsea"
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+// Finder returns the finder for the -basedir and -texmf flags: a
+// simplefilefinder.Dir for basedir if the -basedir flag is set or neither
+// texmf nor one of the environment variables TEXMF, TFMFONTS and TEXFONTS
+// is set, else a kpathsea.Resolver from the environment that searches the
+// TEXMF trees in texmf (a path list) if it is not empty. It must be
+// called after flag.Parse.
+func Finder(basedir, texmf string) dvitype.FileFinder {
+	basedirSet := false
+	flag.Visit(func(f *flag.Flag) { basedirSet = basedirSet || f.Name == "basedir" })
+	return finder(basedir, texmf, basedirSet)
+}
+
+func finder(basedir, texmf string, basedirSet bool) dvitype.FileFinder {
+	if basedirSet || texmf == "" && os.Getenv("TEXMF") == "" && os.Getenv("TFMFONTS") == "" && os.Getenv("TEXFONTS") == "" {
+		return simplefilefinder.NewDir(basedir)
+	}
+	r := kpathsea.FromEnv()
+	if texmf != "" {
+		r.Roots = filepath.SplitList(texmf)
+	}
+	return r
+}
@@ -0,0 +1,56 @@
+package cmdline
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/kpathsea"
+	"github.com/speedata/gotex/simplefilefinder"
+)
+
+func TestFinder(t *testing.T) {
+	testdata := []struct {
+		texmf      string
+		basedirSet bool
+		vars       map[string]string
+		roots      []string // nil for a simplefilefinder.Dir
+	}{
+		{"", false, nil, nil},
+		{"", true, map[string]string{"TEXMF": "/tex"}, nil},
+		{"", false, map[string]string{"TEXMF": "{/a,/b}"}, []string{"/a", "/b"}},
+		{"", false, map[string]string{"TFMFONTS": "."}, []string{}},
+		{"/c" + string(filepath.ListSeparator) + "/d", false, map[string]string{"TEXMF": "/tex"}, []string{"/c", "/d"}},
+		{"/c", true, nil, nil},
+	}
+	for i, td := range testdata {
+		for _, v := range []string{"TEXMF", "TFMFONTS", "TEXFONTS"} {
+			t.Setenv(v, td.vars[v])
+		}
+		f := finder("base", td.texmf, td.basedirSet)
+		r, ok := f.(*kpathsea.Resolver)
+		if td.roots == nil {
+			if _, ok := f.(*simplefilefinder.Dir); !ok {
+				t.Errorf("%d: want a simplefilefinder.Dir, got %T", i, f)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%d: want a Resolver, got %T", i, f)
+			continue
+		}
+		if len(r.Roots) != len(td.roots) || len(td.roots) > 0 && !reflect.DeepEqual(r.Roots, td.roots) {
+			t.Errorf("%d: want roots %q, got %q", i, td.roots, r.Roots)
+		}
+	}
+
+	// -texmf wins over TEXMF
+	t.Setenv("TEXMF", "/tex")
+	t.Setenv("TFMFONTS", "")
+	t.Setenv("TEXFONTS", "")
+	r := finder("base", "/c", false).(*kpathsea.Resolver)
+	if res, exp := strings.Join(r.Path(kpathsea.TFM), " "), ". "+filepath.FromSlash("/c/fonts/tfm")+"//"; res != exp {
+		t.Errorf("should be %q, but is %q", exp, res)
+	}
+}
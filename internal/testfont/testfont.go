@@ -0,0 +1,208 @@
+// Package testfont builds the TFM, DVI and Type 1 files for the tests of
+// the packages in this module.
+package testfont
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/dviwriter"
+	"github.com/speedata/gotex/tfm"
+)
+
+// Chars describes a TFM file with a design size of 10pt where the
+// characters BC to EC all have the same dimensions. The dimensions are in
+// units of the design size.
+type Chars struct {
+	BC, EC               int
+	Width, Height, Depth tfm.FixWord
+}
+
+// TFM returns the TFM file for c.
+func TFM(t testing.TB, c Chars) []byte {
+	t.Helper()
+	f := &tfm.Font{
+		DesignSize: 10 << 20,
+		BC:         c.BC,
+		EC:         c.EC,
+		Width:      []tfm.FixWord{0, c.Width},
+		Height:     []tfm.FixWord{0, c.Height},
+		Depth:      []tfm.FixWord{0, c.Depth},
+		Italic:     []tfm.FixWord{0},
+	}
+	for i := c.BC; i <= c.EC; i++ {
+		f.CharInfo = append(f.CharInfo, tfm.CharInfo{WidthIndex: 1, HeightIndex: 1, DepthIndex: 1})
+	}
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// DVI returns the DVI file that write creates.
+func DVI(t testing.TB, write func(w *dviwriter.Writer)) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := dviwriter.New(&b)
+	write(w)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// The keys of the encryption, see package type1.
+const (
+	eexecKey      = 55665
+	charStringKey = 4330
+)
+
+func encrypt(data []byte, key uint16) []byte {
+	out := make([]byte, len(data))
+	r := key
+	for i, p := range data {
+		c := p ^ byte(r>>8)
+		out[i] = c
+		r = (uint16(c)+r)*52845 + 22719
+	}
+	return out
+}
+
+var operators = map[string][]byte{
+	"hstem": {1}, "vstem": {3}, "vmoveto": {4}, "rlineto": {5}, "hlineto": {6},
+	"vlineto": {7}, "rrcurveto": {8}, "closepath": {9}, "callsubr": {10},
+	"return": {11}, "hsbw": {13}, "endchar": {14}, "rmoveto": {21},
+	"hmoveto": {22}, "vhcurveto": {30}, "hvcurveto": {31}, "seac": {12, 6},
+	"div": {12, 12}, "callothersubr": {12, 16}, "pop": {12, 17},
+	"setcurrentpoint": {12, 33},
+}
+
+// CharString encodes a program like "0 500 hsbw endchar" without
+// encrypting it.
+func CharString(t testing.TB, prog string) []byte {
+	t.Helper()
+	var b []byte
+	for _, f := range strings.Fields(prog) {
+		if op, ok := operators[f]; ok {
+			b = append(b, op...)
+			continue
+		}
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			t.Fatalf("bad charstring token %q", f)
+		}
+		switch {
+		case v >= -107 && v <= 107:
+			b = append(b, byte(v+139))
+		case v >= 108 && v <= 1131:
+			b = append(b, byte(247+(v-108)/256), byte((v-108)%256))
+		case v <= -108 && v >= -1131:
+			b = append(b, byte(251+(-v-108)/256), byte((-v-108)%256))
+		default:
+			b = append(b, 255, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	return b
+}
+
+// Glyph is a charstring program of a Type 1 font.
+type Glyph struct {
+	Name, Prog string
+}
+
+// Type1 describes a Type 1 font named Test with the FontBBox
+// {0 -200 800 700} and the ItalicAngle -9.5.
+type Type1 struct {
+	FontMatrix string         // default "0.001 0 0 0.001 0 0"
+	Encoding   map[int]string // the glyph names by code, the other codes are .notdef
+	Subrs      []string
+	Glyphs     []Glyph
+	// the names of the procedures that read a charstring, end a glyph
+	// and end a subroutine; default RD, ND and NP
+	RD, ND, NP string
+}
+
+// Parts returns the clear text and the decrypted eexec part of the
+// font.
+func (f *Type1) Parts(t testing.TB) ([]byte, []byte) {
+	t.Helper()
+	matrix, rd, nd, np := f.FontMatrix, f.RD, f.ND, f.NP
+	if matrix == "" {
+		matrix = "0.001 0 0 0.001 0 0"
+	}
+	if rd == "" {
+		rd, nd, np = "RD", "ND", "NP"
+	}
+	var c bytes.Buffer
+	fmt.Fprintf(&c, "%%!PS-AdobeFont-1.0: Test 001\n12 dict begin\n/FontName /Test def\n/FontType 1 def\n"+
+		"/FontMatrix [%s] readonly def\n/FontBBox {0 -200 800 700} readonly def\n"+
+		"/ItalicAngle -9.5 def\n/Encoding 256 array\n0 1 255 {1 index exch /.notdef put} for\n", matrix)
+	var codes []int
+	for code := range f.Encoding {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&c, "dup %d /%s put\n", code, f.Encoding[code])
+	}
+	c.WriteString("readonly def\ncurrentdict end\ncurrentfile eexec\n")
+
+	var p bytes.Buffer
+	fmt.Fprintf(&p, "\x00\x00\x00\x00dup /Private 8 dict dup begin\n/%s{string currentfile exch readstring pop}executeonly def\n"+
+		"/%s{noaccess def}executeonly def\n/%s{noaccess put}executeonly def\n/lenIV 4 def\n", rd, nd, np)
+	fmt.Fprintf(&p, "/Subrs %d array\n", len(f.Subrs))
+	for i, s := range f.Subrs {
+		cs := encrypt(append([]byte{1, 2, 3, 4}, CharString(t, s)...), charStringKey)
+		fmt.Fprintf(&p, "dup %d %d %s ", i, len(cs), rd)
+		p.Write(cs)
+		fmt.Fprintf(&p, " %s\n", np)
+	}
+	fmt.Fprintf(&p, "%s\n2 index /CharStrings %d dict dup begin\n", nd, len(f.Glyphs))
+	for _, g := range f.Glyphs {
+		cs := encrypt(append([]byte{1, 2, 3, 4}, CharString(t, g.Prog)...), charStringKey)
+		fmt.Fprintf(&p, "/%s %d %s ", g.Name, len(cs), rd)
+		p.Write(cs)
+		fmt.Fprintf(&p, " %s\n", nd)
+	}
+	p.WriteString("end\nend\nreadonly put\nnoaccess put\ndup/FontName get exch definefont pop\nmark currentfile closefile\n")
+	return c.Bytes(), p.Bytes()
+}
+
+// PFB returns the font in PFB format.
+func (f *Type1) PFB(t testing.TB) []byte {
+	t.Helper()
+	return PFB(f.Parts(t))
+}
+
+// PFA returns the font in PFA format.
+func (f *Type1) PFA(t testing.TB) []byte {
+	t.Helper()
+	return PFA(f.Parts(t))
+}
+
+const trailer = "0000000000000000000000000000000000000000000000000000000000000000\ncleartomark\n"
+
+// PFB returns a PFB file of the clear text and the decrypted eexec part
+// of a font.
+func PFB(clear, private []byte) []byte {
+	var b bytes.Buffer
+	for i, seg := range [][]byte{clear, encrypt(private, eexecKey), []byte(trailer)} {
+		n := len(seg)
+		b.Write([]byte{0x80, byte(i%2 + 1), byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)})
+		b.Write(seg)
+	}
+	b.Write([]byte{0x80, 3})
+	return b.Bytes()
+}
+
+// PFA returns a PFA file of the clear text and the decrypted eexec part
+// of a font.
+func PFA(clear, private []byte) []byte {
+	return []byte(string(clear) + hex.EncodeToString(encrypt(private, eexecKey)) + "\n" + trailer)
+}
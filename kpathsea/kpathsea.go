@@ -0,0 +1,455 @@
+// Package kpathsea finds TeX font files like the kpathsea library does.
+//
+// Files are searched along a path that is taken from an environment
+// variable such as TFMFONTS or TEXFONTS or from the default path of the
+// file type, which looks into the fonts directory of each TEXMF tree. A
+// path consists of elements separated by the path list separator (: on
+// Unix). An empty element is replaced by the default path. Elements may
+// contain
+//
+//	$VAR or ${VAR}   the value of the environment variable VAR
+//	{a,b}            the element with a and with b
+//	dir//            dir and all of its subdirectories
+//	!!dir            dir, but only in the ls-R database
+//
+// If a TEXMF tree contains an ls-R file, it is used instead of scanning
+// the disk. Files that are not in the database are still searched on
+// disk unless the element starts with !!.
+package kpathsea
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is wrapped by the errors that are returned if a file can't
+// be found.
+var ErrNotFound = errors.New("file not found")
+
+// FileType is the kind of file to search. It determines the path
+// variables, the default path and the suffix.
+type FileType int
+
+const (
+	TFM   FileType = iota // TeX font metrics (.tfm)
+	VF                    // virtual fonts (.vf)
+	PK                    // packed bitmap fonts (.600pk)
+	Type1                 // Type 1 fonts (.pfb or .pfa)
+	Enc                   // encoding vectors (.enc)
+	Map                   // font map files (.map)
+)
+
+type typeInfo struct {
+	name     string
+	vars     []string // environment variables in priority order
+	dir      string   // below the TEXMF trees
+	suffixes []string
+}
+
+var types = []typeInfo{
+	TFM:   {"tfm", []string{"TFMFONTS", "TEXFONTS"}, "fonts/tfm//", []string{".tfm"}},
+	VF:    {"vf", []string{"VFFONTS", "TEXFONTS"}, "fonts/vf//", []string{".vf"}},
+	PK:    {"pk", []string{"PKFONTS", "TEXPKS", "GLYPHFONTS", "TEXFONTS"}, "fonts/pk//", nil},
+	Type1: {"type1 fonts", []string{"T1FONTS", "T1INPUTS", "TEXFONTS", "TEXPSHEADERS"}, "fonts/type1//", []string{".pfb", ".pfa"}},
+	Enc:   {"enc files", []string{"ENCFONTS", "TEXFONTS", "TEXPSHEADERS"}, "fonts/enc//", []string{".enc"}},
+	Map:   {"map", []string{"TEXFONTMAPS", "TEXFONTS", "TEXPSHEADERS"}, "fonts/map//", []string{".map"}},
+}
+
+func (t FileType) String() string {
+	if t < 0 || int(t) >= len(types) {
+		return fmt.Sprintf("FileType(%d)", int(t))
+	}
+	return types[t].name
+}
+
+var pkSuffix = regexp.MustCompile(`\.[0-9]+pk$`)
+
+// TypeOf returns the file type of name from its suffix.
+func TypeOf(name string) (FileType, bool) {
+	if pkSuffix.MatchString(name) {
+		return PK, true
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for t, ti := range types {
+		for _, s := range ti.suffixes {
+			if s == ext {
+				return FileType(t), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Resolver searches files. The zero value searches the current directory
+// only. A Resolver is safe for concurrent use, the ls-R databases and
+// directory trees are read only once.
+type Resolver struct {
+	// Roots are the TEXMF trees in priority order. If there are any,
+	// they are the value of $TEXMF, even if the environment defines it.
+	Roots []string
+	// Getenv returns the value of an environment variable, os.Getenv if
+	// nil.
+	Getenv func(string) string
+
+	mu    sync.Mutex
+	dbs   map[string]*database // by root, nil if the root has no ls-R
+	trees map[string][]string  // all directories below a directory
+	found map[string]string    // cache for Find
+}
+
+// New returns a Resolver for the TEXMF trees in roots.
+func New(roots ...string) *Resolver {
+	return &Resolver{Roots: roots}
+}
+
+// FromEnv returns a Resolver for the TEXMF trees in the environment
+// variable TEXMF (a path list, braces are expanded).
+func FromEnv() *Resolver {
+	r := &Resolver{}
+	if texmf := os.Getenv("TEXMF"); texmf != "" {
+		for _, elt := range splitPath(texmf) {
+			if elt != "" {
+				r.Roots = append(r.Roots, expandBraces(elt)...)
+			}
+		}
+	}
+	return r
+}
+
+func (r *Resolver) getenv(name string) string {
+	if r.Getenv != nil {
+		return r.Getenv(name)
+	}
+	return os.Getenv(name)
+}
+
+// OpenFile opens the file name, the file type is derived from the suffix.
+func (r *Resolver) OpenFile(name string) (io.ReadCloser, error) {
+	t, ok := TypeOf(name)
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown file type: %w", name, ErrNotFound)
+	}
+	path, err := r.Find(name, t)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Find returns the path of the file name of type t. The suffix of the
+// file type is added if name does not have it.
+func (r *Resolver) Find(name string, t FileType) (string, error) {
+	if t < 0 || int(t) >= len(types) {
+		return "", fmt.Errorf("kpathsea: unknown file type %d", int(t))
+	}
+	key := fmt.Sprintf("%d:%s", t, name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.found[key]; ok {
+		return p, nil
+	}
+	names := []string{name}
+	if _, ok := TypeOf(name); !ok && len(types[t].suffixes) > 0 {
+		names = nil
+		for _, s := range types[t].suffixes {
+			names = append(names, name+s)
+		}
+	}
+	p := r.find(names, t)
+	if p == "" {
+		return "", fmt.Errorf("%s (%s): %w", name, t, ErrNotFound)
+	}
+	if r.found == nil {
+		r.found = make(map[string]string)
+	}
+	r.found[key] = p
+	return p, nil
+}
+
+func (r *Resolver) find(names []string, t FileType) string {
+	// explicit paths are not searched along the path
+	if strings.ContainsRune(names[0], filepath.Separator) || strings.ContainsRune(names[0], '/') {
+		for _, n := range names {
+			if isFile(n) {
+				return n
+			}
+		}
+		return ""
+	}
+	for _, elt := range r.path(t) {
+		for _, n := range names {
+			if p := r.lookup(elt, n); p != "" {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// element is a path element after the expansion of variables and
+// braces.
+type element struct {
+	dir       string
+	recursive bool
+	sub       string // for dir//sub, the subdirectory to look for
+	dbOnly    bool
+}
+
+// Path returns the expanded search path for the file type t.
+func (r *Resolver) Path(t FileType) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []string
+	for _, elt := range r.path(t) {
+		s := elt.dir
+		if elt.recursive {
+			s += "//" + elt.sub
+		}
+		if elt.dbOnly {
+			s = "!!" + s
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func (r *Resolver) path(t FileType) []element {
+	ti := types[t]
+	def := "."
+	if len(r.Roots) > 0 || r.getenv("TEXMF") != "" {
+		def += string(os.PathListSeparator) + "{$TEXMF}/" + ti.dir
+	}
+	pathstr := def
+	for _, v := range ti.vars {
+		if val := r.getenv(v); val != "" {
+			pathstr = val
+			break
+		}
+	}
+	var elts []element
+	for _, s := range splitPath(pathstr) {
+		if s == "" {
+			s = def
+		}
+		for _, s := range splitPath(r.expandVars(s)) {
+			for _, s := range expandBraces(s) {
+				if s != "" {
+					elts = append(elts, parseElement(s))
+				}
+			}
+		}
+	}
+	return elts
+}
+
+func splitPath(s string) []string {
+	return strings.Split(s, string(os.PathListSeparator))
+}
+
+var varRe = regexp.MustCompile(`\$(\{[A-Za-z_][A-Za-z0-9_]*\}|[A-Za-z_][A-Za-z0-9_]*)`)
+
+// expandVars replaces $VAR and ${VAR}. TEXMF is the list of roots unless
+// there are none.
+func (r *Resolver) expandVars(s string) string {
+	return varRe.ReplaceAllStringFunc(s, func(v string) string {
+		name := strings.Trim(v[1:], "{}")
+		if name == "TEXMF" && len(r.Roots) > 0 {
+			return "{" + strings.Join(r.Roots, ",") + "}"
+		}
+		if val := r.getenv(name); val != "" {
+			// a path list in a variable becomes a list of alternatives
+			if sep := string(os.PathListSeparator); strings.Contains(val, sep) {
+				return "{" + strings.ReplaceAll(val, sep, ",") + "}"
+			}
+			return val
+		}
+		return ""
+	})
+}
+
+// expandBraces returns the strings described by s with {a,b} alternatives.
+func expandBraces(s string) []string {
+	start := strings.IndexByte(s, '{')
+	if start < 0 {
+		return []string{s}
+	}
+	level := 0
+	var alternatives []string
+	last := start + 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			level++
+		case ',':
+			if level == 1 {
+				alternatives = append(alternatives, s[last:i])
+				last = i + 1
+			}
+		case '}':
+			level--
+			if level == 0 {
+				alternatives = append(alternatives, s[last:i])
+				var res []string
+				for _, a := range alternatives {
+					res = append(res, expandBraces(s[:start]+a+s[i+1:])...)
+				}
+				return res
+			}
+		}
+	}
+	// unbalanced braces are taken literally
+	return []string{s}
+}
+
+func parseElement(s string) element {
+	var elt element
+	if strings.HasPrefix(s, "!!") {
+		elt.dbOnly = true
+		s = s[2:]
+	}
+	if i := strings.Index(s, "//"); i >= 0 {
+		elt.recursive = true
+		elt.sub = strings.Trim(s[i+2:], "/")
+		s = s[:i]
+	}
+	if s == "" {
+		s = "/"
+	}
+	elt.dir = filepath.Clean(s)
+	return elt
+}
+
+// matches reports whether the files in dir are found by elt.
+func (elt element) matches(dir string) bool {
+	if !elt.recursive {
+		return dir == elt.dir
+	}
+	if dir != elt.dir && !strings.HasPrefix(dir, strings.TrimSuffix(elt.dir, string(filepath.Separator))+string(filepath.Separator)) {
+		return false
+	}
+	if elt.sub == "" {
+		return true
+	}
+	sub := filepath.FromSlash(elt.sub)
+	return dir == filepath.Join(elt.dir, sub) || strings.HasSuffix(dir, string(filepath.Separator)+sub)
+}
+
+// lookup searches for name in the directories of elt.
+func (r *Resolver) lookup(elt element, name string) string {
+	if db := r.database(elt.dir); db != nil {
+		for _, dir := range db.files[name] {
+			if elt.matches(dir) {
+				return filepath.Join(dir, name)
+			}
+		}
+	}
+	if elt.dbOnly {
+		return ""
+	}
+	if !elt.recursive {
+		if p := filepath.Join(elt.dir, name); isFile(p) {
+			return p
+		}
+		return ""
+	}
+	for _, dir := range r.tree(elt.dir) {
+		if elt.matches(dir) {
+			if p := filepath.Join(dir, name); isFile(p) {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+func isFile(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir()
+}
+
+// tree returns dir and all directories below it.
+func (r *Resolver) tree(dir string) []string {
+	if dirs, ok := r.trees[dir]; ok {
+		return dirs
+	}
+	var dirs []string
+	filepath.WalkDir(dir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if de.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	if r.trees == nil {
+		r.trees = make(map[string][]string)
+	}
+	r.trees[dir] = dirs
+	return dirs
+}
+
+// database is an ls-R file.
+type database struct {
+	root  string
+	files map[string][]string // file name -> directories
+}
+
+// database returns the ls-R database of the TEXMF tree that contains dir.
+func (r *Resolver) database(dir string) *database {
+	for _, root := range r.Roots {
+		root = filepath.Clean(root)
+		if dir != root && !strings.HasPrefix(dir, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			continue
+		}
+		if db, ok := r.dbs[root]; ok {
+			return db
+		}
+		db, err := readDatabase(root)
+		if err != nil {
+			db = nil
+		}
+		if r.dbs == nil {
+			r.dbs = make(map[string]*database)
+		}
+		r.dbs[root] = db
+		return db
+	}
+	return nil
+}
+
+// readDatabase reads the ls-R file of root.
+func readDatabase(root string) (*database, error) {
+	f, err := os.Open(filepath.Join(root, "ls-R"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db := &database{root: root, files: make(map[string][]string)}
+	dir := root
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "%"):
+		case strings.HasSuffix(line, ":"):
+			d := strings.TrimSuffix(line, ":")
+			if filepath.IsAbs(d) {
+				dir = filepath.Clean(d)
+			} else {
+				dir = filepath.Join(root, filepath.FromSlash(d))
+			}
+		default:
+			db.files[line] = append(db.files[line], dir)
+		}
+	}
+	return db, sc.Err()
+}
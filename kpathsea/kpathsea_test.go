@@ -0,0 +1,159 @@
+package kpathsea
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mkfiles creates empty files below dir.
+func mkfiles(t *testing.T, dir string, files ...string) {
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+func TestFindRoots(t *testing.T) {
+	dir := t.TempDir()
+	local, dist := filepath.Join(dir, "local"), filepath.Join(dir, "dist")
+	mkfiles(t, local, "fonts/tfm/house/cmr10.tfm")
+	mkfiles(t, dist, "fonts/tfm/public/cm/cmr10.tfm", "fonts/tfm/public/cm/cmbx10.tfm",
+		"fonts/type1/public/amsfonts/cm/cmr10.pfb", "fonts/pk/ljfour/public/cm/dpi600/cmr10.600pk",
+		"fonts/enc/dvips/base/8r.enc", "fonts/map/dvips/updmap/psfonts.map", "fonts/vf/public/x/ecrm1000.vf")
+	r := New(local, dist)
+	r.Getenv = env(nil)
+	testdata := []struct {
+		name string
+		t    FileType
+		exp  string
+	}{
+		{"cmr10", TFM, "local/fonts/tfm/house/cmr10.tfm"},
+		{"cmbx10.tfm", TFM, "dist/fonts/tfm/public/cm/cmbx10.tfm"},
+		{"cmr10", Type1, "dist/fonts/type1/public/amsfonts/cm/cmr10.pfb"},
+		{"cmr10.600pk", PK, "dist/fonts/pk/ljfour/public/cm/dpi600/cmr10.600pk"},
+		{"8r", Enc, "dist/fonts/enc/dvips/base/8r.enc"},
+		{"psfonts.map", Map, "dist/fonts/map/dvips/updmap/psfonts.map"},
+		{"ecrm1000", VF, "dist/fonts/vf/public/x/ecrm1000.vf"},
+	}
+	for _, td := range testdata {
+		p, err := r.Find(td.name, td.t)
+		if err != nil {
+			t.Errorf("%s: %s", td.name, err)
+		} else if p != filepath.Join(dir, filepath.FromSlash(td.exp)) {
+			t.Errorf("%s (%s): should be %s, but is %s", td.name, td.t, td.exp, p)
+		}
+	}
+	if _, err := r.Find("cmr12", TFM); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cmr12: want ErrNotFound, got %v", err)
+	}
+	f, err := r.OpenFile("cmbx10.tfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestDatabase(t *testing.T) {
+	root := t.TempDir()
+	mkfiles(t, root, "fonts/tfm/a/disk.tfm", "fonts/tfm/b/both.tfm")
+	lsR := `% ls-R -- filename database for kpathsea; do not change this line.
+./:
+ls-R
+fonts
+
+./fonts/tfm/a:
+dbonly.tfm
+
+./fonts/tfm/b:
+both.tfm
+`
+	if err := os.WriteFile(filepath.Join(root, "ls-R"), []byte(lsR), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := New(root)
+	r.Getenv = env(nil)
+	for _, name := range []string{"dbonly", "both", "disk"} {
+		if _, err := r.Find(name, TFM); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+	// !! looks into the database only
+	r = New(root)
+	r.Getenv = env(map[string]string{"TFMFONTS": "!!$TEXMF/fonts/tfm//"})
+	if p, err := r.Find("dbonly", TFM); err != nil || p != filepath.Join(root, "fonts", "tfm", "a", "dbonly.tfm") {
+		t.Errorf("dbonly: %q, %v", p, err)
+	}
+	if _, err := r.Find("disk", TFM); !errors.Is(err, ErrNotFound) {
+		t.Errorf("disk: want ErrNotFound, got %v", err)
+	}
+	// the roots are searched with their ls-R even if TEXMF is set
+	other := t.TempDir()
+	mkfiles(t, other, "fonts/tfm/x/both.tfm", "fonts/tfm/x/dbonly.tfm")
+	r = New(root)
+	r.Getenv = env(map[string]string{"TEXMF": other})
+	if res, exp := strings.Join(r.Path(TFM), " "), ". "+filepath.Join(root, "fonts", "tfm")+"//"; res != exp {
+		t.Errorf("should be %q, but is %q", exp, res)
+	}
+	if p, err := r.Find("dbonly", TFM); err != nil || p != filepath.Join(root, "fonts", "tfm", "a", "dbonly.tfm") {
+		t.Errorf("dbonly: %q, %v", p, err)
+	}
+}
+
+func TestPathVariables(t *testing.T) {
+	dir := t.TempDir()
+	mkfiles(t, dir, "house/tfm/x/house.tfm", "flat/flat.tfm", "flat/sub/deep.tfm", "texmf/fonts/tfm/std.tfm")
+	sep := string(os.PathListSeparator)
+	vars := map[string]string{
+		"HOUSE":    filepath.Join(dir, "house"),
+		"TEXFONTS": "${HOUSE}//" + sep + filepath.Join(dir, "flat") + sep,
+		"TEXMF":    filepath.Join(dir, "texmf"),
+	}
+	r := &Resolver{Getenv: env(vars)}
+	for _, name := range []string{"house", "flat", "std"} {
+		if _, err := r.Find(name, TFM); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+	// flat is not searched recursively
+	if _, err := r.Find("deep", TFM); err == nil {
+		t.Error("deep should not be found")
+	}
+	// TFMFONTS takes precedence over TEXFONTS
+	vars["TFMFONTS"] = filepath.Join(dir, "flat")
+	if _, err := r.Find("house", TFM); err != nil {
+		t.Errorf("house should be in the cache: %s", err)
+	}
+	r = &Resolver{Getenv: env(vars)}
+	if _, err := r.Find("house", TFM); err == nil {
+		t.Error("house should not be found with TFMFONTS set")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	if res, exp := expandBraces("{a,b{c,d}}/x"), []string{"a/x", "bc/x", "bd/x"}; !reflect.DeepEqual(res, exp) {
+		t.Errorf("should be %q, but is %q", exp, res)
+	}
+	r := &Resolver{Roots: []string{"/r1", "/r2"}, Getenv: env(nil)}
+	res := strings.Join(r.Path(TFM), " ")
+	if exp := ". /r1/fonts/tfm// /r2/fonts/tfm//"; res != exp {
+		t.Errorf("unexpected path %q", res)
+	}
+	if typ, ok := TypeOf("cmr10.600pk"); !ok || typ != PK {
+		t.Errorf("TypeOf(cmr10.600pk) = %s, %t", typ, ok)
+	}
+}
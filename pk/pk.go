@@ -0,0 +1,347 @@
+// Package pk reads packed font files.
+//
+// A PK file contains the glyphs of a font as bitmaps for one resolution,
+// usually created by METAFONT and GFtoPK. The bitmaps are run-length
+// encoded with a dynamic packing variable (dyn_f). The format is described
+// in PKtype.
+package pk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/speedata/gotex/tfm"
+)
+
+// ErrBadPK is wrapped by all errors that are caused by an invalid PK file.
+var ErrBadPK = errors.New("PK file is bad")
+
+const (
+	xxx1  = 240
+	xxx4  = 243
+	yyy   = 244
+	post  = 245
+	noOp  = 246
+	pre   = 247
+	pkID  = 89
+	black = 1
+)
+
+// Font is the contents of a PK file.
+type Font struct {
+	Comment    string
+	DesignSize tfm.FixWord // in points, should match the TFM file
+	Checksum   uint32      // should match the TFM file
+	HPPP, VPPP int         // pixels per point, scaled by 2^16
+	Specials   []string    // the xxx specials, for example the mode
+	Glyphs     map[int]*Glyph
+}
+
+// Glyph is a character of a PK file.
+type Glyph struct {
+	Code     int
+	TFMWidth tfm.FixWord // the width of the character in the TFM file
+	DX, DY   int         // the escapement in pixels, scaled by 2^16
+	Width    int         // of the bitmap
+	Height   int         // of the bitmap
+	// HOff and VOff are the position of the reference point relative to
+	// the upper left corner of the bitmap. The reference point is HOff
+	// pixels right and VOff pixels down from the corner, so the corner is
+	// at x-HOff, y-VOff.
+	HOff, VOff int
+	// Bitmap has one byte per pixel, row by row from the top; black pixels
+	// are 1, white pixels are 0.
+	Bitmap []byte
+}
+
+// Black reports whether the pixel in column x of row y is black.
+func (g *Glyph) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= g.Width || y >= g.Height {
+		return false
+	}
+	return g.Bitmap[y*g.Width+x] == black
+}
+
+func bad(format string, a ...interface{}) error {
+	return fmt.Errorf("%w (%s)", ErrBadPK, fmt.Sprintf(format, a...))
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+// num reads an n byte number, signed if signed is true.
+func (r *reader) num(n int, signed bool) (int, error) {
+	if r.pos+n > len(r.data) {
+		return 0, bad("file ends unexpectedly")
+	}
+	x := 0
+	for i := 0; i < n; i++ {
+		x = x<<8 | int(r.data[r.pos+i])
+	}
+	if signed && r.data[r.pos] > 127 {
+		x -= 1 << (8 * uint(n))
+	}
+	r.pos += n
+	return x, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, bad("file ends unexpectedly")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// Parse reads a PK file.
+func Parse(rd io.Reader) (*Font, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{data: data}
+	if len(data) < 2 || data[0] != pre || data[1] != pkID {
+		return nil, bad("the first bytes are not pre and %d", pkID)
+	}
+	r.pos = 2
+	f := &Font{Glyphs: make(map[int]*Glyph)}
+	k, err := r.num(1, false)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := r.bytes(k)
+	if err != nil {
+		return nil, err
+	}
+	f.Comment = string(comment)
+	var v [4]int
+	for i := range v {
+		if v[i], err = r.num(4, true); err != nil {
+			return nil, err
+		}
+	}
+	f.DesignSize, f.Checksum, f.HPPP, f.VPPP = tfm.FixWord(v[0]), uint32(v[1]), v[2], v[3]
+
+	for {
+		flag, err := r.num(1, false)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case flag < xxx1:
+			g, err := r.glyph(flag)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := f.Glyphs[g.Code]; ok {
+				return nil, bad("character %d is defined twice", g.Code)
+			}
+			f.Glyphs[g.Code] = g
+		case flag <= xxx4:
+			n, err := r.num(flag-xxx1+1, false)
+			if err != nil {
+				return nil, err
+			}
+			s, err := r.bytes(n)
+			if err != nil {
+				return nil, err
+			}
+			f.Specials = append(f.Specials, string(s))
+		case flag == yyy:
+			if _, err = r.num(4, false); err != nil {
+				return nil, err
+			}
+		case flag == noOp:
+		case flag == post:
+			return f, nil
+		default:
+			return nil, bad("unexpected command %d at byte %d", flag, r.pos-1)
+		}
+	}
+}
+
+// glyph reads a character definition with the flag byte flag.
+func (r *reader) glyph(flag int) (*Glyph, error) {
+	g := &Glyph{}
+	dynf := flag >> 4
+	if dynf == 15 {
+		return nil, bad("dyn_f is 15 at byte %d", r.pos-1)
+	}
+	// the short, extended short and long forms of the preamble
+	var sizes []int
+	var pl int
+	var err error
+	switch {
+	case flag&7 < 4:
+		if pl, err = r.num(1, false); err != nil {
+			return nil, err
+		}
+		pl += (flag & 3) << 8
+		sizes = []int{1, 3, 1, 1, 1, -1, -1}
+	case flag&7 < 7:
+		if pl, err = r.num(2, false); err != nil {
+			return nil, err
+		}
+		pl += (flag & 3) << 16
+		sizes = []int{1, 3, 2, 2, 2, -2, -2}
+	default:
+		if pl, err = r.num(4, true); err != nil {
+			return nil, err
+		}
+		sizes = []int{4, 4, 4, 4, 4, 4, -4, -4}
+	}
+	end := r.pos + pl
+	if pl < 0 || end > len(r.data) {
+		return nil, bad("character packet at byte %d is too long", r.pos)
+	}
+	v := make([]int, len(sizes))
+	for i, size := range sizes {
+		if size < 0 {
+			v[i], err = r.num(-size, true)
+		} else {
+			v[i], err = r.num(size, size == 4)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	g.Code, g.TFMWidth = v[0], tfm.FixWord(v[1])
+	if len(v) == 8 {
+		g.DX, g.DY = v[2], v[3]
+		v = v[2:]
+	} else {
+		g.DX = v[2] << 16
+		v = v[1:]
+	}
+	g.Width, g.Height, g.HOff, g.VOff = v[2], v[3], v[4], v[5]
+	if g.Width < 0 || g.Height < 0 || g.Width*g.Height > 1<<26 {
+		return nil, bad("character %d has the bad size %dx%d", g.Code, g.Width, g.Height)
+	}
+	if r.pos > end {
+		return nil, bad("character packet of %d is too short", g.Code)
+	}
+	raster := r.data[r.pos:end]
+	r.pos = end
+	g.Bitmap = make([]byte, g.Width*g.Height)
+	if len(g.Bitmap) == 0 {
+		return g, nil
+	}
+	if dynf == 14 {
+		// a plain bitmap without padding between the rows
+		for i := range g.Bitmap {
+			if i/8 >= len(raster) {
+				return nil, bad("bitmap of character %d is too short", g.Code)
+			}
+			if raster[i/8]&(0x80>>uint(i%8)) != 0 {
+				g.Bitmap[i] = black
+			}
+		}
+		return g, nil
+	}
+	if err = unpack(g, raster, dynf, flag&8 != 0); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// nybbles reads the run-length encoded raster of a character.
+type nybbles struct {
+	data   []byte
+	pos    int // in nybbles
+	dynf   int
+	repeat int
+}
+
+func (n *nybbles) get() (int, error) {
+	if n.pos/2 >= len(n.data) {
+		return 0, errors.New("raster ends unexpectedly")
+	}
+	b := int(n.data[n.pos/2])
+	if n.pos%2 == 0 {
+		b >>= 4
+	}
+	n.pos++
+	return b & 15, nil
+}
+
+// packedNum reads a run count and sets repeat if a repeat count comes
+// first.
+func (n *nybbles) packedNum() (int, error) {
+	i, err := n.get()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case i == 0:
+		j := 0
+		for j == 0 {
+			if j, err = n.get(); err != nil {
+				return 0, err
+			}
+			i++
+		}
+		for ; i > 0; i-- {
+			k, err := n.get()
+			if err != nil {
+				return 0, err
+			}
+			j = j*16 + k
+		}
+		return j - 15 + (13-n.dynf)*16 + n.dynf, nil
+	case i <= n.dynf:
+		return i, nil
+	case i < 14:
+		k, err := n.get()
+		if err != nil {
+			return 0, err
+		}
+		return (i-n.dynf-1)*16 + k + n.dynf + 1, nil
+	}
+	if n.repeat != 0 {
+		return 0, errors.New("second repeat count for this row")
+	}
+	n.repeat = 1
+	if i == 14 {
+		if n.repeat, err = n.packedNum(); err != nil {
+			return 0, err
+		}
+	}
+	return n.packedNum()
+}
+
+// unpack decodes the run-length encoded raster of g.
+func unpack(g *Glyph, raster []byte, dynf int, on bool) error {
+	n := &nybbles{data: raster, dynf: dynf}
+	row := make([]byte, g.Width)
+	x, y := 0, 0 // the next pixel
+	for y < g.Height {
+		count, err := n.packedNum()
+		if err != nil {
+			return bad("character %d: %s", g.Code, err)
+		}
+		var c byte
+		if on {
+			c = black
+		}
+		for ; count > 0; count-- {
+			row[x] = c
+			if x++; x == g.Width {
+				// the row is complete, it is used repeat+1 times
+				for i := 0; i <= n.repeat && y < g.Height; i++ {
+					copy(g.Bitmap[y*g.Width:], row)
+					y++
+				}
+				if y == g.Height && count > 1 {
+					return bad("character %d: more pixels than the bitmap", g.Code)
+				}
+				x, n.repeat = 0, 0
+			}
+		}
+		on = !on
+	}
+	return nil
+}
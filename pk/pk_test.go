@@ -0,0 +1,101 @@
+package pk
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func quad(b *bytes.Buffer, i int) {
+	b.Write([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+}
+
+// testPK has a run-length encoded A in the short form, a bitmap B in the
+// extended short form and a wide C in the long form.
+func testPK() []byte {
+	var b bytes.Buffer
+	b.Write([]byte{pre, pkID, 4})
+	b.WriteString("test")
+	quad(&b, 10<<20)
+	quad(&b, 0x12345678)
+	quad(&b, 0x48000)
+	quad(&b, 0x48000)
+	b.Write([]byte{xxx1, 9})
+	b.WriteString("mode=test")
+	// 1111
+	// 1001
+	// 1001 (repeated)
+	b.Write([]byte{0x88, 11, 'A', 0x08, 0, 0, 5, 4, 3, 0xff, 3, 0x5f, 0x21})
+	// 101
+	// 010
+	// 101
+	b.Write([]byte{0xe4, 0, 16, 'B', 0, 0x10, 0, 0, 4, 0, 3, 0, 3, 0, 0, 0, 2, 0xaa, 0x80})
+	// 200 white and 200 black pixels
+	b.WriteByte(0x27)
+	for _, x := range []int{35, 'C', 1 << 20, 400 << 16, 0, 400, 1, 0, 1} {
+		quad(&b, x)
+	}
+	b.Write([]byte{0x02, 0x50, 0x25})
+	b.Write([]byte{yyy, 0, 0, 0, 1, noOp, post, post, post})
+	return b.Bytes()
+}
+
+func bitmap(g *Glyph) string {
+	var rows []string
+	for y := 0; y < g.Height; y++ {
+		var row strings.Builder
+		for x := 0; x < g.Width; x++ {
+			if g.Black(x, y) {
+				row.WriteByte('1')
+			} else {
+				row.WriteByte('0')
+			}
+		}
+		rows = append(rows, row.String())
+	}
+	return strings.Join(rows, " ")
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(bytes.NewReader(testPK()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Comment != "test" || f.DesignSize != 10<<20 || f.Checksum != 0x12345678 || f.HPPP != 0x48000 {
+		t.Errorf("unexpected preamble %+v", f)
+	}
+	if len(f.Specials) != 1 || f.Specials[0] != "mode=test" {
+		t.Errorf("unexpected specials %q", f.Specials)
+	}
+	if len(f.Glyphs) != 3 {
+		t.Fatalf("want 3 glyphs, got %d", len(f.Glyphs))
+	}
+	a := f.Glyphs['A']
+	if a.TFMWidth != 1<<19 || a.DX != 5<<16 || a.HOff != -1 || a.VOff != 3 {
+		t.Errorf("unexpected A %+v", a)
+	}
+	if res, exp := bitmap(a), "1111 1001 1001"; res != exp {
+		t.Errorf("A: Should be %q, but is %q", exp, res)
+	}
+	if res, exp := bitmap(f.Glyphs['B']), "101 010 101"; res != exp {
+		t.Errorf("B: Should be %q, but is %q", exp, res)
+	}
+	c := f.Glyphs['C']
+	if c.DX != 400<<16 || c.Black(199, 0) || !c.Black(200, 0) || !c.Black(399, 0) || c.Black(400, 0) {
+		t.Errorf("unexpected C %+v", c)
+	}
+}
+
+func TestBadPK(t *testing.T) {
+	data := testPK()
+	for name, b := range map[string][]byte{
+		"truncated": data[:len(data)-20],
+		"id":        append([]byte{pre, 90}, data[2:]...),
+		"raster":    bytes.Replace(data, []byte{0x5f, 0x21}, []byte{0x5f, 0xe1}, 1),
+	} {
+		if _, err := Parse(bytes.NewReader(b)); !errors.Is(err, ErrBadPK) {
+			t.Errorf("%s: want ErrBadPK, got %v", name, err)
+		}
+	}
+}
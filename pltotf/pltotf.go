@@ -0,0 +1,1051 @@
+// Package pltotf converts property lists (PL files) to TFM files like the
+// TeXware program PLtoTF. The property list format is described in the
+// documentation of PLtoTF, TFtoPL (package tftopl) writes it.
+package pltotf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/speedata/gotex/tfm"
+)
+
+const unity = 1 << 20
+
+// Error is a syntax or validation error in a property list.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// node is a property: its name, the text up to the first sub property and
+// the sub properties.
+type node struct {
+	line     int
+	name     string
+	args     string
+	children []*node
+}
+
+// Convert reads a property list from r and writes the TFM file to w.
+func Convert(w io.Writer, r io.Reader) error {
+	f, err := Parse(r)
+	if err != nil {
+		return err
+	}
+	return f.Write(w)
+}
+
+// Parse reads a property list.
+func Parse(r io.Reader) (*tfm.Font, error) {
+	nodes, err := parseList(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	p := newPL()
+	if err = p.top(nodes); err != nil {
+		return nil, err
+	}
+	return p.font()
+}
+
+type scanner struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (s *scanner) read() (byte, error) {
+	c, err := s.r.ReadByte()
+	if c == '\n' {
+		s.line++
+	}
+	return c, err
+}
+
+func (s *scanner) unread(c byte) {
+	s.r.UnreadByte()
+	if c == '\n' {
+		s.line--
+	}
+}
+
+func (s *scanner) errorf(format string, a ...interface{}) error {
+	return &Error{Line: s.line, Msg: fmt.Sprintf(format, a...)}
+}
+
+// parseList reads the properties at the top level.
+func parseList(r *bufio.Reader) ([]*node, error) {
+	s := &scanner{r: r, line: 1}
+	var nodes []*node
+	for {
+		c, err := s.read()
+		if err == io.EOF {
+			return nodes, nil
+		} else if err != nil {
+			return nil, err
+		}
+		switch c {
+		case '(':
+			n, err := s.property()
+			if err != nil {
+				return nil, err
+			}
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+		case ')':
+			return nil, s.errorf("extra right parenthesis")
+		case ' ', '\t', '\r', '\n':
+		default:
+			return nil, s.errorf("text outside of a property")
+		}
+	}
+}
+
+// property reads a property after the left parenthesis. Comments are
+// returned as nil.
+func (s *scanner) property() (*node, error) {
+	n := &node{line: s.line}
+	var name, args strings.Builder
+	for {
+		c, err := s.read()
+		if err != nil {
+			return nil, s.errorf("unexpected end of file")
+		}
+		if c >= 'A' && c <= 'Z' || c == '/' || c == '>' || c >= '0' && c <= '9' {
+			name.WriteByte(c)
+			continue
+		}
+		s.unread(c)
+		break
+	}
+	n.name = name.String()
+	if n.name == "" {
+		return nil, s.errorf("property name expected")
+	}
+	if n.name == "COMMENT" {
+		return nil, s.skip()
+	}
+	for {
+		c, err := s.read()
+		if err != nil {
+			return nil, s.errorf("unexpected end of file in %s", n.name)
+		}
+		switch c {
+		case '(':
+			child, err := s.property()
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				n.children = append(n.children, child)
+			}
+		case ')':
+			n.args = strings.TrimSpace(args.String())
+			return n, nil
+		case '\n', '\t', '\r':
+			args.WriteByte(' ')
+		default:
+			if len(n.children) > 0 && c != ' ' {
+				return nil, s.errorf("text after a sub property of %s", n.name)
+			}
+			args.WriteByte(c)
+		}
+	}
+}
+
+// skip skips to the matching right parenthesis.
+func (s *scanner) skip() error {
+	level := 1
+	for level > 0 {
+		c, err := s.read()
+		if err != nil {
+			return s.errorf("unexpected end of file in a comment")
+		}
+		switch c {
+		case '(':
+			level++
+		case ')':
+			level--
+		}
+	}
+	return nil
+}
+
+// values reads the numbers and words of the args of a property.
+type values struct {
+	n      *node
+	fields []string
+}
+
+func (n *node) errorf(format string, a ...interface{}) error {
+	return &Error{Line: n.line, Msg: fmt.Sprintf(format, a...)}
+}
+
+func (n *node) values() *values {
+	return &values{n: n, fields: strings.Fields(n.args)}
+}
+
+func (v *values) next() (string, error) {
+	if len(v.fields) == 0 {
+		return "", v.n.errorf("missing value in %s", v.n.name)
+	}
+	s := v.fields[0]
+	v.fields = v.fields[1:]
+	return s, nil
+}
+
+func (v *values) end() error {
+	if len(v.fields) > 0 {
+		return v.n.errorf("junk %q at the end of %s", strings.Join(v.fields, " "), v.n.name)
+	}
+	return nil
+}
+
+// number reads an integer given as C, D, O, H or F value.
+func (v *values) number() (int, error) {
+	typ, err := v.next()
+	if err != nil {
+		return 0, err
+	}
+	s, err := v.next()
+	if err != nil {
+		return 0, err
+	}
+	var x int64
+	switch typ {
+	case "C":
+		if len(s) != 1 || s[0] < '!' || s[0] > '~' {
+			return 0, v.n.errorf("%q is not a printable ASCII character", s)
+		}
+		return int(s[0]), nil
+	case "D":
+		x, err = strconv.ParseInt(s, 10, 32)
+	case "O":
+		x, err = strconv.ParseInt(s, 8, 64)
+	case "H":
+		x, err = strconv.ParseInt(s, 16, 64)
+	case "F":
+		return face(v.n, s)
+	default:
+		return 0, v.n.errorf("%q is not a number type (C, D, O, H or F)", typ)
+	}
+	if err != nil || x < 0 || x > 0xffffffff {
+		return 0, v.n.errorf("bad number %s %s", typ, s)
+	}
+	return int(x), nil
+}
+
+// face returns the face code of a three letter face like MRR.
+func face(n *node, s string) (int, error) {
+	if len(s) == 3 {
+		w := strings.IndexByte("MBL", s[0])
+		sl := strings.IndexByte("RI", s[1])
+		e := strings.IndexByte("RCE", s[2])
+		if w >= 0 && sl >= 0 && e >= 0 {
+			return 6*e + 2*w + sl, nil
+		}
+	}
+	return 0, n.errorf("bad face code %q", s)
+}
+
+// char reads a character code.
+func (v *values) char() (int, error) {
+	c, err := v.number()
+	if err != nil {
+		return 0, err
+	}
+	if c > 255 {
+		return 0, v.n.errorf("character code %d is not between 0 and 255", c)
+	}
+	return c, nil
+}
+
+// real reads a real number given as R value (the number type may be
+// omitted) and converts it to a fix_word like PLtoTF's get_fix.
+func (v *values) real() (tfm.FixWord, error) {
+	s, err := v.next()
+	if err != nil {
+		return 0, err
+	}
+	if s == "R" || s == "D" {
+		if s, err = v.next(); err != nil {
+			return 0, err
+		}
+	}
+	x, ok := fix(s)
+	if !ok {
+		return 0, v.n.errorf("bad real constant %q (real constants must be less than 2048)", s)
+	}
+	return x, nil
+}
+
+func fix(s string) (tfm.FixWord, bool) {
+	negative := false
+	for len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		negative = negative != (s[0] == '-')
+		s = s[1:]
+	}
+	intpart, frac, _ := strings.Cut(s, ".")
+	if intpart == "" && frac == "" {
+		return 0, false
+	}
+	acc := 0
+	for _, c := range intpart {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		acc = 10*acc + int(c-'0')
+		if acc >= 2048 {
+			return 0, false
+		}
+	}
+	var digits []int
+	for _, c := range frac {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		if len(digits) < 7 {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	f := 0
+	for k := len(digits) - 1; k >= 0; k-- {
+		f = (f + digits[k]*010000000) / 10
+	}
+	f = (f + 1) / 2
+	if f >= unity && acc == 2047 {
+		return 0, false
+	}
+	x := tfm.FixWord(acc*unity + f)
+	if negative {
+		x = -x
+	}
+	return x, true
+}
+
+// charDef is a CHARACTER property.
+type charDef struct {
+	line                      int
+	width, height, depth, ic  tfm.FixWord
+	tag                       tfm.Tag
+	remainder                 int // next larger character or the label
+	exten                     tfm.Extensible
+	nextLarger, extenLine     int
+	haveTop, haveMid, haveBot bool
+}
+
+// instruction is a lig/kern step, kern instructions have Op >= 128 and
+// kern set.
+type instruction struct {
+	line int
+	lk   tfm.LigKern
+	kern tfm.FixWord
+}
+
+type pl struct {
+	checksum     uint32
+	haveChecksum bool
+	designSize   tfm.FixWord
+	designUnits  tfm.FixWord
+	codingScheme string
+	family       string
+	face         uint8
+	sevenBitSafe bool
+	header       map[int]uint32
+	params       []tfm.FixWord
+	bchar        int
+	chars        [256]*charDef
+	prog         []instruction
+	labels       map[int]int // character -> instruction
+	labelLine    map[int]int
+	leftBoundary int // instruction of LABEL BOUNDARYCHAR or -1
+	ligLine      int
+}
+
+func newPL() *pl {
+	return &pl{
+		designSize:   10 * unity,
+		designUnits:  unity,
+		codingScheme: "UNSPECIFIED",
+		header:       make(map[int]uint32),
+		bchar:        -1,
+		labels:       make(map[int]int),
+		labelLine:    make(map[int]int),
+		leftBoundary: -1,
+	}
+}
+
+var paramNumbers = map[string]int{
+	"SLANT": tfm.Slant, "SPACE": tfm.Space, "STRETCH": tfm.SpaceStretch,
+	"SHRINK": tfm.SpaceShrink, "XHEIGHT": tfm.XHeight, "QUAD": tfm.Quad,
+	"EXTRASPACE": tfm.ExtraSpace,
+	"NUM1":       8, "NUM2": 9, "NUM3": 10, "DENOM1": 11, "DENOM2": 12,
+	"SUP1": 13, "SUP2": 14, "SUP3": 15, "SUB1": 16, "SUB2": 17,
+	"SUPDROP": 18, "SUBDROP": 19, "DELIM1": 20, "DELIM2": 21, "AXISHEIGHT": 22,
+	"DEFAULTRULETHICKNESS": 8, "BIGOPSPACING1": 9, "BIGOPSPACING2": 10,
+	"BIGOPSPACING3": 11, "BIGOPSPACING4": 12, "BIGOPSPACING5": 13,
+}
+
+var ligOps = map[string]uint8{
+	"LIG": 0, "LIG/": 1, "/LIG": 2, "/LIG/": 3,
+	"LIG/>": 5, "/LIG>": 6, "/LIG/>": 7, "/LIG/>>": 11,
+}
+
+// noChildren makes sure n has no sub properties.
+func noChildren(n *node) error {
+	if len(n.children) > 0 {
+		return n.errorf("%s has no sub properties", n.name)
+	}
+	return nil
+}
+
+func (p *pl) top(nodes []*node) error {
+	for _, n := range nodes {
+		var err error
+		v := n.values()
+		if n.name != "FONTDIMEN" && n.name != "LIGTABLE" && n.name != "CHARACTER" {
+			if err = noChildren(n); err != nil {
+				return err
+			}
+		}
+		switch n.name {
+		case "CHECKSUM":
+			var x int
+			if x, err = v.number(); err == nil {
+				p.checksum, p.haveChecksum = uint32(x), true
+				err = v.end()
+			}
+		case "DESIGNSIZE":
+			if p.designSize, err = v.real(); err == nil {
+				if p.designSize < unity {
+					return n.errorf("the design size must be at least 1")
+				}
+				err = v.end()
+			}
+		case "DESIGNUNITS":
+			if p.designUnits, err = v.real(); err == nil {
+				if p.designUnits <= 0 {
+					return n.errorf("the number of units per design size must be positive")
+				}
+				err = v.end()
+			}
+		case "CODINGSCHEME":
+			p.codingScheme, err = bcpl(n, 39)
+		case "FAMILY":
+			p.family, err = bcpl(n, 19)
+		case "FACE":
+			var x int
+			if x, err = v.number(); err == nil {
+				if x > 255 {
+					return n.errorf("face code %d is too big", x)
+				}
+				p.face = uint8(x)
+				err = v.end()
+			}
+		case "SEVENBITSAFEFLAG":
+			var s string
+			if s, err = v.next(); err == nil {
+				p.sevenBitSafe = s == "TRUE"
+				if s != "TRUE" && s != "FALSE" {
+					return n.errorf("SEVENBITSAFEFLAG must be TRUE or FALSE")
+				}
+				err = v.end()
+			}
+		case "HEADER":
+			var i, x int
+			if i, err = v.number(); err == nil {
+				if i < 18 || i > 255 {
+					return n.errorf("HEADER indices should be between 18 and 255")
+				}
+				if x, err = v.number(); err == nil {
+					p.header[i] = uint32(x)
+					err = v.end()
+				}
+			}
+		case "BOUNDARYCHAR":
+			if p.bchar, err = v.char(); err == nil {
+				err = v.end()
+			}
+		case "FONTDIMEN":
+			if err = v.end(); err == nil {
+				err = p.fontdimen(n)
+			}
+		case "LIGTABLE":
+			if err = v.end(); err == nil {
+				err = p.ligtable(n)
+			}
+		case "CHARACTER":
+			err = p.character(n)
+		default:
+			return n.errorf("unknown property %s", n.name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bcpl returns the string of a CODINGSCHEME or FAMILY property.
+func bcpl(n *node, max int) (string, error) {
+	if len(n.args) > max {
+		return "", n.errorf("%s must not be longer than %d characters", n.name, max)
+	}
+	return strings.ToUpper(n.args), nil
+}
+
+func (p *pl) fontdimen(list *node) error {
+	for _, n := range list.children {
+		if err := noChildren(n); err != nil {
+			return err
+		}
+		v := n.values()
+		num, ok := paramNumbers[n.name]
+		if n.name == "PARAMETER" {
+			var err error
+			if num, err = v.number(); err != nil {
+				return err
+			}
+			if num < 1 || num > 254 {
+				return n.errorf("PARAMETER index must be between 1 and 254")
+			}
+		} else if !ok {
+			return n.errorf("unknown font parameter %s", n.name)
+		}
+		x, err := v.real()
+		if err != nil {
+			return err
+		}
+		if err = v.end(); err != nil {
+			return err
+		}
+		for len(p.params) < num {
+			p.params = append(p.params, 0)
+		}
+		p.params[num-1] = x
+	}
+	return nil
+}
+
+func (p *pl) ligtable(list *node) error {
+	p.ligLine = list.line
+	stopped := true
+	for _, n := range list.children {
+		if err := noChildren(n); err != nil {
+			return err
+		}
+		v := n.values()
+		switch n.name {
+		case "LABEL":
+			if strings.TrimSpace(n.args) == "BOUNDARYCHAR" {
+				if p.leftBoundary >= 0 {
+					return n.errorf("duplicate LABEL BOUNDARYCHAR")
+				}
+				p.leftBoundary = len(p.prog)
+				continue
+			}
+			c, err := v.char()
+			if err != nil {
+				return err
+			}
+			if _, ok := p.labels[c]; ok {
+				return n.errorf("duplicate LABEL for character %d", c)
+			}
+			p.labels[c] = len(p.prog)
+			p.labelLine[c] = n.line
+			if err = v.end(); err != nil {
+				return err
+			}
+		case "STOP", "SKIP":
+			if len(p.prog) == 0 || stopped {
+				return n.errorf("%s must follow a LIG or KRN", n.name)
+			}
+			skip := 128
+			if n.name == "SKIP" {
+				var err error
+				if skip, err = v.number(); err != nil {
+					return err
+				}
+				if skip > 127 {
+					return n.errorf("maximum SKIP amount is 127")
+				}
+			}
+			if err := v.end(); err != nil {
+				return err
+			}
+			p.prog[len(p.prog)-1].lk.Skip = uint8(skip)
+			stopped = true
+		case "KRN":
+			c, err := v.char()
+			if err != nil {
+				return err
+			}
+			kern, err := v.real()
+			if err != nil {
+				return err
+			}
+			if err = v.end(); err != nil {
+				return err
+			}
+			p.prog = append(p.prog, instruction{line: n.line, lk: tfm.LigKern{Next: uint8(c), Op: 128}, kern: kern})
+			stopped = false
+		default:
+			op, ok := ligOps[n.name]
+			if !ok {
+				return n.errorf("unknown lig/kern instruction %s", n.name)
+			}
+			c, err := v.char()
+			if err != nil {
+				return err
+			}
+			lig, err := v.char()
+			if err != nil {
+				return err
+			}
+			if err = v.end(); err != nil {
+				return err
+			}
+			p.prog = append(p.prog, instruction{line: n.line, lk: tfm.LigKern{Next: uint8(c), Op: op, Remainder: uint8(lig)}})
+			stopped = false
+		}
+	}
+	if !stopped {
+		p.prog[len(p.prog)-1].lk.Skip = 128
+	}
+	return nil
+}
+
+func (p *pl) character(list *node) error {
+	v := list.values()
+	c, err := v.char()
+	if err != nil {
+		return err
+	}
+	if err = v.end(); err != nil {
+		return err
+	}
+	if p.chars[c] != nil {
+		return list.errorf("character %d is defined twice", c)
+	}
+	cd := &charDef{line: list.line}
+	p.chars[c] = cd
+	for _, n := range list.children {
+		if n.name != "VARCHAR" {
+			if err = noChildren(n); err != nil {
+				return err
+			}
+		}
+		v := n.values()
+		var x tfm.FixWord
+		switch n.name {
+		case "CHARWD", "CHARHT", "CHARDP", "CHARIC":
+			if x, err = v.real(); err != nil {
+				return err
+			}
+			switch n.name {
+			case "CHARWD":
+				cd.width = x
+			case "CHARHT":
+				cd.height = x
+			case "CHARDP":
+				cd.depth = x
+			case "CHARIC":
+				cd.ic = x
+			}
+		case "NEXTLARGER":
+			if cd.tag != tfm.NoTag {
+				return n.errorf("character %d already has a NEXTLARGER or VARCHAR", c)
+			}
+			if cd.remainder, err = v.char(); err != nil {
+				return err
+			}
+			cd.tag, cd.nextLarger = tfm.ListTag, n.line
+		case "VARCHAR":
+			if cd.tag != tfm.NoTag {
+				return n.errorf("character %d already has a NEXTLARGER or VARCHAR", c)
+			}
+			cd.tag, cd.extenLine = tfm.ExtTag, n.line
+			if err = p.varchar(cd, n); err != nil {
+				return err
+			}
+		default:
+			return n.errorf("unknown character property %s", n.name)
+		}
+		if err = v.end(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pl) varchar(cd *charDef, list *node) error {
+	for _, n := range list.children {
+		if err := noChildren(n); err != nil {
+			return err
+		}
+		v := n.values()
+		c, err := v.char()
+		if err != nil {
+			return err
+		}
+		if err = v.end(); err != nil {
+			return err
+		}
+		switch n.name {
+		case "TOP":
+			cd.exten.Top, cd.haveTop = uint8(c), true
+		case "MID":
+			cd.exten.Mid, cd.haveMid = uint8(c), true
+		case "BOT":
+			cd.exten.Bot, cd.haveBot = uint8(c), true
+		case "REP":
+			cd.exten.Rep = uint8(c)
+		default:
+			return n.errorf("unknown VARCHAR piece %s", n.name)
+		}
+	}
+	return nil
+}
+
+// scale converts a dimension in design units to a fix_word.
+func (p *pl) scale(x tfm.FixWord) tfm.FixWord {
+	if p.designUnits == unity {
+		return x
+	}
+	q := int64(x) * unity
+	d := int64(p.designUnits)
+	if q >= 0 {
+		return tfm.FixWord((q + d/2) / d)
+	}
+	return -tfm.FixWord((-q + d/2) / d)
+}
+
+// font builds the TFM data from the properties.
+func (p *pl) font() (*tfm.Font, error) {
+	f := &tfm.Font{
+		DesignSize:   p.designSize,
+		CodingScheme: p.codingScheme,
+		Family:       p.family,
+		Face:         p.face,
+		SevenBitSafe: p.sevenBitSafe,
+		BC:           1,
+		EC:           0,
+	}
+	lh := 18
+	for i := range p.header {
+		if i+1 > lh {
+			lh = i + 1
+		}
+	}
+	f.Header = make([]uint32, lh)
+	for i, x := range p.header {
+		f.Header[i] = x
+	}
+	for c := 255; c >= 0; c-- {
+		if p.chars[c] != nil {
+			f.BC = c
+			if f.EC < c {
+				f.EC = c
+			}
+		}
+	}
+	for c := range p.labels {
+		if p.chars[c] == nil {
+			return nil, &Error{Line: p.labelLine[c], Msg: fmt.Sprintf("LABEL for character %d which is not in the font", c)}
+		}
+	}
+	for c, cd := range p.chars {
+		if cd == nil {
+			continue
+		}
+		if _, ok := p.labels[c]; ok && cd.tag != tfm.NoTag {
+			return nil, &Error{Line: cd.line, Msg: fmt.Sprintf("character %d has a LABEL and a NEXTLARGER or VARCHAR", c)}
+		}
+		if cd.tag == tfm.ListTag && p.chars[cd.remainder] == nil {
+			return nil, &Error{Line: cd.nextLarger, Msg: fmt.Sprintf("NEXTLARGER character %d is not in the font", cd.remainder)}
+		}
+		if cd.tag == tfm.ExtTag {
+			e := cd.exten
+			for _, piece := range []struct {
+				c    uint8
+				used bool
+			}{{e.Top, cd.haveTop}, {e.Mid, cd.haveMid}, {e.Bot, cd.haveBot}, {e.Rep, true}} {
+				if piece.used && p.chars[piece.c] == nil {
+					return nil, &Error{Line: cd.extenLine, Msg: fmt.Sprintf("VARCHAR piece %d is not in the font", piece.c)}
+				}
+			}
+		}
+	}
+	for _, in := range p.prog {
+		if in.lk.Op < 128 && p.chars[in.lk.Remainder] == nil {
+			return nil, &Error{Line: in.line, Msg: fmt.Sprintf("ligature character %d is not in the font", in.lk.Remainder)}
+		}
+	}
+
+	var widths, heights, depths, italics []tfm.FixWord
+	for _, cd := range p.chars {
+		if cd != nil {
+			widths = append(widths, p.scale(cd.width))
+			heights = append(heights, p.scale(cd.height))
+			depths = append(depths, p.scale(cd.depth))
+			italics = append(italics, p.scale(cd.ic))
+		}
+	}
+	var wIdx, hIdx, dIdx, iIdx map[tfm.FixWord]int
+	f.Width, wIdx = pack(widths, 255, true)
+	f.Height, hIdx = pack(heights, 15, false)
+	f.Depth, dIdx = pack(depths, 15, false)
+	f.Italic, iIdx = pack(italics, 63, false)
+
+	for c := f.BC; c <= f.EC; c++ {
+		cd := p.chars[c]
+		if cd == nil {
+			f.CharInfo = append(f.CharInfo, tfm.CharInfo{})
+			continue
+		}
+		ci := tfm.CharInfo{
+			WidthIndex:  uint8(wIdx[p.scale(cd.width)]),
+			HeightIndex: uint8(hIdx[p.scale(cd.height)]),
+			DepthIndex:  uint8(dIdx[p.scale(cd.depth)]),
+			ItalicIndex: uint8(iIdx[p.scale(cd.ic)]),
+			Tag:         cd.tag,
+		}
+		switch cd.tag {
+		case tfm.ListTag:
+			ci.Remainder = uint8(cd.remainder)
+		case tfm.ExtTag:
+			ci.Remainder = uint8(len(f.Exten))
+			f.Exten = append(f.Exten, cd.exten)
+		}
+		f.CharInfo = append(f.CharInfo, ci)
+	}
+	if err := p.ligkern(f); err != nil {
+		return nil, err
+	}
+
+	f.Params = append(f.Params, p.params...)
+	for i := 1; i < len(f.Params); i++ {
+		f.Params[i] = p.scale(f.Params[i])
+	}
+	if p.haveChecksum {
+		f.Checksum = p.checksum
+	} else {
+		f.Checksum = checksum(f)
+	}
+	return f, nil
+}
+
+// ligkern builds the lig/kern program and the kern table. Characters
+// whose program starts beyond instruction 255 get an indirect first
+// instruction at the beginning of the program.
+func (p *pl) ligkern(f *tfm.Font) error {
+	if len(p.prog) == 0 && p.bchar < 0 && p.leftBoundary < 0 {
+		return nil
+	}
+	var starts []int
+	seen := make(map[int]bool)
+	for _, i := range p.labels {
+		if !seen[i] {
+			seen[i] = true
+			starts = append(starts, i)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(starts)))
+	// offset is the number of words in front of the program, one for each
+	// start that would be too far away otherwise.
+	offset := 0
+	if p.bchar >= 0 {
+		offset = 1
+	}
+	for {
+		n := 0
+		for _, i := range starts {
+			if i+offset > 255 {
+				n++
+			}
+		}
+		if p.bchar >= 0 && n == 0 {
+			n = 1
+		}
+		if n == offset {
+			break
+		}
+		offset = n
+	}
+	for k := 0; k < offset; k++ {
+		f.LigKern = append(f.LigKern, tfm.LigKern{Skip: 255})
+	}
+	if p.bchar >= 0 {
+		f.LigKern[0].Next = uint8(p.bchar)
+	} else if offset > 0 {
+		// not a boundary char declaration
+		f.LigKern[0].Skip = 254
+	}
+	redirect := make(map[int]int) // program start -> indirect word
+	k := 0
+	for _, i := range starts {
+		if i+offset > 255 {
+			redirect[i] = k
+			f.LigKern[k].Op, f.LigKern[k].Remainder = uint8((i+offset)>>8), uint8(i+offset)
+			k++
+		}
+	}
+
+	kerns := make(map[tfm.FixWord]int)
+	for _, in := range p.prog {
+		lk := in.lk
+		if lk.Op >= 128 {
+			kern := p.scale(in.kern)
+			idx, ok := kerns[kern]
+			if !ok {
+				idx = len(f.Kern)
+				kerns[kern] = idx
+				f.Kern = append(f.Kern, kern)
+			}
+			lk.Op, lk.Remainder = uint8(128+idx>>8), uint8(idx)
+		}
+		f.LigKern = append(f.LigKern, lk)
+	}
+	if len(f.Kern) > 256*128 {
+		return &Error{Line: p.ligLine, Msg: "too many different kerns"}
+	}
+	for i, in := range p.prog {
+		if in.lk.Skip < 128 && i+int(in.lk.Skip)+1 >= len(p.prog) {
+			return &Error{Line: in.line, Msg: "SKIP goes beyond the end of the LIGTABLE"}
+		}
+	}
+	if p.leftBoundary >= 0 {
+		start := p.leftBoundary + offset
+		f.LigKern = append(f.LigKern, tfm.LigKern{Skip: 255, Op: uint8(start >> 8), Remainder: uint8(start)})
+	}
+	for c, i := range p.labels {
+		if k, ok := redirect[i]; ok {
+			f.CharInfo[c-f.BC].Remainder = uint8(k)
+		} else {
+			f.CharInfo[c-f.BC].Remainder = uint8(i + offset)
+		}
+		f.CharInfo[c-f.BC].Tag = tfm.LigTag
+	}
+
+	// a ligature must not lead to an infinite loop
+	for c, i := range p.labels {
+		for ; i < len(p.prog); i++ {
+			in := p.prog[i]
+			if in.lk.Op < 128 {
+				if _, err := f.Shape([]int{c, int(in.lk.Next)}, false); errors.Is(err, tfm.ErrLigatureLoop) {
+					return &Error{Line: in.line, Msg: fmt.Sprintf("infinite ligature loop starting with %d and %d", c, in.lk.Next)}
+				}
+			}
+			if in.lk.Skip >= 128 {
+				break
+			}
+			i += int(in.lk.Skip)
+		}
+	}
+	return nil
+}
+
+// pack returns the table of the different values with 0 at index 0 and
+// the index of each value. If there are more than max values, close values
+// are merged like PLtoTF does. If keepZero is true, zero gets an index
+// greater than 0 (a width of 0 means the character does not exist).
+func pack(values []tfm.FixWord, max int, keepZero bool) ([]tfm.FixWord, map[tfm.FixWord]int) {
+	seen := make(map[tfm.FixWord]bool)
+	var distinct []tfm.FixWord
+	for _, x := range values {
+		if (x != 0 || keepZero) && !seen[x] {
+			seen[x] = true
+			distinct = append(distinct, x)
+		}
+	}
+	sort.Slice(distinct, func(i, j int) bool { return distinct[i] < distinct[j] })
+	table := []tfm.FixWord{0}
+	index := make(map[tfm.FixWord]int)
+	if !keepZero {
+		index[0] = 0
+	}
+	if len(distinct) <= max {
+		for _, x := range distinct {
+			index[x] = len(table)
+			table = append(table, x)
+		}
+		return table, index
+	}
+	d := tfm.FixWord(0)
+	if k, nextD := minCover(distinct, 0); k > max {
+		d = nextD
+		for {
+			if k, _ = minCover(distinct, d); k <= max {
+				break
+			}
+			d += d
+		}
+		d /= 2
+		for {
+			if k, nextD = minCover(distinct, d); k <= max {
+				break
+			}
+			d = nextD
+		}
+	}
+	// replace each group by its midpoint
+	for i := 0; i < len(distinct); {
+		l := distinct[i]
+		j := i
+		for j < len(distinct) && distinct[j] <= l+d {
+			j++
+		}
+		mid := l + (distinct[j-1]-l)/2
+		for _, x := range distinct[i:j] {
+			index[x] = len(table)
+		}
+		table = append(table, mid)
+		i = j
+	}
+	return table, index
+}
+
+// minCover returns the number of intervals of length d needed to cover
+// the sorted values and the smallest d that would need fewer intervals.
+func minCover(values []tfm.FixWord, d tfm.FixWord) (int, tfm.FixWord) {
+	k := 0
+	nextD := tfm.FixWord(1<<31 - 1)
+	for i := 0; i < len(values); {
+		k++
+		l := values[i]
+		for i < len(values) && values[i] <= l+d {
+			i++
+		}
+		if i < len(values) && values[i]-l < nextD {
+			nextD = values[i] - l
+		}
+	}
+	return k, nextD
+}
+
+// checksum computes the check sum of PLtoTF from the character widths.
+func checksum(f *tfm.Font) uint32 {
+	c0, c1, c2, c3 := f.BC, f.EC, f.BC, f.EC
+	for c := f.BC; c <= f.EC; c++ {
+		ci := f.CharInfo[c-f.BC]
+		if ci.WidthIndex == 0 {
+			continue
+		}
+		w := int(f.Width[ci.WidthIndex]) + (c+4)*020000000
+		c0 = (c0 + c0 + w) % 255
+		c1 = (c1 + c1 + w) % 253
+		c2 = (c2 + c2 + w) % 251
+		c3 = (c3 + c3 + w) % 247
+	}
+	return uint32(c0)<<24 | uint32(c1)<<16 | uint32(c2)<<8 | uint32(c3)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/speedata/gotex/pltotf"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: pltotf PLFILE TFMFILE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "pltotf: Need exactly two file arguments.")
+		fmt.Fprintln(os.Stderr, "Try `pltotf --help' for more information.")
+		os.Exit(1)
+	}
+	plfile, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer plfile.Close()
+
+	// don't leave a partial TFM file behind if the property list is bad
+	var b bytes.Buffer
+	if err = pltotf.Convert(&b, plfile); err != nil {
+		var plErr *pltotf.Error
+		if errors.As(err, &plErr) {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", flag.Arg(0), plErr.Line, plErr.Msg)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err = os.WriteFile(flag.Arg(1), b.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,203 @@
+package pltotf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/tftopl"
+)
+
+const testPL = `(FAMILY TEST)
+(FACE F LRC)
+(CODINGSCHEME TEX TEST)
+(DESIGNSIZE R 10.0)
+(COMMENT DESIGNSIZE IS IN POINTS)
+(COMMENT OTHER SIZES ARE MULTIPLES OF DESIGNSIZE)
+(CHECKSUM O 2215053170)
+(SEVENBITSAFEFLAG TRUE)
+(FONTDIMEN
+   (SLANT R 0.0)
+   (SPACE R 0.333334)
+   (STRETCH R 0.0)
+   (SHRINK R 0.0)
+   (XHEIGHT R 0.0)
+   (QUAD R 1.0)
+   (EXTRASPACE R 0.0)
+   (PARAMETER D 8 R 3.0)
+   )
+(BOUNDARYCHAR C B)
+(LIGTABLE
+   (LABEL BOUNDARYCHAR)
+   (LIG C A C C)
+   (STOP)
+   (LABEL C A)
+   (KRN C B R -0.1)
+   (/LIG C C C B)
+   (SKIP D 1)
+   (LABEL C C)
+   (KRN C A R -0.1)
+   (KRN C C R 0.05)
+   (STOP)
+   )
+(CHARACTER C A
+   (CHARWD R 0.5)
+   (CHARHT R 0.7)
+   (COMMENT
+      (KRN C B R -0.1)
+      (/LIG C C C B)
+      (KRN C C R 0.05)
+      )
+   )
+(CHARACTER C B
+   (CHARWD R 0.75)
+   (CHARHT R 0.7)
+   (CHARDP R 0.2)
+   (CHARIC R 0.05)
+   (NEXTLARGER C D)
+   )
+(CHARACTER C C
+   (CHARWD R 0.5)
+   (COMMENT
+      (KRN C A R -0.1)
+      (KRN C C R 0.05)
+      )
+   )
+(CHARACTER C D
+   (CHARWD R 0.0)
+   (VARCHAR
+      (TOP C A)
+      (REP C D)
+      )
+   )
+`
+
+func TestRoundTrip(t *testing.T) {
+	var tfmData, pl bytes.Buffer
+	if err := Convert(&tfmData, strings.NewReader(testPL)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := tfm.Parse(&tfmData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tftopl.Write(&pl, f); err != nil {
+		t.Fatal(err)
+	}
+	if pl.String() != testPL {
+		t.Errorf("unexpected property list:\n%s", pl.String())
+	}
+	if len(f.Kern) != 2 {
+		t.Errorf("kern table should have 2 entries, has %d", len(f.Kern))
+	}
+}
+
+func TestFix(t *testing.T) {
+	testdata := []struct {
+		s   string
+		exp tfm.FixWord
+	}{
+		{"0.5", 1 << 19},
+		{"-1", -1 << 20},
+		{"0.333334", 349526},
+		{"2047.999999", 2047<<20 + 1<<20 - 1},
+		{".1", 104858},
+	}
+	for _, td := range testdata {
+		if res, ok := fix(td.s); !ok || res != td.exp {
+			t.Errorf("fix(%q): should be %d, but is %d", td.s, td.exp, res)
+		}
+	}
+	for _, s := range []string{"2048", "2047.9999999", "1.2.3", "x"} {
+		if _, ok := fix(s); ok {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestChecksumAndUnits(t *testing.T) {
+	pl := `(DESIGNUNITS R 1000)
+(CHARACTER C A (CHARWD R 500))
+(CHARACTER C B (CHARWD R 250) (CHARHT R 700))
+`
+	f, err := Parse(strings.NewReader(pl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := f.Char('A')
+	b, _ := f.Char('B')
+	if a.Width != 1<<19 || b.Width != 1<<18 || b.Height != 734003 {
+		t.Errorf("unexpected dimensions %s %s %s", a.Width, b.Width, b.Height)
+	}
+	if f.Checksum == 0 || f.Checksum != checksum(f) {
+		t.Errorf("checksum %x", f.Checksum)
+	}
+	if f.CodingScheme != "UNSPECIFIED" || f.DesignSize != 10<<20 {
+		t.Errorf("coding scheme %q, design size %s", f.CodingScheme, f.DesignSize)
+	}
+}
+
+func TestPack(t *testing.T) {
+	var values []tfm.FixWord
+	for i := 1; i <= 20; i++ {
+		values = append(values, tfm.FixWord(i*100))
+	}
+	table, index := pack(values, 15, false)
+	if len(table) > 16 {
+		t.Fatalf("table has %d entries", len(table))
+	}
+	for _, x := range values {
+		if d := table[index[x]] - x; d < -100 || d > 100 {
+			t.Errorf("%d is represented by %d", x, table[index[x]])
+		}
+	}
+}
+
+func TestLongProgram(t *testing.T) {
+	// a program for A that starts beyond instruction 255 needs an indirect
+	// first instruction
+	var b strings.Builder
+	b.WriteString("(LIGTABLE\n(LABEL C B)\n")
+	for i := 0; i < 300; i++ {
+		b.WriteString("(KRN C B R 0.1)\n")
+	}
+	b.WriteString("(STOP)\n(LABEL C A)\n(KRN C B R 0.2)\n(STOP)\n)\n(CHARACTER C A (CHARWD R 1))\n(CHARACTER C B (CHARWD R 1))\n")
+	f, err := Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lk, ok := f.LigKernFor('A', 'B')
+	if !ok || f.KernValue(lk) != 209715 {
+		t.Errorf("A B: %v %t", lk, ok)
+	}
+	if _, ok := f.BoundaryChar(); ok {
+		t.Error("font should not have a boundary char")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	testdata := []struct {
+		pl   string
+		line int
+	}{
+		{"(DESIGNSIZE R 10)\n(FOO)", 2},
+		{"(CHARACTER C A\n   (CHARWD R 3000))", 2},
+		{"(CHARACTER C A\n   (NEXTLARGER C B))", 2},
+		{"(LIGTABLE\n(LABEL C A)\n(LIG C A C B)\n)\n(CHARACTER C A)", 3},
+		{"(LIGTABLE\n(LABEL C A)\n(LIG/ C A C A)\n)\n(CHARACTER C A)", 3},
+		{"(LIGTABLE\n(LABEL C A)\n(SKIP D 1)\n)", 3},
+		{"(CHECKSUM O 1)\n\n)", 3},
+		{"(CHARACTER C A\n(CHARWD R 1)", 2},
+	}
+	for _, td := range testdata {
+		_, err := Parse(strings.NewReader(td.pl))
+		var plErr *Error
+		if !errors.As(err, &plErr) {
+			t.Errorf("%q: want *Error, got %v", td.pl, err)
+		} else if plErr.Line != td.line {
+			t.Errorf("%q: error %q should be in line %d", td.pl, err, td.line)
+		}
+	}
+}
@@ -1,31 +1,141 @@
+// Package simplefilefinder has simple implementations of the FileFinder
+// interface of dvitype. All of them find files by their name only,
+// regardless of the directory they are in. They are safe for concurrent
+// use.
 package simplefilefinder
 
 import (
-	"fmt"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 )
 
+func notFound(name string) error {
+	return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Dir finds files in a directory and its subdirectories. The directory is
+// scanned on the first call to OpenFile.
+type Dir struct {
+	basedir  string
+	once     sync.Once
+	filelist map[string]string
+}
+
+// NewDir returns a Dir for basedir.
+func NewDir(basedir string) *Dir {
+	return &Dir{basedir: basedir}
+}
+
+// OpenFile opens the first file called name below the base directory.
+func (d *Dir) OpenFile(name string) (io.ReadCloser, error) {
+	p, ok := d.find(name)
+	if !ok {
+		return nil, notFound(name)
+	}
+	return os.Open(p)
+}
+
+// find returns the path of the first file called name below the base
+// directory.
+func (d *Dir) find(name string) (string, bool) {
+	d.once.Do(func() {
+		d.filelist = make(map[string]string)
+		filepath.WalkDir(d.basedir, func(p string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if _, ok := d.filelist[de.Name()]; !ok && !de.IsDir() {
+				d.filelist[de.Name()] = p
+			}
+			return nil
+		})
+	})
+	p, ok := d.filelist[name]
+	return p, ok
+}
+
+// Basedir is the directory that Locate searches.
+//
+// Deprecated: Use NewDir.
 var Basedir string
-var filelist map[string]string
 
-func init() {
-	filelist = make(map[string]string)
+var (
+	locateMu  sync.Mutex
+	locateDir *Dir
+)
+
+// Locate returns the path of the first file called filename below
+// Basedir, the empty string if there is none. The directory is scanned
+// again when Basedir changes.
+//
+// Deprecated: Use the OpenFile method of NewDir(basedir).
+func Locate(filename string) string {
+	locateMu.Lock()
+	if locateDir == nil || locateDir.basedir != Basedir {
+		locateDir = NewDir(Basedir)
+	}
+	d := locateDir
+	locateMu.Unlock()
+	p, _ := d.find(filename)
+	return p
 }
 
-func collectFiles(path string, info os.FileInfo, err error) error {
-	if false {
-		fmt.Println(path, info, err)
+// FS finds files in a file system such as an embed.FS.
+type FS struct {
+	fsys     fs.FS
+	once     sync.Once
+	filelist map[string]string
+}
+
+// NewFS returns an FS for fsys.
+func NewFS(fsys fs.FS) *FS {
+	return &FS{fsys: fsys}
+}
+
+// NewZip returns an FS for the zip archive in r.
+func NewZip(r io.ReaderAt, size int64) (*FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
 	}
-	if filepath.Ext(path) == ".tfm" {
-		filelist[info.Name()] = path
+	return NewFS(zr), nil
+}
+
+// OpenFile opens the first file called name in the file system.
+func (f *FS) OpenFile(name string) (io.ReadCloser, error) {
+	f.once.Do(func() {
+		f.filelist = make(map[string]string)
+		fs.WalkDir(f.fsys, ".", func(p string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if _, ok := f.filelist[path.Base(p)]; !ok && !de.IsDir() {
+				f.filelist[path.Base(p)] = p
+			}
+			return nil
+		})
+	})
+	p, ok := f.filelist[name]
+	if !ok {
+		return nil, notFound(name)
 	}
-	return nil
+	return f.fsys.Open(p)
 }
 
-func Locate(filename string) string {
-	if len(filelist) == 0 {
-		filepath.Walk(Basedir, collectFiles)
+// Map has the file contents by file name. It is meant for tests.
+type Map map[string][]byte
+
+// OpenFile returns the contents of name.
+func (m Map) OpenFile(name string) (io.ReadCloser, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, notFound(name)
 	}
-	return filelist[filename]
+	return io.NopCloser(bytes.NewReader(data)), nil
 }
@@ -0,0 +1,84 @@
+package simplefilefinder
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+type finder interface {
+	OpenFile(name string) (io.ReadCloser, error)
+}
+
+func check(t *testing.T, what string, f finder) {
+	t.Helper()
+	r, err := f.OpenFile("cmr10.tfm")
+	if err != nil {
+		t.Fatalf("%s: %s", what, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "cmr10" {
+		t.Errorf("%s: read %q, %v", what, data, err)
+	}
+	if _, err = f.OpenFile("cmr12.tfm"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%s: want fs.ErrNotExist, got %v", what, err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "fonts", "tfm")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "cmr10.tfm"), []byte("cmr10"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "Dir", NewDir(dir))
+
+	Basedir = dir
+	if p := Locate("cmr10.tfm"); p != filepath.Join(sub, "cmr10.tfm") {
+		t.Errorf("Locate: unexpected path %q", p)
+	}
+	Basedir = sub
+	if p := Locate("cmr10.tfm"); p != filepath.Join(sub, "cmr10.tfm") || Locate("cmr12.tfm") != "" {
+		t.Errorf("Locate in the new Basedir: unexpected path %q", p)
+	}
+	Basedir = ""
+}
+
+func TestFS(t *testing.T) {
+	check(t, "FS", NewFS(fstest.MapFS{
+		"fonts/tfm/cmr10.tfm": {Data: []byte("cmr10")},
+		"README":              {Data: []byte("readme")},
+	}))
+}
+
+func TestZip(t *testing.T) {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create("fonts/tfm/cmr10.tfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("cmr10"))
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := NewZip(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "Zip", z)
+}
+
+func TestMap(t *testing.T) {
+	check(t, "Map", Map{"cmr10.tfm": []byte("cmr10")})
+}
@@ -0,0 +1,214 @@
+package tfm
+
+import (
+	"errors"
+)
+
+// ErrLigatureLoop is returned by Shape if the lig/kern program does not
+// terminate.
+var ErrLigatureLoop = errors.New("infinite ligature loop")
+
+// stop_flag and kern_flag of TeX §545.
+const (
+	stopFlag = 128
+	kernFlag = 128
+)
+
+// Item is a character or a kern, the result of Shape.
+type Item struct {
+	Code int     // the character code or -1 if the item is a kern
+	Kern FixWord // the kern if Code is -1
+}
+
+// IsKern reports whether the item is a kern.
+func (it Item) IsKern() bool {
+	return it.Code < 0
+}
+
+// BoundaryChar returns the right boundary character of the font. The
+// second return value is false if the font has no right boundary
+// character.
+func (f *Font) BoundaryChar() (int, bool) {
+	if len(f.LigKern) > 0 && f.LigKern[0].Skip == 255 {
+		return int(f.LigKern[0].Next), true
+	}
+	return 0, false
+}
+
+// leftBoundary returns the start of the lig/kern program for the left
+// boundary.
+func (f *Font) leftBoundary() (int, bool) {
+	if len(f.LigKern) > 0 {
+		lk := f.LigKern[len(f.LigKern)-1]
+		if lk.Skip == 255 {
+			return 256*int(lk.Op) + int(lk.Remainder), true
+		}
+	}
+	return 0, false
+}
+
+// ligKernStart returns the first instruction of the lig/kern program of
+// character c.
+func (f *Font) ligKernStart(c int) (int, bool) {
+	ci, ok := f.info(c)
+	if !ok || ci.Tag != LigTag {
+		return 0, false
+	}
+	i := int(ci.Remainder)
+	if lk := f.LigKern[i]; lk.Skip > stopFlag {
+		i = 256*int(lk.Op) + int(lk.Remainder)
+	}
+	return i, true
+}
+
+// lookup searches the program starting at instruction i for the
+// character right.
+func (f *Font) lookup(i, right int) (LigKern, bool) {
+	for i < len(f.LigKern) {
+		lk := f.LigKern[i]
+		if int(lk.Next) == right && lk.Skip <= stopFlag {
+			return lk, true
+		}
+		if lk.Skip >= stopFlag {
+			break
+		}
+		i += int(lk.Skip) + 1
+	}
+	return LigKern{}, false
+}
+
+// LigKernFor returns the instruction for the character pair left, right.
+// The second return value is false if there is no ligature or kern for
+// the pair.
+func (f *Font) LigKernFor(left, right int) (LigKern, bool) {
+	i, ok := f.ligKernStart(left)
+	if !ok {
+		return LigKern{}, false
+	}
+	return f.lookup(i, right)
+}
+
+// KernValue returns the kern of a kern instruction.
+func (f *Font) KernValue(lk LigKern) FixWord {
+	return f.Kern[256*int(lk.Op-kernFlag)+int(lk.Remainder)]
+}
+
+// Shape applies the ligature and kerning program of the font to the
+// character codes in text like TeX does for a word. If boundary is true
+// the left and right boundary programs of the font take part, as TeX
+// does at the beginning and the end of a word. Characters that are not in
+// the font are passed through.
+func (f *Font) Shape(text []int, boundary bool) ([]Item, error) {
+	const (
+		none  = -1 // no left character (yet)
+		right = -2 // the right boundary marker in the queue
+	)
+	var out []Item
+	queue := append([]int{}, text...)
+	bchar, hasBchar := f.BoundaryChar()
+	if boundary && hasBchar {
+		queue = append(queue, right)
+	}
+
+	cur := none
+	// start is the lig/kern program of the current character, the left
+	// boundary program is used for cur == none.
+	start, hasProgram := -1, false
+	if lb, ok := f.leftBoundary(); ok && boundary {
+		start, hasProgram = lb, true
+	}
+	setCur := func(c int) {
+		cur = c
+		start, hasProgram = f.ligKernStart(c)
+	}
+	emit := func() {
+		if cur != none {
+			out = append(out, Item{Code: cur})
+		}
+	}
+	// Every step either consumes a character from the queue or changes one
+	// of the characters, a ligature loop repeats the same pairs forever.
+	maxSteps := 10*(len(queue)+1) + 10*len(f.LigKern)
+	for steps := 0; ; steps++ {
+		if steps > maxSteps {
+			return out, ErrLigatureLoop
+		}
+		if cur == none && !hasProgram {
+			if len(queue) == 0 || queue[0] == right {
+				return out, nil
+			}
+			setCur(queue[0])
+			queue = queue[1:]
+			continue
+		}
+		if len(queue) == 0 {
+			emit()
+			return out, nil
+		}
+		r := queue[0]
+		rcode := r
+		if r == right {
+			rcode = bchar
+		}
+		var lk LigKern
+		ok := false
+		if hasProgram {
+			lk, ok = f.lookup(start, rcode)
+		}
+		if !ok {
+			emit()
+			if r == right {
+				return out, nil
+			}
+			setCur(r)
+			queue = queue[1:]
+			continue
+		}
+		if lk.Op >= kernFlag {
+			emit()
+			out = append(out, Item{Code: -1, Kern: f.KernValue(lk)})
+			if r == right {
+				return out, nil
+			}
+			setCur(r)
+			queue = queue[1:]
+			continue
+		}
+		lig := int(lk.Remainder)
+		switch lk.Op {
+		case 0: // =:
+			queue = queue[1:]
+			setCur(lig)
+		case 1: // =:|
+			setCur(lig)
+		case 2: // |=:
+			queue[0] = lig
+		case 3: // |=:|
+			queue = append([]int{lig}, queue...)
+		case 5: // =:|>
+			setCur(lig)
+			emit()
+			setCur(queue[0])
+			queue = queue[1:]
+		case 6: // |=:>
+			queue[0] = lig
+			emit()
+			setCur(queue[0])
+			queue = queue[1:]
+		case 7: // |=:|>
+			emit()
+			setCur(lig)
+		case 11: // |=:|>>
+			emit()
+			setCur(lig)
+			emit()
+			setCur(queue[0])
+			queue = queue[1:]
+		default:
+			return out, bad("ligature op %d", lk.Op)
+		}
+		if cur == right {
+			return out, nil
+		}
+	}
+}
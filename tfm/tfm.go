@@ -0,0 +1,578 @@
+// Package tfm reads TeX font metric files.
+//
+// The format is described in section 539ff of TeX: The Program and in
+// TFtoPL. All tables are kept as they are stored in the file, the
+// accessor methods resolve the indices of the char_info words.
+//
+// The Japanese font metrics (JFM) of pTeX are read as well. In a JFM file
+// the char_info words belong to char types instead of characters, a table
+// maps the character codes to their type.
+package tfm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ErrBadTFM is wrapped by all errors that are caused by an invalid TFM file.
+var ErrBadTFM = errors.New("TFM file is bad")
+
+// ErrBadSize is wrapped by the errors of CheckSize.
+var ErrBadSize = errors.New("bad font size")
+
+// A FixWord is a 32 bit fixed point number with 20 bits after the binary
+// point. Dimensions in TFM files are given in units of the design size.
+type FixWord int32
+
+// Float64 returns f as a floating point number.
+func (f FixWord) Float64() float64 {
+	return float64(f) / (1 << 20)
+}
+
+func (f FixWord) String() string {
+	return fmt.Sprintf("%g", f.Float64())
+}
+
+// Tag tells how the remainder field of a char_info word is used.
+type Tag uint8
+
+const (
+	NoTag   Tag = iota // the remainder is unused
+	LigTag             // the remainder points into the lig/kern program
+	ListTag            // the remainder is the next larger character
+	ExtTag             // the remainder points into the extensible table
+)
+
+// CharInfo is the char_info word of a character.
+type CharInfo struct {
+	WidthIndex  uint8 // 0 if the character does not exist
+	HeightIndex uint8
+	DepthIndex  uint8
+	ItalicIndex uint8
+	Tag         Tag
+	Remainder   uint8
+}
+
+// LigKern is an instruction of the lig/kern program.
+type LigKern struct {
+	Skip      uint8
+	Next      uint8
+	Op        uint8
+	Remainder uint8
+}
+
+// Extensible is an extensible recipe. Zero means the piece is absent,
+// except for Rep which is always present.
+type Extensible struct {
+	Top, Mid, Bot, Rep uint8
+}
+
+// Ids of JFM files, the first halfword of the file.
+const (
+	JFMYoko = 11 // horizontal typesetting
+	JFMTate = 9  // vertical typesetting
+)
+
+// Font is the contents of a TFM file.
+type Font struct {
+	JFM          int      // JFMYoko or JFMTate for JFM files, 0 for TFM files
+	Header       []uint32 // all header words including the ones below
+	Checksum     uint32
+	DesignSize   FixWord // in points
+	CodingScheme string  // empty if the header is too short
+	Family       string  // empty if the header is too short
+	SevenBitSafe bool
+	Face         uint8
+
+	BC, EC   int        // smallest and largest character code
+	CharInfo []CharInfo // for the characters BC to EC
+	Width    []FixWord
+	Height   []FixWord
+	Depth    []FixWord
+	Italic   []FixWord
+	LigKern  []LigKern
+	Kern     []FixWord
+	Exten    []Extensible
+	Params   []FixWord // Params[0] is parameter 1 (slant)
+
+	// JFM files only: BC to EC are char types, the lig/kern program works
+	// on char types and its ligature instructions refer to Glue.
+	CharTypes map[int]int // character code -> char type, other characters have type 0
+	Glue      []FixWord   // width, stretch and shrink of each glue
+}
+
+// Char holds the metrics of a character.
+type Char struct {
+	Code      int
+	Width     FixWord
+	Height    FixWord
+	Depth     FixWord
+	Italic    FixWord
+	Tag       Tag
+	Remainder int
+}
+
+// Parameter numbers for Param.
+const (
+	Slant = iota + 1
+	Space
+	SpaceStretch
+	SpaceShrink
+	XHeight
+	Quad
+	ExtraSpace
+)
+
+// Parse reads a TFM file.
+func Parse(r io.Reader) (*Font, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+func bad(format string, a ...interface{}) error {
+	return fmt.Errorf("%w (%s)", ErrBadTFM, fmt.Sprintf(format, a...))
+}
+
+func word(data []byte, i int) uint32 {
+	return uint32(data[i])<<24 | uint32(data[i+1])<<16 | uint32(data[i+2])<<8 | uint32(data[i+3])
+}
+
+// bcpl returns the string at the beginning of b which starts with its
+// length.
+func bcpl(b []byte) string {
+	n := int(b[0])
+	if n >= len(b) {
+		n = len(b) - 1
+	}
+	return string(b[1 : n+1])
+}
+
+func parse(data []byte) (*Font, error) {
+	if len(data) < 24 {
+		return nil, bad("file too short")
+	}
+	f := &Font{}
+	// a JFM file starts with its id and the number of char type entries
+	off, nt := 0, 0
+	if id := int(data[0])<<8 | int(data[1]); id == JFMYoko || id == JFMTate {
+		if len(data) < 28 {
+			return nil, bad("file too short")
+		}
+		f.JFM = id
+		off, nt = 4, int(data[2])<<8|int(data[3])
+	}
+	var l [12]int
+	for i := range l {
+		if data[off+2*i] > 127 {
+			return nil, bad("length %d is negative", i)
+		}
+		l[i] = int(data[off+2*i])<<8 | int(data[off+2*i+1])
+	}
+	lf, lh, bc, ec, nw, nh, nd, ni, nl, nk, ne, np := l[0], l[1], l[2], l[3], l[4], l[5], l[6], l[7], l[8], l[9], l[10], l[11]
+	if bc > ec+1 || ec > 255 {
+		return nil, bad("character range %d..%d", bc, ec)
+	}
+	if f.JFM != 0 && bc != 0 {
+		return nil, bad("the first char type is %d", bc)
+	}
+	if bc > 255 {
+		bc, ec = 1, 0
+	}
+	if n := 6 + off/4 + nt + lh + (ec - bc + 1) + nw + nh + nd + ni + nl + nk + ne + np; lf != n {
+		return nil, bad("lf is %d, the table lengths add up to %d", lf, n)
+	}
+	if nw == 0 || nh == 0 || nd == 0 || ni == 0 {
+		return nil, bad("empty width, height, depth or italic table")
+	}
+	if lh < 2 {
+		return nil, bad("header length is %d", lh)
+	}
+	if ne > 256 && f.JFM == 0 {
+		return nil, bad("%d extensible recipes", ne)
+	}
+	if len(data) < 4*lf {
+		return nil, bad("file has %d bytes, should be %d", len(data), 4*lf)
+	}
+
+	f.BC, f.EC = bc, ec
+	pos := 24 + off
+	hd := data[pos:]
+	for i := 0; i < lh; i++ {
+		f.Header = append(f.Header, word(data, pos))
+		pos += 4
+	}
+	f.Checksum = f.Header[0]
+	f.DesignSize = FixWord(f.Header[1])
+	if f.DesignSize < 1<<20 {
+		return nil, bad("design size %s is too small", f.DesignSize)
+	}
+	if lh >= 12 {
+		f.CodingScheme = bcpl(hd[8:48])
+	}
+	if lh >= 17 {
+		f.Family = bcpl(hd[48:68])
+	}
+	if lh >= 18 {
+		f.SevenBitSafe = hd[68] > 127
+		f.Face = hd[71]
+	}
+	if f.JFM != 0 {
+		// the code has 16 bits in pTeX, upTeX adds the third byte
+		f.CharTypes = make(map[int]int, nt)
+		for i := 0; i < nt; i++ {
+			code := int(data[pos])<<8 | int(data[pos+1]) | int(data[pos+2])<<16
+			if t := int(data[pos+3]); t > ec {
+				return nil, bad("char type %d of character %d is out of range", t, code)
+			} else if t > 0 {
+				f.CharTypes[code] = t
+			}
+			pos += 4
+		}
+	}
+
+	for c := bc; c <= ec; c++ {
+		f.CharInfo = append(f.CharInfo, CharInfo{
+			WidthIndex:  data[pos],
+			HeightIndex: data[pos+1] >> 4,
+			DepthIndex:  data[pos+1] & 15,
+			ItalicIndex: data[pos+2] >> 2,
+			Tag:         Tag(data[pos+2] & 3),
+			Remainder:   data[pos+3],
+		})
+		pos += 4
+	}
+	fixwords := func(n int, name string) ([]FixWord, error) {
+		tbl := make([]FixWord, n)
+		for i := range tbl {
+			tbl[i] = FixWord(word(data, pos))
+			if data[pos] != 0 && data[pos] != 255 {
+				return nil, bad("%s %d is too big", name, i)
+			}
+			pos += 4
+		}
+		return tbl, nil
+	}
+	var err error
+	if f.Width, err = fixwords(nw, "width"); err != nil {
+		return nil, err
+	}
+	if f.Height, err = fixwords(nh, "height"); err != nil {
+		return nil, err
+	}
+	if f.Depth, err = fixwords(nd, "depth"); err != nil {
+		return nil, err
+	}
+	if f.Italic, err = fixwords(ni, "italic correction"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < nl; i++ {
+		f.LigKern = append(f.LigKern, LigKern{data[pos], data[pos+1], data[pos+2], data[pos+3]})
+		pos += 4
+	}
+	if f.Kern, err = fixwords(nk, "kern"); err != nil {
+		return nil, err
+	}
+	if f.JFM != 0 {
+		if f.Glue, err = fixwords(ne, "glue"); err != nil {
+			return nil, err
+		}
+	} else {
+		for i := 0; i < ne; i++ {
+			f.Exten = append(f.Exten, Extensible{data[pos], data[pos+1], data[pos+2], data[pos+3]})
+			pos += 4
+		}
+	}
+	for i := 0; i < np; i++ {
+		// the slant is not a dimension and may be arbitrary large
+		f.Params = append(f.Params, FixWord(word(data, pos)))
+		if i > 0 && data[pos] != 0 && data[pos] != 255 {
+			return nil, bad("parameter %d is too big", i+1)
+		}
+		pos += 4
+	}
+	if err = f.check(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// check makes sure that all indices point into the tables.
+func (f *Font) check() error {
+	if f.Width[0] != 0 || f.Height[0] != 0 || f.Depth[0] != 0 || f.Italic[0] != 0 {
+		return bad("the first width, height, depth or italic correction is not zero")
+	}
+	for i, ci := range f.CharInfo {
+		c := f.BC + i
+		if ci.WidthIndex == 0 {
+			continue
+		}
+		if int(ci.WidthIndex) >= len(f.Width) || int(ci.HeightIndex) >= len(f.Height) ||
+			int(ci.DepthIndex) >= len(f.Depth) || int(ci.ItalicIndex) >= len(f.Italic) {
+			return bad("character %d has an index out of range", c)
+		}
+		switch ci.Tag {
+		case LigTag:
+			if int(ci.Remainder) >= len(f.LigKern) {
+				return bad("lig/kern index of character %d is out of range", c)
+			}
+		case ListTag:
+			if f.JFM != 0 {
+				return bad("char type %d has a character list", c)
+			}
+			if !f.Exists(int(ci.Remainder)) {
+				return bad("character list link of character %d to nonexistent character %d", c, ci.Remainder)
+			}
+		case ExtTag:
+			if int(ci.Remainder) >= len(f.Exten) {
+				return bad("extensible index of character %d is out of range", c)
+			}
+		}
+	}
+	for c, t := range f.CharTypes {
+		if c < 0 || c > 0xffffff || t < 0 || t > f.EC {
+			return bad("char type %d of character %d is out of range", t, c)
+		}
+	}
+	if f.JFM != 0 && len(f.Glue)%3 != 0 {
+		return bad("the number of glue words is not a multiple of 3")
+	}
+	for i, lk := range f.LigKern {
+		if lk.Op >= 128 && lk.Skip <= 128 && 256*int(lk.Op-128)+int(lk.Remainder) >= len(f.Kern) {
+			return bad("kern index in lig/kern instruction %d is out of range", i)
+		}
+		if f.JFM != 0 && lk.Op < 128 && lk.Skip <= 128 && 3*(256*int(lk.Op)+int(lk.Remainder))+2 >= len(f.Glue) {
+			return bad("glue index in lig/kern instruction %d is out of range", i)
+		}
+	}
+	return nil
+}
+
+// CharType returns the char type of the character c in a JFM file. For
+// TFM files it returns c.
+func (f *Font) CharType(c int) int {
+	if f.JFM == 0 {
+		return c
+	}
+	return f.CharTypes[c]
+}
+
+// info returns the char_info word of the character c.
+func (f *Font) info(c int) (CharInfo, bool) {
+	c = f.CharType(c)
+	if c < f.BC || c > f.EC || f.CharInfo[c-f.BC].WidthIndex == 0 {
+		return CharInfo{}, false
+	}
+	return f.CharInfo[c-f.BC], true
+}
+
+// Exists reports whether the character c is in the font.
+func (f *Font) Exists(c int) bool {
+	_, ok := f.info(c)
+	return ok
+}
+
+// Char returns the metrics of the character c. The second return value
+// is false if c is not in the font.
+func (f *Font) Char(c int) (Char, bool) {
+	ci, ok := f.info(c)
+	if !ok {
+		return Char{}, false
+	}
+	return Char{
+		Code:      c,
+		Width:     f.Width[ci.WidthIndex],
+		Height:    f.Height[ci.HeightIndex],
+		Depth:     f.Depth[ci.DepthIndex],
+		Italic:    f.Italic[ci.ItalicIndex],
+		Tag:       ci.Tag,
+		Remainder: int(ci.Remainder),
+	}, true
+}
+
+// Param returns font parameter n (1 is the slant). Parameters not in the
+// file are zero.
+func (f *Font) Param(n int) FixWord {
+	if n < 1 || n > len(f.Params) {
+		return 0
+	}
+	return f.Params[n-1]
+}
+
+// CheckSize returns an error wrapping ErrBadSize unless z is a font size
+// (in DVI units) that TeX accepts: positive and less than 2048pt.
+func CheckSize(z int) error {
+	if z <= 0 || z >= 1<<27 {
+		return fmt.Errorf("%w (%d)", ErrBadSize, z)
+	}
+	return nil
+}
+
+// Scale converts fw to DVI units for a font at size z (in DVI units) with
+// the same arithmetic TeX uses, so the results agree exactly. If z is
+// rejected by CheckSize, Scale returns 0.
+func Scale(fw FixWord, z int) int {
+	if CheckSize(z) != nil {
+		return 0
+	}
+	alpha := 16
+	for z >= 040000000 {
+		z = z / 2
+		alpha = alpha + alpha
+	}
+	beta := 256 / alpha
+	alpha = alpha * z
+	b0, b1, b2, b3 := int(uint32(fw)>>24), int(uint32(fw)>>16&255), int(uint32(fw)>>8&255), int(uint32(fw)&255)
+	sw := (((((b3 * z) / 0400) + (b2 * z)) / 0400) + (b1 * z)) / beta
+	if b0 == 255 {
+		sw -= alpha
+	}
+	return sw
+}
+
+// Write writes f in TFM format. The header words are taken from Header,
+// but Checksum, DesignSize, CodingScheme, Family, SevenBitSafe and Face
+// take precedence.
+func (f *Font) Write(w io.Writer) error {
+	switch {
+	case len(f.Width) == 0 || len(f.Height) == 0 || len(f.Depth) == 0 || len(f.Italic) == 0:
+		return bad("empty width, height, depth or italic table")
+	case len(f.Width) > 256 || len(f.Height) > 16 || len(f.Depth) > 16 || len(f.Italic) > 64:
+		return bad("too many widths, heights, depths or italic corrections")
+	case len(f.Exten) > 256:
+		return bad("%d extensible recipes", len(f.Exten))
+	case f.JFM != 0 && len(f.Exten) > 0:
+		return bad("extensible recipes in a JFM file")
+	case len(f.CharInfo) != f.EC-f.BC+1:
+		return bad("%d char_info words for the characters %d..%d", len(f.CharInfo), f.BC, f.EC)
+	}
+	if err := f.check(); err != nil {
+		return err
+	}
+	lh := len(f.Header)
+	if lh < 2 {
+		lh = 2
+	}
+	if f.CodingScheme != "" && lh < 12 {
+		lh = 12
+	}
+	if f.Family != "" && lh < 17 {
+		lh = 17
+	}
+	if (f.SevenBitSafe || f.Face != 0) && lh < 18 {
+		lh = 18
+	}
+	header := make([]byte, 4*lh)
+	for i, h := range f.Header {
+		putWord(header[4*i:], h)
+	}
+	putWord(header, f.Checksum)
+	putWord(header[4:], uint32(f.DesignSize))
+	if f.CodingScheme != "" {
+		putBCPL(header[8:48], f.CodingScheme)
+	}
+	if f.Family != "" {
+		putBCPL(header[48:68], f.Family)
+	}
+	if lh >= 18 {
+		header[68] &= 0x7f
+		if f.SevenBitSafe {
+			header[68] |= 0x80
+		}
+		header[71] = f.Face
+	}
+
+	bc, ec := f.BC, f.EC
+	if ec < bc {
+		bc, ec = 1, 0
+	}
+	ne := len(f.Exten)
+	var types []byte
+	if f.JFM != 0 {
+		ne = len(f.Glue)
+		types = f.charTypes()
+	}
+	lengths := []int{0, lh, bc, ec, len(f.Width), len(f.Height), len(f.Depth), len(f.Italic), len(f.LigKern), len(f.Kern), ne, len(f.Params)}
+	lengths[0] = 6 + lh + ec - bc + 1 + len(types)/4
+	for _, l := range lengths[4:] {
+		lengths[0] += l
+	}
+	if f.JFM != 0 {
+		lengths[0]++
+		lengths = append([]int{f.JFM, len(types) / 4}, lengths...)
+	}
+	data := make([]byte, 0, 4*lengths[0])
+	for _, l := range lengths {
+		if l > 0x7fff {
+			return bad("table too long")
+		}
+		data = append(data, byte(l>>8), byte(l))
+	}
+	data = append(data, header...)
+	data = append(data, types...)
+	quad := func(x uint32) {
+		data = append(data, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+	}
+	for _, ci := range f.CharInfo {
+		data = append(data, ci.WidthIndex, ci.HeightIndex<<4|ci.DepthIndex, ci.ItalicIndex<<2|byte(ci.Tag), ci.Remainder)
+	}
+	for _, tbl := range [][]FixWord{f.Width, f.Height, f.Depth, f.Italic} {
+		for _, x := range tbl {
+			quad(uint32(x))
+		}
+	}
+	for _, lk := range f.LigKern {
+		data = append(data, lk.Skip, lk.Next, lk.Op, lk.Remainder)
+	}
+	for _, x := range f.Kern {
+		quad(uint32(x))
+	}
+	for _, e := range f.Exten {
+		data = append(data, e.Top, e.Mid, e.Bot, e.Rep)
+	}
+	for _, x := range f.Glue {
+		quad(uint32(x))
+	}
+	for _, x := range f.Params {
+		quad(uint32(x))
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// charTypes returns the char_type table of a JFM file. The first entry is
+// for the characters of type 0.
+func (f *Font) charTypes() []byte {
+	codes := make([]int, 0, len(f.CharTypes))
+	for c, t := range f.CharTypes {
+		if t != 0 {
+			codes = append(codes, c)
+		}
+	}
+	sort.Ints(codes)
+	b := make([]byte, 4, 4*(len(codes)+1))
+	for _, c := range codes {
+		b = append(b, byte(c>>8), byte(c), byte(c>>16), byte(f.CharTypes[c]))
+	}
+	return b
+}
+
+func putWord(b []byte, x uint32) {
+	b[0], b[1], b[2], b[3] = byte(x>>24), byte(x>>16), byte(x>>8), byte(x)
+}
+
+// putBCPL stores s with a leading length byte in b.
+func putBCPL(b []byte, s string) {
+	if len(s) >= len(b) {
+		s = s[:len(b)-1]
+	}
+	for i := range b {
+		b[i] = 0
+	}
+	b[0] = byte(len(s))
+	copy(b[1:], s)
+}
@@ -0,0 +1,317 @@
+package tfm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func fw(f float64) FixWord {
+	return FixWord(f * (1 << 20))
+}
+
+// encode returns f in TFM format.
+func encode(f *Font) []byte {
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+// testFont has the characters A, B and C. A is followed by a kern if
+// the next character is B, AC is a ligature (B).
+func testFont() *Font {
+	return &Font{
+		Checksum:     0x12345678,
+		DesignSize:   fw(10),
+		CodingScheme: "TEX test",
+		Family:       "TEST",
+		SevenBitSafe: true,
+		Face:         10,
+		BC:           'A',
+		EC:           'C',
+		CharInfo: []CharInfo{
+			{WidthIndex: 1, HeightIndex: 1, DepthIndex: 0, ItalicIndex: 0, Tag: LigTag, Remainder: 0},
+			{WidthIndex: 2, HeightIndex: 1, DepthIndex: 1, ItalicIndex: 1},
+			{WidthIndex: 1, HeightIndex: 1},
+		},
+		Width:  []FixWord{0, fw(0.5), fw(0.75)},
+		Height: []FixWord{0, fw(0.7)},
+		Depth:  []FixWord{0, fw(0.2)},
+		Italic: []FixWord{0, fw(0.05)},
+		LigKern: []LigKern{
+			{Skip: 0, Next: 'B', Op: 128, Remainder: 0},
+			{Skip: 128, Next: 'C', Op: 0, Remainder: 'B'},
+		},
+		Kern:   []FixWord{fw(-0.1)},
+		Params: []FixWord{0, fw(0.333), fw(0.166), fw(0.111), fw(0.43), fw(1), fw(0.111)},
+	}
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(bytes.NewReader(encode(testFont())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Checksum != 0x12345678 || f.DesignSize != fw(10) {
+		t.Errorf("checksum %x, design size %s", f.Checksum, f.DesignSize)
+	}
+	if f.CodingScheme != "TEX test" || f.Family != "TEST" || !f.SevenBitSafe || f.Face != 10 {
+		t.Errorf("coding scheme %q, family %q, seven bit safe %t, face %d", f.CodingScheme, f.Family, f.SevenBitSafe, f.Face)
+	}
+	c, ok := f.Char('B')
+	if !ok {
+		t.Fatal("B should exist")
+	}
+	if c.Width != fw(0.75) || c.Height != fw(0.7) || c.Depth != fw(0.2) || c.Italic != fw(0.05) {
+		t.Errorf("unexpected metrics for B: %+v", c)
+	}
+	if _, ok := f.Char('D'); ok {
+		t.Error("D should not exist")
+	}
+	if f.Param(Quad) != fw(1) || f.Param(20) != 0 {
+		t.Errorf("quad is %s", f.Param(Quad))
+	}
+}
+
+func TestParseBad(t *testing.T) {
+	good := encode(testFont())
+	// the header has 18 words, so the char_info words start at 96, the
+	// widths at 108 and the heights at 120
+	patch := func(pos int, b byte) []byte {
+		data := append([]byte{}, good...)
+		data[pos] = b
+		return data
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated":      good[:len(good)-4],
+		"wrong length":   patch(1, good[1]+1),
+		"width not zero": patch(111, 1),
+		"height too big": patch(124, 17),
+		"bad index":      patch(104, 3),
+	} {
+		if _, err := Parse(bytes.NewReader(data)); !errors.Is(err, ErrBadTFM) {
+			t.Errorf("%s: want ErrBadTFM, got %v", name, err)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	f, err := Parse(bytes.NewReader(encode(testFont())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Checksum = 1
+	f.Family = "OTHER"
+	f.Face = 0
+	var b bytes.Buffer
+	if err = f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Checksum != 1 || g.Family != "OTHER" || g.Face != 0 || !g.SevenBitSafe || g.CodingScheme != "TEX test" {
+		t.Errorf("checksum %x, family %q, face %d, seven bit safe %t, coding scheme %q", g.Checksum, g.Family, g.Face, g.SevenBitSafe, g.CodingScheme)
+	}
+	bad := testFont()
+	bad.Height = make([]FixWord, 17)
+	if err = bad.Write(&b); !errors.Is(err, ErrBadTFM) {
+		t.Errorf("want ErrBadTFM for 17 heights, got %v", err)
+	}
+}
+
+func TestJFM(t *testing.T) {
+	jfm := &Font{
+		JFM:        JFMTate,
+		DesignSize: fw(10),
+		BC:         0,
+		EC:         1,
+		CharInfo: []CharInfo{
+			{WidthIndex: 1, HeightIndex: 1, DepthIndex: 1, Tag: LigTag},
+			{WidthIndex: 2, HeightIndex: 1, DepthIndex: 1},
+		},
+		Width:     []FixWord{0, fw(1), fw(0.5)},
+		Height:    []FixWord{0, fw(0.88)},
+		Depth:     []FixWord{0, fw(0.12)},
+		Italic:    []FixWord{0},
+		LigKern:   []LigKern{{Skip: 128, Next: 1, Op: 0, Remainder: 0}},
+		CharTypes: map[int]int{0x3001: 1, 0x3002: 1, 0x1f600: 1},
+		Glue:      []FixWord{fw(0.5), 0, fw(0.5)},
+		Params:    []FixWord{0, 0, fw(0.1), 0, fw(1), fw(1)},
+	}
+	f, err := Parse(bytes.NewReader(encode(jfm)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.JFM != JFMTate || len(f.Glue) != 3 || len(f.CharTypes) != 3 {
+		t.Fatalf("unexpected JFM %+v", f)
+	}
+	for code, w := range map[int]FixWord{0x3042: fw(1), 0x3001: fw(0.5), 0x1f600: fw(0.5)} {
+		c, ok := f.Char(code)
+		if !ok || c.Width != w || c.Code != code {
+			t.Errorf("character %x: want width %s, got %+v", code, w, c)
+		}
+	}
+	if f.CharType(0x3002) != 1 || f.CharType('A') != 0 {
+		t.Errorf("char types %d and %d", f.CharType(0x3002), f.CharType('A'))
+	}
+	bad := encode(jfm)
+	bad[4*(7+1+1)+3] = 2 // first char type entry after the header
+	if _, err = Parse(bytes.NewReader(bad)); !errors.Is(err, ErrBadTFM) {
+		t.Errorf("want ErrBadTFM for char type 2, got %v", err)
+	}
+	jfm.Glue = []FixWord{fw(0.5), 0, fw(0.5), fw(0.5)}
+	if err = jfm.Write(io.Discard); !errors.Is(err, ErrBadTFM) {
+		t.Errorf("want ErrBadTFM for 4 glue words, got %v", err)
+	}
+	jfm.Glue = jfm.Glue[:3]
+	jfm.LigKern[0].Remainder = 1
+	if err = jfm.Write(io.Discard); !errors.Is(err, ErrBadTFM) {
+		t.Errorf("want ErrBadTFM for glue index 1, got %v", err)
+	}
+}
+
+func TestScale(t *testing.T) {
+	testdata := []struct {
+		fw  FixWord
+		z   int
+		exp int
+	}{
+		{fw(0.5), 655360, 327680},
+		{fw(-0.1), 655360, -65536},
+		{fw(0.75), 10 * 655360, 4915200},
+		{0x5555, 655360, 13653},
+	}
+	for _, td := range testdata {
+		if res := Scale(td.fw, td.z); res != td.exp {
+			t.Errorf("Scale(%d, %d): should be %d, but is %d", td.fw, td.z, td.exp, res)
+		}
+	}
+	for _, z := range []int{0, -655360, 1 << 27, 1 << 28} {
+		if err := CheckSize(z); !errors.Is(err, ErrBadSize) {
+			t.Errorf("CheckSize(%d): want ErrBadSize, got %v", z, err)
+		}
+		if res := Scale(fw(0.5), z); res != 0 {
+			t.Errorf("Scale(0.5, %d): should be 0, but is %d", z, res)
+		}
+	}
+	if err := CheckSize(1<<27 - 1); err != nil {
+		t.Error(err)
+	}
+}
+
+// ligFont returns a font with the characters 1 to 9 and a lig/kern
+// program for character 1 that has the instruction lk for character 2.
+func ligFont(lk ...LigKern) *Font {
+	f := &Font{
+		BC:     1,
+		EC:     9,
+		Width:  []FixWord{0, fw(0.5)},
+		Height: []FixWord{0},
+		Depth:  []FixWord{0},
+		Italic: []FixWord{0},
+		Kern:   []FixWord{fw(0.25)},
+	}
+	for c := 1; c <= 9; c++ {
+		f.CharInfo = append(f.CharInfo, CharInfo{WidthIndex: 1})
+	}
+	f.CharInfo[0].Tag = LigTag
+	f.LigKern = lk
+	return f
+}
+
+func shape(t *testing.T, f *Font, boundary bool, text ...int) []Item {
+	items, err := f.Shape(text, boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func chars(codes ...int) []Item {
+	var items []Item
+	for _, c := range codes {
+		items = append(items, Item{Code: c})
+	}
+	return items
+}
+
+func TestShapeKern(t *testing.T) {
+	f := testFont()
+	exp := []Item{{Code: 'A'}, {Code: -1, Kern: fw(-0.1)}, {Code: 'B'}}
+	if res := shape(t, f, false, 'A', 'B'); !reflect.DeepEqual(res, exp) {
+		t.Errorf("AB: should be %v, but is %v", exp, res)
+	}
+	if res := shape(t, f, false, 'A', 'C', 'A'); !reflect.DeepEqual(res, chars('B', 'A')) {
+		t.Errorf("ACA: should be BA, but is %v", res)
+	}
+	if lk, ok := f.LigKernFor('A', 'B'); !ok || f.KernValue(lk) != fw(-0.1) {
+		t.Errorf("LigKernFor(A, B) = %v, %t", lk, ok)
+	}
+}
+
+func TestShapeLigatureOps(t *testing.T) {
+	testdata := []struct {
+		op  uint8
+		exp []Item
+	}{
+		{0, chars(5, 3)},        // =:
+		{1, chars(5, 2, 3)},     // =:|
+		{2, chars(1, 5, 3)},     // |=:
+		{3, chars(1, 5, 2, 3)},  // |=:|
+		{5, chars(5, 2, 3)},     // =:|>
+		{6, chars(1, 5, 3)},     // |=:>
+		{7, chars(1, 5, 2, 3)},  // |=:|>
+		{11, chars(1, 5, 2, 3)}, // |=:|>>
+	}
+	for _, td := range testdata {
+		f := ligFont(LigKern{Skip: 128, Next: 2, Op: td.op, Remainder: 5})
+		if res := shape(t, f, false, 1, 2, 3); !reflect.DeepEqual(res, td.exp) {
+			t.Errorf("op %d: should be %v, but is %v", td.op, td.exp, res)
+		}
+	}
+}
+
+func TestShapeReprocess(t *testing.T) {
+	// 1 2 =: 1, so 1 2 2 2 becomes a single 1; 1 3 gets a kern
+	f := ligFont(
+		LigKern{Skip: 0, Next: 2, Op: 0, Remainder: 1},
+		LigKern{Skip: 128, Next: 3, Op: 128, Remainder: 0},
+	)
+	exp := []Item{{Code: 1}, {Code: -1, Kern: fw(0.25)}, {Code: 3}}
+	if res := shape(t, f, false, 1, 2, 2, 2, 3); !reflect.DeepEqual(res, exp) {
+		t.Errorf("should be %v, but is %v", exp, res)
+	}
+}
+
+func TestShapeBoundary(t *testing.T) {
+	// boundary char 9; 1 followed by the right boundary gets a kern, the
+	// left boundary followed by 2 becomes 4
+	f := ligFont(
+		LigKern{Skip: 255, Next: 9},
+		LigKern{Skip: 128, Next: 9, Op: 128, Remainder: 0},
+		LigKern{Skip: 128, Next: 2, Op: 0, Remainder: 4},
+		LigKern{Skip: 255, Op: 0, Remainder: 2},
+	)
+	f.CharInfo[0].Remainder = 1
+	exp := []Item{{Code: 4}, {Code: 1}, {Code: -1, Kern: fw(0.25)}}
+	if res := shape(t, f, true, 2, 1); !reflect.DeepEqual(res, exp) {
+		t.Errorf("should be %v, but is %v", exp, res)
+	}
+	if res := shape(t, f, false, 2, 1); !reflect.DeepEqual(res, chars(2, 1)) {
+		t.Errorf("without boundary: should be 2 1, but is %v", res)
+	}
+}
+
+func TestShapeLoop(t *testing.T) {
+	f := ligFont(LigKern{Skip: 128, Next: 2, Op: 2, Remainder: 2}) // 1 |=: 1 2 forever
+	if _, err := f.Shape([]int{1, 2}, false); err != ErrLigatureLoop {
+		t.Errorf("want ErrLigatureLoop, got %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+// Package tftopl converts TFM files to property lists (PL files) like the
+// TeXware program TFtoPL. The output can be read by PLtoTF.
+package tftopl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/speedata/gotex/tfm"
+)
+
+// font_type of TFtoPL, the names of the parameters depend on it.
+const (
+	vanilla = iota
+	mathsy
+	mathex
+)
+
+var (
+	vanillaParams = []string{"SLANT", "SPACE", "STRETCH", "SHRINK", "XHEIGHT", "QUAD", "EXTRASPACE"}
+	mathsyParams  = []string{"NUM1", "NUM2", "NUM3", "DENOM1", "DENOM2", "SUP1", "SUP2", "SUP3", "SUB1", "SUB2", "SUPDROP", "SUBDROP", "DELIM1", "DELIM2", "AXISHEIGHT"}
+	mathexParams  = []string{"DEFAULTRULETHICKNESS", "BIGOPSPACING1", "BIGOPSPACING2", "BIGOPSPACING3", "BIGOPSPACING4", "BIGOPSPACING5"}
+	ligOps        = []string{"LIG", "LIG/", "/LIG", "/LIG/", "", "LIG/>", "/LIG>", "/LIG/>", "", "", "", "/LIG/>>"}
+)
+
+// Writer writes the parts of a property list. Write puts them together
+// for a TFM file, package vftovp adds the parts of virtual fonts.
+type Writer struct {
+	w        *bufio.Writer
+	f        *tfm.Font
+	fontType int
+	level    int
+}
+
+// Write writes the property list of f to w.
+func Write(w io.Writer, f *tfm.Font) error {
+	pl := NewWriter(w, f)
+	pl.Header()
+	pl.LigTable()
+	pl.Characters(nil)
+	return pl.Flush()
+}
+
+// NewWriter returns a Writer for the property list of f.
+func NewWriter(w io.Writer, f *tfm.Font) *Writer {
+	pl := &Writer{w: bufio.NewWriter(w), f: f}
+	scheme := strings.ToUpper(f.CodingScheme)
+	if strings.HasPrefix(scheme, "TEX MATH SY") {
+		pl.fontType = mathsy
+	} else if strings.HasPrefix(scheme, "TEX MATH EX") {
+		pl.fontType = mathex
+	}
+	return pl
+}
+
+// Flush writes the buffered property list.
+func (pl *Writer) Flush() error {
+	return pl.w.Flush()
+}
+
+// Line writes an indented line.
+func (pl *Writer) Line(format string, a ...interface{}) {
+	pl.w.WriteString(strings.Repeat("   ", pl.level))
+	fmt.Fprintf(pl.w, format, a...)
+	pl.w.WriteByte('\n')
+}
+
+// Open starts a property with sub properties, Close ends it.
+func (pl *Writer) Open(format string, a ...interface{}) {
+	pl.Line("("+format, a...)
+	pl.level++
+}
+
+func (pl *Writer) Close() {
+	pl.Line(")")
+	pl.level--
+}
+
+// Fix returns a fix_word as a real number with the shortest decimal
+// representation that PLtoTF converts back to the same value (TFtoPL §40).
+func Fix(fw tfm.FixWord) string {
+	var b strings.Builder
+	b.WriteString("R ")
+	a := int(uint32(fw) >> 20)
+	f := int(uint32(fw) & 0xfffff)
+	if a > 03777 {
+		b.WriteByte('-')
+		a = 010000 - a
+		if f > 0 {
+			f = 04000000 - f
+			a--
+		}
+	}
+	fmt.Fprintf(&b, "%d.", a)
+	f = 10*f + 5
+	delta := 10
+	for {
+		if delta > 04000000 {
+			f = f + 02000000 - delta/2
+		}
+		b.WriteByte(byte('0' + f/04000000))
+		f = 10 * (f % 04000000)
+		delta *= 10
+		if f <= delta {
+			break
+		}
+	}
+	return b.String()
+}
+
+// Char returns a character code as C x for letters and digits in text
+// fonts and as octal number otherwise.
+func (pl *Writer) Char(c int) string {
+	if pl.fontType == vanilla && (c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+		return "C " + string(rune(c))
+	}
+	return fmt.Sprintf("O %o", c)
+}
+
+// bcpl returns a header string, parentheses would confuse PLtoTF.
+func bcpl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '(' || r == ')' {
+			return '/'
+		}
+		return r
+	}, strings.ToUpper(s))
+}
+
+// Header writes the header and the parameters.
+func (pl *Writer) Header() {
+	pl.header()
+	pl.params()
+}
+
+func (pl *Writer) header() {
+	f := pl.f
+	lh := len(f.Header)
+	if lh >= 17 {
+		pl.Line("(FAMILY %s)", bcpl(f.Family))
+	}
+	if lh >= 18 {
+		if face := int(f.Face); face < 18 {
+			pl.Line("(FACE F %c%c%c)", "MBL"[face/2%3], "RI"[face%2], "RCE"[face/6])
+		} else {
+			pl.Line("(FACE O %o)", face)
+		}
+	}
+	if lh >= 12 {
+		pl.Line("(CODINGSCHEME %s)", bcpl(f.CodingScheme))
+	}
+	pl.Line("(DESIGNSIZE %s)", Fix(f.DesignSize))
+	pl.Line("(COMMENT DESIGNSIZE IS IN POINTS)")
+	pl.Line("(COMMENT OTHER SIZES ARE MULTIPLES OF DESIGNSIZE)")
+	pl.Line("(CHECKSUM O %o)", f.Checksum)
+	if f.SevenBitSafe {
+		pl.Line("(SEVENBITSAFEFLAG TRUE)")
+	}
+	for i := 18; i < lh; i++ {
+		pl.Line("(HEADER D %d O %o)", i, f.Header[i])
+	}
+}
+
+func (pl *Writer) params() {
+	if len(pl.f.Params) == 0 {
+		return
+	}
+	names := vanillaParams
+	switch pl.fontType {
+	case mathsy:
+		names = append(vanillaParams, mathsyParams...)
+	case mathex:
+		names = append(vanillaParams, mathexParams...)
+	}
+	pl.Open("FONTDIMEN")
+	for i, p := range pl.f.Params {
+		if i < len(names) {
+			pl.Line("(%s %s)", names[i], Fix(p))
+		} else {
+			pl.Line("(PARAMETER D %d %s)", i+1, Fix(p))
+		}
+	}
+	pl.Close()
+}
+
+// instruction writes a lig/kern instruction.
+func (pl *Writer) instruction(lk tfm.LigKern) {
+	if lk.Op >= 128 {
+		pl.Line("(KRN %s %s)", pl.Char(int(lk.Next)), Fix(pl.f.KernValue(lk)))
+	} else if int(lk.Op) < len(ligOps) && ligOps[lk.Op] != "" {
+		pl.Line("(%s %s %s)", ligOps[lk.Op], pl.Char(int(lk.Next)), pl.Char(int(lk.Remainder)))
+	}
+}
+
+// labels returns the characters whose lig/kern programs start at each
+// instruction.
+func (pl *Writer) labels() map[int][]int {
+	f := pl.f
+	labels := make(map[int][]int)
+	for c := f.BC; c <= f.EC; c++ {
+		ci, ok := f.Char(c)
+		if !ok || ci.Tag != tfm.LigTag {
+			continue
+		}
+		i := ci.Remainder
+		if lk := f.LigKern[i]; lk.Skip > 128 {
+			i = 256*int(lk.Op) + int(lk.Remainder)
+		}
+		labels[i] = append(labels[i], c)
+	}
+	return labels
+}
+
+// LigTable writes the lig/kern program.
+func (pl *Writer) LigTable() {
+	f := pl.f
+	nl := len(f.LigKern)
+	if nl == 0 {
+		return
+	}
+	if bchar, ok := f.BoundaryChar(); ok {
+		pl.Line("(BOUNDARYCHAR %s)", pl.Char(bchar))
+	}
+	leftBoundary := -1
+	if lk := f.LigKern[nl-1]; lk.Skip == 255 {
+		leftBoundary = 256*int(lk.Op) + int(lk.Remainder)
+	}
+	labels := pl.labels()
+	pl.Open("LIGTABLE")
+	for i, lk := range f.LigKern {
+		if i == leftBoundary {
+			pl.Line("(LABEL BOUNDARYCHAR)")
+		}
+		chars := labels[i]
+		sort.Ints(chars)
+		for _, c := range chars {
+			pl.Line("(LABEL %s)", pl.Char(c))
+		}
+		if lk.Skip > 128 {
+			// boundary char or redirection, not an instruction
+			continue
+		}
+		pl.instruction(lk)
+		if lk.Skip == 128 {
+			pl.Line("(STOP)")
+		} else if lk.Skip > 0 {
+			pl.Line("(SKIP D %d)", lk.Skip)
+		}
+	}
+	pl.Close()
+}
+
+// Characters writes the characters. If packet is not nil, it is called
+// before the end of each character to add properties.
+func (pl *Writer) Characters(packet func(c int)) {
+	f := pl.f
+	for c := f.BC; c <= f.EC; c++ {
+		ch, ok := f.Char(c)
+		if !ok {
+			continue
+		}
+		ci := f.CharInfo[c-f.BC]
+		pl.Open("CHARACTER %s", pl.Char(c))
+		pl.Line("(CHARWD %s)", Fix(ch.Width))
+		if ci.HeightIndex > 0 {
+			pl.Line("(CHARHT %s)", Fix(ch.Height))
+		}
+		if ci.DepthIndex > 0 {
+			pl.Line("(CHARDP %s)", Fix(ch.Depth))
+		}
+		if ci.ItalicIndex > 0 {
+			pl.Line("(CHARIC %s)", Fix(ch.Italic))
+		}
+		switch ch.Tag {
+		case tfm.LigTag:
+			pl.Open("COMMENT")
+			i := ch.Remainder
+			if lk := f.LigKern[i]; lk.Skip > 128 {
+				i = 256*int(lk.Op) + int(lk.Remainder)
+			}
+			for i < len(f.LigKern) {
+				lk := f.LigKern[i]
+				pl.instruction(lk)
+				if lk.Skip >= 128 {
+					break
+				}
+				i += int(lk.Skip) + 1
+			}
+			pl.Close()
+		case tfm.ListTag:
+			pl.Line("(NEXTLARGER %s)", pl.Char(ch.Remainder))
+		case tfm.ExtTag:
+			e := f.Exten[ch.Remainder]
+			pl.Open("VARCHAR")
+			for _, piece := range []struct {
+				name string
+				c    uint8
+			}{{"TOP", e.Top}, {"MID", e.Mid}, {"BOT", e.Bot}} {
+				if piece.c > 0 {
+					pl.Line("(%s %s)", piece.name, pl.Char(int(piece.c)))
+				}
+			}
+			pl.Line("(REP %s)", pl.Char(int(e.Rep)))
+			pl.Close()
+		}
+		if packet != nil {
+			packet(c)
+		}
+		pl.Close()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/tftopl"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: tftopl TFMFILE [PLFILE]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		fmt.Fprintln(os.Stderr, "tftopl: Need one or two file arguments.")
+		fmt.Fprintln(os.Stderr, "Try `tftopl --help' for more information.")
+		os.Exit(1)
+	}
+	tfmfile, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer tfmfile.Close()
+	f, err := tfm.Parse(tfmfile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.Arg(0), err)
+		os.Exit(2)
+	}
+
+	var out io.Writer = os.Stdout
+	if flag.NArg() == 2 {
+		plfile, err := os.Create(flag.Arg(1))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer plfile.Close()
+		out = plfile
+	}
+	if err = tftopl.Write(out, f); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
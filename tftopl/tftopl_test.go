@@ -0,0 +1,119 @@
+package tftopl
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/speedata/gotex/tfm"
+)
+
+func fw(f float64) tfm.FixWord {
+	return tfm.FixWord(math.Round(f * (1 << 20)))
+}
+
+func TestFix(t *testing.T) {
+	testdata := []struct {
+		fw  tfm.FixWord
+		exp string
+	}{
+		{0, "R 0.0"},
+		{fw(10), "R 10.0"},
+		{fw(0.5), "R 0.5"},
+		{fw(-0.1), "R -0.1"},
+		{349526, "R 0.333334"},
+		{-1, "R -0.000001"},
+		{fw(-2), "R -2.0"},
+	}
+	for _, td := range testdata {
+		if res := Fix(td.fw); res != td.exp {
+			t.Errorf("Fix(%d): should be %q, but is %q", td.fw, td.exp, res)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	header := make([]uint32, 18)
+	f := &tfm.Font{
+		Header:       header,
+		Checksum:     0x12345678,
+		DesignSize:   fw(10),
+		CodingScheme: "TeX (test)",
+		Family:       "TEST",
+		Face:         10,
+		BC:           'A',
+		EC:           'D',
+		CharInfo: []tfm.CharInfo{
+			{WidthIndex: 1, HeightIndex: 1, Tag: tfm.LigTag, Remainder: 1},
+			{WidthIndex: 2, HeightIndex: 1, DepthIndex: 1, ItalicIndex: 1, Tag: tfm.ListTag, Remainder: 'D'},
+			{},
+			{WidthIndex: 1, Tag: tfm.ExtTag},
+		},
+		Width:  []tfm.FixWord{0, fw(0.5), fw(0.75)},
+		Height: []tfm.FixWord{0, fw(0.7)},
+		Depth:  []tfm.FixWord{0, fw(0.2)},
+		Italic: []tfm.FixWord{0, fw(0.05)},
+		LigKern: []tfm.LigKern{
+			{Skip: 255, Next: 'B'},
+			{Skip: 0, Next: 'B', Op: 128, Remainder: 0},
+			{Skip: 128, Next: 'A', Op: 2, Remainder: 'D'},
+		},
+		Kern:   []tfm.FixWord{fw(-0.1)},
+		Params: []tfm.FixWord{0, fw(0.25), 0, 0, 0, fw(1), 0, fw(3)},
+		Exten:  []tfm.Extensible{{Top: 'A', Rep: 'D'}},
+	}
+	exp := `(FAMILY TEST)
+(FACE F LRC)
+(CODINGSCHEME TEX /TEST/)
+(DESIGNSIZE R 10.0)
+(COMMENT DESIGNSIZE IS IN POINTS)
+(COMMENT OTHER SIZES ARE MULTIPLES OF DESIGNSIZE)
+(CHECKSUM O 2215053170)
+(FONTDIMEN
+   (SLANT R 0.0)
+   (SPACE R 0.25)
+   (STRETCH R 0.0)
+   (SHRINK R 0.0)
+   (XHEIGHT R 0.0)
+   (QUAD R 1.0)
+   (EXTRASPACE R 0.0)
+   (PARAMETER D 8 R 3.0)
+   )
+(BOUNDARYCHAR C B)
+(LIGTABLE
+   (LABEL C A)
+   (KRN C B R -0.1)
+   (/LIG C A C D)
+   (STOP)
+   )
+(CHARACTER C A
+   (CHARWD R 0.5)
+   (CHARHT R 0.7)
+   (COMMENT
+      (KRN C B R -0.1)
+      (/LIG C A C D)
+      )
+   )
+(CHARACTER C B
+   (CHARWD R 0.75)
+   (CHARHT R 0.7)
+   (CHARDP R 0.2)
+   (CHARIC R 0.05)
+   (NEXTLARGER C D)
+   )
+(CHARACTER C D
+   (CHARWD R 0.5)
+   (VARCHAR
+      (TOP C A)
+      (REP C D)
+      )
+   )
+`
+	var b bytes.Buffer
+	if err := Write(&b, f); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != exp {
+		t.Errorf("unexpected property list:\n%s", b.String())
+	}
+}
@@ -0,0 +1,387 @@
+package type1
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrBadCharString is wrapped by the errors for charstrings that can't
+	// be interpreted.
+	ErrBadCharString = errors.New("bad charstring")
+	// ErrNoGlyph is wrapped by the errors for glyphs that are not in the
+	// font.
+	ErrNoGlyph = errors.New("glyph not found")
+)
+
+// Op is the operator of a path segment.
+type Op int
+
+// The operators of path segments.
+const (
+	MoveTo Op = iota
+	LineTo
+	CurveTo
+	ClosePath
+)
+
+// Point is a point in character space.
+type Point struct {
+	X, Y float64
+}
+
+// Segment is a part of an outline. MoveTo and LineTo use the first point,
+// CurveTo has the two control points and the end point of a Bézier curve
+// and ClosePath has none.
+type Segment struct {
+	Op  Op
+	Pts [3]Point
+}
+
+// Glyph is the outline of a character in character space.
+type Glyph struct {
+	Name        string
+	SideBearing Point
+	Width       Point // the advance width
+	Path        []Segment
+}
+
+// Glyph interprets the charstring of the glyph name. Hints are ignored,
+// flex is drawn as two curves.
+func (f *Font) Glyph(name string) (*Glyph, error) {
+	cs, ok := f.CharStrings[name]
+	if !ok {
+		return nil, fmt.Errorf("%w (%s in %s)", ErrNoGlyph, name, f.FontName)
+	}
+	in := &interpreter{font: f, glyph: &Glyph{Name: name}}
+	if err := in.glyph1(cs, Point{}); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return in.glyph, nil
+}
+
+// interpreter runs charstrings.
+type interpreter struct {
+	font   *Font
+	glyph  *Glyph
+	stack  []float64
+	ps     []float64 // the PostScript stack between callothersubr and pop
+	cur    Point
+	offset Point // of the accent of seac
+	accent bool  // in a component of seac
+	move   bool  // the next segment starts a new subpath
+	flex   []Point
+	inFlex bool
+	done   bool
+}
+
+// glyph1 runs the charstring of a glyph with the origin at offset.
+func (in *interpreter) glyph1(cs []byte, offset Point) error {
+	in.stack, in.ps, in.flex = in.stack[:0], nil, nil
+	in.offset, in.cur = offset, offset
+	in.move, in.inFlex, in.done = true, false, false
+	return in.run(cs, 0)
+}
+
+func (in *interpreter) run(cs []byte, depth int) error {
+	if depth > 10 {
+		return fmt.Errorf("%w (subroutines nested too deeply)", ErrBadCharString)
+	}
+	for i := 0; i < len(cs) && !in.done; i++ {
+		v := int(cs[i])
+		switch {
+		case v >= 32 && v <= 246:
+			in.stack = append(in.stack, float64(v-139))
+		case v >= 247 && v <= 254:
+			if i+1 >= len(cs) {
+				return fmt.Errorf("%w (truncated number)", ErrBadCharString)
+			}
+			i++
+			if v <= 250 {
+				in.stack = append(in.stack, float64((v-247)*256+int(cs[i])+108))
+			} else {
+				in.stack = append(in.stack, float64(-(v-251)*256-int(cs[i])-108))
+			}
+		case v == 255:
+			if i+4 >= len(cs) {
+				return fmt.Errorf("%w (truncated number)", ErrBadCharString)
+			}
+			in.stack = append(in.stack, float64(int32(uint32(cs[i+1])<<24|uint32(cs[i+2])<<16|uint32(cs[i+3])<<8|uint32(cs[i+4]))))
+			i += 4
+		default:
+			op := v
+			if v == 12 {
+				if i+1 >= len(cs) {
+					return fmt.Errorf("%w (truncated escape)", ErrBadCharString)
+				}
+				i++
+				op = 32 + int(cs[i])
+			}
+			ret, err := in.operator(op, depth)
+			if err != nil || ret {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// args returns the arguments of an operator, the last n numbers on the
+// stack.
+func (in *interpreter) args(n int) ([]float64, error) {
+	if len(in.stack) < n {
+		return nil, fmt.Errorf("%w (stack underflow)", ErrBadCharString)
+	}
+	return in.stack[len(in.stack)-n:], nil
+}
+
+func (in *interpreter) segment(op Op, pts ...Point) {
+	if in.move && op != ClosePath {
+		in.glyph.Path = append(in.glyph.Path, Segment{Op: MoveTo, Pts: [3]Point{in.cur}})
+		in.move = false
+	}
+	s := Segment{Op: op}
+	copy(s.Pts[:], pts)
+	in.glyph.Path = append(in.glyph.Path, s)
+	if len(pts) > 0 {
+		in.cur = pts[len(pts)-1]
+	}
+}
+
+func (in *interpreter) rmoveto(dx, dy float64) {
+	in.cur = Point{in.cur.X + dx, in.cur.Y + dy}
+	if in.inFlex {
+		in.flex = append(in.flex, in.cur)
+		return
+	}
+	in.move = true
+}
+
+func (in *interpreter) rlineto(dx, dy float64) {
+	in.segment(LineTo, Point{in.cur.X + dx, in.cur.Y + dy})
+}
+
+func (in *interpreter) rrcurveto(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	p1 := Point{in.cur.X + dx1, in.cur.Y + dy1}
+	p2 := Point{p1.X + dx2, p1.Y + dy2}
+	p3 := Point{p2.X + dx3, p2.Y + dy3}
+	in.segment(CurveTo, p1, p2, p3)
+}
+
+// The numbers of the operators, the escaped ones are 32 + the second byte.
+const (
+	opHStem           = 1
+	opVStem           = 3
+	opVMoveTo         = 4
+	opRLineTo         = 5
+	opHLineTo         = 6
+	opVLineTo         = 7
+	opRRCurveTo       = 8
+	opClosePath       = 9
+	opCallSubr        = 10
+	opReturn          = 11
+	opHSBW            = 13
+	opEndChar         = 14
+	opRMoveTo         = 21
+	opHMoveTo         = 22
+	opVHCurveTo       = 30
+	opHVCurveTo       = 31
+	opDotSection      = 32 + 0
+	opVStem3          = 32 + 1
+	opHStem3          = 32 + 2
+	opSeac            = 32 + 6
+	opSBW             = 32 + 7
+	opDiv             = 32 + 12
+	opCallOtherSubr   = 32 + 16
+	opPop             = 32 + 17
+	opSetCurrentPoint = 32 + 33
+)
+
+// nargs has the number of arguments of the operators.
+var nargs = map[int]int{
+	opVMoveTo: 1, opRLineTo: 2, opHLineTo: 1, opVLineTo: 1, opRRCurveTo: 6,
+	opCallSubr: 1, opHSBW: 2, opRMoveTo: 2, opHMoveTo: 1, opVHCurveTo: 4,
+	opHVCurveTo: 4, opSeac: 5, opSBW: 4, opDiv: 2, opCallOtherSubr: 2,
+	opSetCurrentPoint: 2,
+}
+
+// operator executes op. It returns true for return.
+func (in *interpreter) operator(op int, depth int) (bool, error) {
+	a, err := in.args(nargs[op])
+	if err != nil {
+		return false, err
+	}
+	clear := true
+	switch op {
+	case opHStem, opVStem, opDotSection, opVStem3, opHStem3:
+		// hints
+	case opVMoveTo:
+		in.rmoveto(0, a[0])
+	case opRLineTo:
+		in.rlineto(a[0], a[1])
+	case opHLineTo:
+		in.rlineto(a[0], 0)
+	case opVLineTo:
+		in.rlineto(0, a[0])
+	case opRRCurveTo:
+		in.rrcurveto(a[0], a[1], a[2], a[3], a[4], a[5])
+	case opClosePath:
+		in.segment(ClosePath)
+		in.move = true
+	case opCallSubr:
+		n := int(a[0])
+		in.stack = in.stack[:len(in.stack)-1]
+		if n < 0 || n >= len(in.font.Subrs) {
+			return false, fmt.Errorf("%w (subroutine %d not found)", ErrBadCharString, n)
+		}
+		return false, in.run(in.font.Subrs[n], depth+1)
+	case opReturn:
+		return true, nil
+	case opHSBW:
+		in.sbw(a[0], 0, a[1], 0)
+	case opSBW:
+		in.sbw(a[0], a[1], a[2], a[3])
+	case opEndChar:
+		in.done = true
+	case opRMoveTo:
+		in.rmoveto(a[0], a[1])
+	case opHMoveTo:
+		in.rmoveto(a[0], 0)
+	case opVHCurveTo:
+		in.rrcurveto(0, a[0], a[1], a[2], a[3], 0)
+	case opHVCurveTo:
+		in.rrcurveto(a[0], 0, a[1], a[2], 0, a[3])
+	case opSeac:
+		return false, in.seac(a[0], a[1], a[2], int(a[3]), int(a[4]))
+	case opDiv:
+		if a[1] == 0 {
+			return false, fmt.Errorf("%w (division by zero)", ErrBadCharString)
+		}
+		in.stack = append(in.stack[:len(in.stack)-2], a[0]/a[1])
+		clear = false
+	case opCallOtherSubr:
+		return false, in.callOtherSubr(int(a[0]), int(a[1]))
+	case opPop:
+		if len(in.ps) == 0 {
+			return false, fmt.Errorf("%w (pop without result of callothersubr)", ErrBadCharString)
+		}
+		in.stack = append(in.stack, in.ps[len(in.ps)-1])
+		in.ps = in.ps[:len(in.ps)-1]
+		clear = false
+	case opSetCurrentPoint:
+		in.cur = Point{in.offset.X + a[0], in.offset.Y + a[1]}
+	default:
+		return false, fmt.Errorf("%w (unknown operator %d)", ErrBadCharString, op)
+	}
+	if clear {
+		in.stack = in.stack[:0]
+	}
+	return false, nil
+}
+
+// sbw sets the side bearing and the width, the widths of the components
+// of seac are ignored.
+func (in *interpreter) sbw(sbx, sby, wx, wy float64) {
+	in.cur = Point{in.offset.X + sbx, in.offset.Y + sby}
+	if !in.accent {
+		in.glyph.SideBearing = Point{sbx, sby}
+		in.glyph.Width = Point{wx, wy}
+	}
+}
+
+// callOtherSubr executes the OtherSubrs of the standard Private
+// dictionary: 0 to 2 for flex and 3 for hint replacement. The arguments
+// of the others are returned unchanged to pop.
+func (in *interpreter) callOtherSubr(n, othersubr int) error {
+	in.stack = in.stack[:len(in.stack)-2]
+	a, err := in.args(n)
+	if err != nil {
+		return err
+	}
+	in.stack = in.stack[:len(in.stack)-n]
+	switch othersubr {
+	case 0:
+		// the end of flex: the reference point and the six points of
+		// the curves were collected by rmoveto
+		if !in.inFlex || len(in.flex) != 7 {
+			return fmt.Errorf("%w (bad flex)", ErrBadCharString)
+		}
+		p := in.flex
+		in.inFlex, in.flex = false, nil
+		in.segment(CurveTo, p[1], p[2], p[3])
+		in.segment(CurveTo, p[4], p[5], p[6])
+		// for pop pop setcurrentpoint
+		in.ps = []float64{in.cur.Y - in.offset.Y, in.cur.X - in.offset.X}
+	case 1:
+		in.inFlex, in.flex = true, nil
+		// the moves of flex don't start a new subpath
+		if in.move {
+			in.glyph.Path = append(in.glyph.Path, Segment{Op: MoveTo, Pts: [3]Point{in.cur}})
+			in.move = false
+		}
+	case 2:
+	default:
+		in.ps = append(in.ps[:0], a...)
+	}
+	return nil
+}
+
+// seac draws the accented character made of the base character bchar
+// and the accent achar of the standard encoding, with the accent moved
+// by adx - asb and ady.
+func (in *interpreter) seac(asb, adx, ady float64, bchar, achar int) error {
+	if in.accent {
+		return fmt.Errorf("%w (nested seac)", ErrBadCharString)
+	}
+	var cs [2][]byte
+	for i, code := range []int{bchar, achar} {
+		var ok bool
+		if code >= 0 && code < 256 {
+			cs[i], ok = in.font.CharStrings[StandardEncoding[code]]
+		}
+		if !ok {
+			return fmt.Errorf("%w (component %d of seac not found)", ErrBadCharString, code)
+		}
+	}
+	in.accent = true
+	sbx := in.glyph.SideBearing.X
+	if err := in.glyph1(cs[0], Point{}); err != nil {
+		return err
+	}
+	if err := in.glyph1(cs[1], Point{adx - asb + sbx, ady}); err != nil {
+		return err
+	}
+	in.accent, in.done = false, true
+	return nil
+}
+
+// seac returns the base and accent character of a decrypted charstring
+// that is built with seac.
+func seac(cs []byte) (int, int, bool) {
+	var stack []int
+	for i := 0; i < len(cs); i++ {
+		v := int(cs[i])
+		switch {
+		case v >= 32 && v <= 246:
+			stack = append(stack, v-139)
+		case v >= 247 && v <= 250 && i+1 < len(cs):
+			i++
+			stack = append(stack, (v-247)*256+int(cs[i])+108)
+		case v >= 251 && v <= 254 && i+1 < len(cs):
+			i++
+			stack = append(stack, -(v-251)*256-int(cs[i])-108)
+		case v == 255 && i+4 < len(cs):
+			stack = append(stack, int(int32(uint32(cs[i+1])<<24|uint32(cs[i+2])<<16|uint32(cs[i+3])<<8|uint32(cs[i+4]))))
+			i += 4
+		case v == 12 && i+1 < len(cs):
+			i++
+			if cs[i] == 6 && len(stack) >= 2 {
+				return stack[len(stack)-2], stack[len(stack)-1], true
+			}
+			stack = stack[:0]
+		default:
+			stack = stack[:0]
+		}
+	}
+	return 0, 0, false
+}
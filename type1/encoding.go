@@ -0,0 +1,35 @@
+package type1
+
+// StandardEncoding is the StandardEncoding of PostScript, the encoding of
+// the components of seac.
+var StandardEncoding = func() [256]string {
+	var enc [256]string
+	ascii := []string{
+		"space", "exclam", "quotedbl", "numbersign", "dollar", "percent", "ampersand", "quoteright",
+		"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen", "period", "slash",
+		"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"colon", "semicolon", "less", "equal", "greater", "question", "at",
+	}
+	copy(enc[32:], ascii)
+	for c := 'A'; c <= 'Z'; c++ {
+		enc[c] = string(c)
+		enc[c+32] = string(c + 32)
+	}
+	copy(enc[91:], []string{"bracketleft", "backslash", "bracketright", "asciicircum", "underscore", "quoteleft"})
+	copy(enc[123:], []string{"braceleft", "bar", "braceright", "asciitilde"})
+	for c, name := range map[int]string{
+		161: "exclamdown", 162: "cent", 163: "sterling", 164: "fraction", 165: "yen", 166: "florin",
+		167: "section", 168: "currency", 169: "quotesingle", 170: "quotedblleft", 171: "guillemotleft",
+		172: "guilsinglleft", 173: "guilsinglright", 174: "fi", 175: "fl", 177: "endash", 178: "dagger",
+		179: "daggerdbl", 180: "periodcentered", 182: "paragraph", 183: "bullet", 184: "quotesinglbase",
+		185: "quotedblbase", 186: "quotedblright", 187: "guillemotright", 188: "ellipsis",
+		189: "perthousand", 191: "questiondown", 193: "grave", 194: "acute", 195: "circumflex",
+		196: "tilde", 197: "macron", 198: "breve", 199: "dotaccent", 200: "dieresis", 202: "ring",
+		203: "cedilla", 205: "hungarumlaut", 206: "ogonek", 207: "caron", 208: "emdash", 225: "AE",
+		227: "ordfeminine", 232: "Lslash", 233: "Oslash", 234: "OE", 235: "ordmasculine", 241: "ae",
+		245: "dotlessi", 248: "lslash", 249: "oslash", 250: "oe", 251: "germandbls",
+	} {
+		enc[c] = name
+	}
+	return enc
+}()
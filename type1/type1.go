@@ -0,0 +1,380 @@
+// Package type1 reads Type 1 fonts in PFB and PFA format as described in
+// Adobe Type 1 Font Format. It decrypts the eexec part and the
+// charstrings, interprets the charstrings into outlines and writes
+// subsets of the fonts for embedding.
+package type1
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ErrBadType1 is wrapped by the errors for files that can't be parsed.
+var ErrBadType1 = errors.New("not a Type 1 font")
+
+// The keys of the eexec and charstring encryption.
+const (
+	EexecKey      = 55665
+	CharStringKey = 4330
+)
+
+// Decrypt decrypts data that was encrypted with key.
+func Decrypt(data []byte, key uint16) []byte {
+	out := make([]byte, len(data))
+	r := key
+	for i, c := range data {
+		out[i] = c ^ byte(r>>8)
+		r = (uint16(c)+r)*52845 + 22719
+	}
+	return out
+}
+
+// Encrypt encrypts data with key.
+func Encrypt(data []byte, key uint16) []byte {
+	out := make([]byte, len(data))
+	r := key
+	for i, p := range data {
+		c := p ^ byte(r>>8)
+		out[i] = c
+		r = (uint16(c)+r)*52845 + 22719
+	}
+	return out
+}
+
+// Font is a Type 1 font.
+type Font struct {
+	FontName    string
+	FontMatrix  [6]float64  // transforms character space to text space
+	FontBBox    [4]float64  // in character space
+	ItalicAngle float64     // in degrees
+	Encoding    [256]string // the built-in encoding, empty for undefined codes
+	Subrs       [][]byte    // decrypted, without the lenIV bytes
+	CharStrings map[string][]byte
+
+	clear   []byte
+	private []byte // the decrypted eexec part
+	entries []charString
+	// the position of the number of entries of the CharStrings
+	// dictionary in private
+	countStart, countEnd int
+}
+
+// charString is an entry of the CharStrings dictionary.
+type charString struct {
+	name       string
+	start, end int // of the whole entry in private
+}
+
+// Parse reads a font in PFB or PFA format.
+func Parse(r io.Reader) (*Font, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	clear, private, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+	return newFont(clear, private)
+}
+
+// split returns the clear text part and the decrypted eexec part of a
+// PFB or PFA file.
+func split(data []byte) ([]byte, []byte, error) {
+	if len(data) > 0 && data[0] == 0x80 {
+		var clear, bin []byte
+		for len(data) >= 6 && data[0] == 0x80 && data[1] != 3 {
+			n := int(data[2]) | int(data[3])<<8 | int(data[4])<<16 | int(data[5])<<24
+			if n < 0 || 6+n > len(data) {
+				return nil, nil, fmt.Errorf("%w (segment too long)", ErrBadType1)
+			}
+			switch seg := data[6 : 6+n]; {
+			case data[1] == 2:
+				bin = append(bin, seg...)
+			case clear == nil:
+				clear = seg
+			}
+			data = data[6+n:]
+		}
+		if clear == nil || bin == nil {
+			return nil, nil, fmt.Errorf("%w (segments missing)", ErrBadType1)
+		}
+		return clear, Decrypt(bin, EexecKey), nil
+	}
+	i := bytes.Index(data, []byte("eexec"))
+	if i < 0 {
+		return nil, nil, fmt.Errorf("%w (no eexec)", ErrBadType1)
+	}
+	i += len("eexec")
+	for i < len(data) && (data[i] == '\r' || data[i] == '\n') {
+		i++
+	}
+	clear, rest := data[:i], data[i:]
+	// the encrypted part ends with zeros and cleartomark
+	if j := bytes.Index(rest, []byte("cleartomark")); j >= 0 {
+		rest = bytes.TrimRight(rest[:j], "0 \t\r\n")
+	}
+	hexdigits := bytes.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, rest)
+	if len(hexdigits)%2 == 1 {
+		hexdigits = append(hexdigits, '0')
+	}
+	bin := make([]byte, len(hexdigits)/2)
+	if _, err := hex.Decode(bin, hexdigits); err != nil {
+		return nil, nil, fmt.Errorf("%w (%s)", ErrBadType1, err)
+	}
+	return clear, Decrypt(bin, EexecKey), nil
+}
+
+var (
+	fontNameRe    = regexp.MustCompile(`/FontName\s*/(\S+)`)
+	fontMatrixRe  = regexp.MustCompile(`/FontMatrix\s*[\[{]\s*(-?[\d.eE+-]+)\s+(-?[\d.eE+-]+)\s+(-?[\d.eE+-]+)\s+(-?[\d.eE+-]+)\s+(-?[\d.eE+-]+)\s+(-?[\d.eE+-]+)`)
+	fontBBoxRe    = regexp.MustCompile(`/FontBBox\s*[\[{]\s*(-?[\d.]+)\s+(-?[\d.]+)\s+(-?[\d.]+)\s+(-?[\d.]+)`)
+	italicAngleRe = regexp.MustCompile(`/ItalicAngle\s+(-?[\d.]+)`)
+	encodingRe    = regexp.MustCompile(`dup\s+(\d+)\s*/([^\s/\[\]{}()<>]+)\s+put`)
+	lenIVRe       = regexp.MustCompile(`/lenIV\s+(-?\d+)`)
+)
+
+// numbers parses the submatches of m.
+func numbers(m [][]byte, x []float64) {
+	for i := range x {
+		x[i], _ = strconv.ParseFloat(string(m[i+1]), 64)
+	}
+}
+
+func newFont(clear, private []byte) (*Font, error) {
+	f := &Font{
+		FontMatrix: [6]float64{0.001, 0, 0, 0.001, 0, 0},
+		clear:      clear,
+		private:    private,
+	}
+	if m := fontNameRe.FindSubmatch(clear); m != nil {
+		f.FontName = string(m[1])
+	}
+	if m := fontMatrixRe.FindSubmatch(clear); m != nil {
+		numbers(m, f.FontMatrix[:])
+	}
+	if m := fontBBoxRe.FindSubmatch(clear); m != nil {
+		numbers(m, f.FontBBox[:])
+	}
+	if m := italicAngleRe.FindSubmatch(clear); m != nil {
+		f.ItalicAngle, _ = strconv.ParseFloat(string(m[1]), 64)
+	}
+	if i := bytes.Index(clear, []byte("/Encoding")); i >= 0 {
+		if bytes.HasPrefix(bytes.TrimLeft(clear[i+len("/Encoding"):], " \t\r\n"), []byte("StandardEncoding")) {
+			f.Encoding = StandardEncoding
+		} else {
+			for _, m := range encodingRe.FindAllSubmatch(clear[i:], -1) {
+				if c, err := strconv.Atoi(string(m[1])); err == nil && c < 256 {
+					f.Encoding[c] = string(m[2])
+				}
+			}
+		}
+	}
+
+	lenIV := 4
+	if m := lenIVRe.FindSubmatch(private); m != nil {
+		lenIV, _ = strconv.Atoi(string(m[1]))
+	}
+	decrypt := func(cs []byte) []byte {
+		if lenIV < 0 {
+			return cs
+		}
+		cs = Decrypt(cs, CharStringKey)
+		if len(cs) < lenIV {
+			return nil
+		}
+		return cs[lenIV:]
+	}
+	if err := f.readSubrs(decrypt); err != nil {
+		return nil, err
+	}
+	if err := f.readCharStrings(decrypt); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// token returns the next white space delimited token at pos.
+func token(b []byte, pos int) (string, int) {
+	for pos < len(b) && isSpace(b[pos]) {
+		pos++
+	}
+	start := pos
+	for pos < len(b) && !isSpace(b[pos]) {
+		pos++
+	}
+	return string(b[start:pos]), pos
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// binary reads the length, the RD token and the binary data at pos. It
+// returns the data and the position after it.
+func binary(p []byte, pos int) ([]byte, int, error) {
+	l, pos := token(p, pos)
+	n, err := strconv.Atoi(l)
+	if err != nil || n < 0 {
+		return nil, 0, fmt.Errorf("%w (bad length %q)", ErrBadType1, l)
+	}
+	_, pos = token(p, pos) // RD or -|
+	pos++                  // one space
+	if pos+n > len(p) {
+		return nil, 0, fmt.Errorf("%w (binary data too long)", ErrBadType1)
+	}
+	return p[pos : pos+n], pos + n, nil
+}
+
+// readSubrs reads the Subrs array, its entries look like
+//
+//	dup 5 23 RD <23 bytes> NP
+func (f *Font) readSubrs(decrypt func([]byte) []byte) error {
+	p := f.private
+	i := bytes.Index(p, []byte("/Subrs"))
+	if i < 0 {
+		return nil
+	}
+	_, pos := token(p, i)
+	count, pos := token(p, pos)
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%w (bad number of Subrs)", ErrBadType1)
+	}
+	f.Subrs = make([][]byte, n)
+	_, pos = token(p, pos) // array
+	for {
+		tok, next := token(p, pos)
+		if tok != "dup" {
+			return nil
+		}
+		idx, next := token(p, next)
+		k, err := strconv.Atoi(idx)
+		if err != nil || k < 0 || k >= n {
+			return fmt.Errorf("%w (bad subroutine number %q)", ErrBadType1, idx)
+		}
+		data, next, err := binary(p, next)
+		if err != nil {
+			return err
+		}
+		f.Subrs[k] = decrypt(data)
+		tok, pos = token(p, next) // NP, | or noaccess put
+		if tok == "noaccess" {
+			_, pos = token(p, pos)
+		}
+	}
+}
+
+// readCharStrings reads the CharStrings dictionary, its entries look like
+//
+//	/A 42 RD <42 bytes> ND
+func (f *Font) readCharStrings(decrypt func([]byte) []byte) error {
+	p := f.private
+	i := bytes.Index(p, []byte("/CharStrings"))
+	if i < 0 {
+		return fmt.Errorf("%w (no CharStrings)", ErrBadType1)
+	}
+	_, pos := token(p, i)
+	f.countStart = pos
+	for f.countStart < len(p) && isSpace(p[f.countStart]) {
+		f.countStart++
+	}
+	_, f.countEnd = token(p, pos)
+	j := bytes.Index(p[f.countEnd:], []byte("begin"))
+	if j < 0 {
+		return fmt.Errorf("%w (CharStrings without begin)", ErrBadType1)
+	}
+	pos = f.countEnd + j + len("begin")
+	f.CharStrings = make(map[string][]byte)
+	for {
+		start := pos
+		for start < len(p) && isSpace(p[start]) {
+			start++
+		}
+		name, next := token(p, pos)
+		if name == "end" || name == "" {
+			return nil
+		}
+		if name[0] != '/' {
+			return fmt.Errorf("%w (unexpected %q in CharStrings)", ErrBadType1, name)
+		}
+		data, next, err := binary(p, next)
+		if err != nil {
+			return fmt.Errorf("charstring %s: %w", name, err)
+		}
+		nd, end := token(p, next) // ND, |- or noaccess def
+		if nd == "noaccess" {
+			_, end = token(p, end)
+		}
+		f.CharStrings[name[1:]] = decrypt(data)
+		f.entries = append(f.entries, charString{name: name[1:], start: start, end: end})
+		pos = end
+	}
+}
+
+// Subset returns a font with the glyphs in glyphs only, together with
+// .notdef and the glyphs the accented characters are built from.
+func (f *Font) Subset(glyphs map[string]bool) (*Font, error) {
+	keep := map[string]bool{".notdef": true}
+	var names []string
+	for name := range glyphs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for len(names) > 0 {
+		name := names[0]
+		names = names[1:]
+		if keep[name] && name != ".notdef" {
+			continue
+		}
+		keep[name] = true
+		if b, a, ok := seac(f.CharStrings[name]); ok {
+			for _, code := range []int{b, a} {
+				if code >= 0 && code < 256 && StandardEncoding[code] != "" {
+					names = append(names, StandardEncoding[code])
+				}
+			}
+		}
+	}
+	kept := 0
+	for _, c := range f.entries {
+		if keep[c.name] {
+			kept++
+		}
+	}
+	var b bytes.Buffer
+	p := f.private
+	b.Write(p[:f.countStart])
+	b.WriteString(strconv.Itoa(kept))
+	if len(f.entries) == 0 {
+		b.Write(p[f.countEnd:])
+	} else {
+		b.Write(p[f.countEnd:f.entries[0].start])
+		for _, c := range f.entries {
+			if keep[c.name] {
+				b.Write(p[c.start:c.end])
+				b.WriteByte('\n')
+			}
+		}
+		b.Write(p[f.entries[len(f.entries)-1].end:])
+	}
+	return newFont(f.clear, b.Bytes())
+}
+
+// FontFile returns the clear text part of the font and the encrypted
+// eexec part, as needed for a FontFile stream in PDF. The zeros and
+// cleartomark at the end are not included.
+func (f *Font) FontFile() ([]byte, []byte) {
+	return f.clear, Encrypt(f.private, EexecKey)
+}
@@ -0,0 +1,165 @@
+package type1
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/speedata/gotex/internal/testfont"
+)
+
+var subrs = []string{
+	"3 0 callothersubr pop pop setcurrentpoint return", // the standard subroutines for flex
+	"0 1 callothersubr return",
+	"0 2 callothersubr return",
+	"return",
+	"3 1 3 callothersubr pop callsubr return", // hint replacement
+	"0 10 hstem 300 20 vstem return",
+}
+
+var glyphs = []struct{ name, prog string }{
+	{".notdef", "0 0 hsbw endchar"},
+	{"A", "20 600 hsbw 0 0 rmoveto 100 0 rlineto " +
+		"1 callsubr 50 0 rmoveto 2 callsubr 20 10 rmoveto 2 callsubr 20 0 rmoveto 2 callsubr 20 -10 rmoveto 2 callsubr " +
+		"20 -10 rmoveto 2 callsubr 20 0 rmoveto 2 callsubr 20 10 rmoveto 2 callsubr 50 290 0 0 callsubr " +
+		"5 4 callsubr 100 vlineto 10 -20 -10 -30 vhcurveto -440 2 div 0 rlineto closepath endchar"},
+	{"B", "0 500 hsbw 1000 hmoveto 2000 -30000 rlineto endchar"},
+	{"ring", "10 300 hsbw 0 500 rmoveto 100 0 rlineto closepath endchar"},
+	{"Aring", "20 600 hsbw 10 150 50 65 202 seac"},
+	{"bad", "0 500 hsbw 99 callsubr endchar"},
+}
+
+// testFont returns the clear text and the decrypted eexec part of a
+// font that uses the alternative names of RD, ND and NP.
+func testFont(t *testing.T) ([]byte, []byte) {
+	f := &testfont.Type1{
+		FontMatrix: "0.001 0 0.0002 0.001 0 0",
+		Encoding:   map[int]string{65: "A", 66: "B", 197: "Aring"},
+		Subrs:      subrs,
+		RD:         "-|",
+		ND:         "|-",
+		NP:         "|",
+	}
+	for _, g := range glyphs {
+		f.Glyphs = append(f.Glyphs, testfont.Glyph{Name: g.name, Prog: g.prog})
+	}
+	return f.Parts(t)
+}
+
+func TestParse(t *testing.T) {
+	clear, private := testFont(t)
+	for i, data := range [][]byte{testfont.PFB(clear, private), testfont.PFA(clear, private)} {
+		f, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.FontName != "Test" || f.FontMatrix != [6]float64{0.001, 0, 0.0002, 0.001, 0, 0} ||
+			f.FontBBox != [4]float64{0, -200, 800, 700} || f.ItalicAngle != -9.5 {
+			t.Errorf("font %d: unexpected font %s %v %v %v", i, f.FontName, f.FontMatrix, f.FontBBox, f.ItalicAngle)
+		}
+		if f.Encoding[65] != "A" || f.Encoding[197] != "Aring" || f.Encoding[67] != "" {
+			t.Errorf("font %d: unexpected encoding %q", i, f.Encoding[60:70])
+		}
+		if len(f.Subrs) != len(subrs) || len(f.CharStrings) != len(glyphs) {
+			t.Fatalf("font %d: %d subrs, %d charstrings", i, len(f.Subrs), len(f.CharStrings))
+		}
+		if !bytes.Equal(f.CharStrings["ring"], testfont.CharString(t, glyphs[3].prog)) {
+			t.Errorf("font %d: ring not decrypted", i)
+		}
+	}
+	for _, data := range [][]byte{nil, []byte("%!PS-AdobeFont-1.0\n"), {0x80, 1, 10, 0, 0, 0}, []byte("eexec\nxyz")} {
+		if _, err := Parse(bytes.NewReader(data)); !errors.Is(err, ErrBadType1) {
+			t.Errorf("%q: want ErrBadType1, got %v", data, err)
+		}
+	}
+}
+
+func p(x, y float64) Point { return Point{x, y} }
+
+func TestGlyph(t *testing.T) {
+	clear, private := testFont(t)
+	f, err := Parse(bytes.NewReader(testfont.PFB(clear, private)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := []Segment{
+		{MoveTo, [3]Point{p(20, 0)}},
+		{LineTo, [3]Point{p(120, 0)}},
+		{CurveTo, [3]Point{p(190, 10), p(210, 10), p(230, 0)}}, // flex
+		{CurveTo, [3]Point{p(250, -10), p(270, -10), p(290, 0)}},
+		{LineTo, [3]Point{p(290, 100)}},
+		{CurveTo, [3]Point{p(290, 110), p(270, 100), p(240, 100)}},
+		{LineTo, [3]Point{p(20, 100)}},
+		{Op: ClosePath},
+	}
+	for _, tc := range []struct {
+		name  string
+		want  Glyph
+		error error
+	}{
+		{name: "A", want: Glyph{Name: "A", SideBearing: p(20, 0), Width: p(600, 0), Path: a}},
+		{name: "B", want: Glyph{Name: "B", Width: p(500, 0), Path: []Segment{{MoveTo, [3]Point{p(1000, 0)}}, {LineTo, [3]Point{p(3000, -30000)}}}}},
+		// the ring is moved by adx - asb + sbx = 160 and ady = 50
+		{name: "Aring", want: Glyph{Name: "Aring", SideBearing: p(20, 0), Width: p(600, 0), Path: append(a[:len(a):len(a)],
+			Segment{MoveTo, [3]Point{p(170, 550)}}, Segment{LineTo, [3]Point{p(270, 550)}}, Segment{Op: ClosePath})}},
+		{name: ".notdef", want: Glyph{Name: ".notdef"}},
+		{name: "bad", error: ErrBadCharString},
+		{name: "missing", error: ErrNoGlyph},
+	} {
+		g, err := f.Glyph(tc.name)
+		if tc.error != nil {
+			if !errors.Is(err, tc.error) {
+				t.Errorf("%s: want %v, got %v", tc.name, tc.error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*g, tc.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tc.name, *g, tc.want)
+		}
+	}
+}
+
+func TestSubset(t *testing.T) {
+	clear, private := testFont(t)
+	f, err := Parse(bytes.NewReader(testfont.PFA(clear, private)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	glyphs := map[string]bool{"Aring": true}
+	sub, err := f.Subset(glyphs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(glyphs) != 1 {
+		t.Error("Subset changed its argument")
+	}
+	var names []string
+	for name := range sub.CharStrings {
+		names = append(names, name)
+	}
+	if len(names) != 4 || sub.CharStrings["A"] == nil || sub.CharStrings["ring"] == nil || sub.CharStrings[".notdef"] == nil {
+		t.Errorf("unexpected glyphs %v in the subset", names)
+	}
+	if len(sub.Subrs) != len(subrs) {
+		t.Errorf("the subset has %d subrs", len(sub.Subrs))
+	}
+	c, enc := sub.FontFile()
+	again, err := Parse(bytes.NewReader(testfont.PFB(c, Decrypt(enc, EexecKey))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(Decrypt(enc, EexecKey)), "/CharStrings 4 dict") {
+		t.Error("the number of CharStrings is wrong")
+	}
+	g1, err1 := f.Glyph("Aring")
+	g2, err2 := again.Glyph("Aring")
+	if err1 != nil || err2 != nil || !reflect.DeepEqual(g1, g2) {
+		t.Errorf("the subset draws Aring differently: %v %v", err1, err2)
+	}
+}
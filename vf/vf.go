@@ -0,0 +1,213 @@
+// Package vf reads virtual font files.
+//
+// A virtual font consists of a TFM file with the metrics and a VF file
+// that tells what each character is made of: a packet of DVI commands
+// that typeset characters of other fonts, rules and specials. The format
+// is described in VFtoVP.
+package vf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/speedata/gotex/tfm"
+)
+
+// ErrBadVF is wrapped by all errors that are caused by an invalid VF file.
+var ErrBadVF = errors.New("VF file is bad")
+
+const (
+	longChar = 242
+	fntDef1  = 243
+	fntDef4  = 246
+	pre      = 247
+	post     = 248
+	vfID     = 202
+)
+
+// Font is the contents of a VF file.
+type Font struct {
+	Comment    string
+	Checksum   uint32      // should match the TFM file
+	DesignSize tfm.FixWord // in points, should match the TFM file
+	Fonts      []FontDef   // the local fonts, the first one is the default font of each packet
+	Chars      map[int]*Char
+}
+
+// FontDef is a local font of a virtual font.
+type FontDef struct {
+	Num        int // font number in the packets
+	Checksum   uint32
+	Scale      tfm.FixWord // the size relative to the design size of the virtual font
+	DesignSize tfm.FixWord // in points
+	Area       string
+	Name       string
+}
+
+// Char is a character packet.
+type Char struct {
+	Code  int
+	Width tfm.FixWord // the width of the character in the TFM file
+	DVI   []byte      // the DVI commands
+}
+
+// Font returns the local font with the number num.
+func (f *Font) Font(num int) (FontDef, bool) {
+	for _, fd := range f.Fonts {
+		if fd.Num == num {
+			return fd, true
+		}
+	}
+	return FontDef{}, false
+}
+
+func bad(format string, a ...interface{}) error {
+	return fmt.Errorf("%w (%s)", ErrBadVF, fmt.Sprintf(format, a...))
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+// num reads an n byte number, signed if n is 4.
+func (r *reader) num(n int) (int, error) {
+	if r.pos+n > len(r.data) {
+		return 0, bad("file ends unexpectedly")
+	}
+	x := 0
+	for i := 0; i < n; i++ {
+		x = x<<8 | int(r.data[r.pos+i])
+	}
+	r.pos += n
+	if n == 4 {
+		x = int(int32(x))
+	}
+	return x, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, bad("file ends unexpectedly")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// Parse reads a VF file.
+func Parse(rd io.Reader) (*Font, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{data: data}
+	if len(data) < 2 || data[0] != pre || data[1] != vfID {
+		return nil, bad("the first bytes are not pre and %d", vfID)
+	}
+	r.pos = 2
+	f := &Font{Chars: make(map[int]*Char)}
+	k, err := r.num(1)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := r.bytes(k)
+	if err != nil {
+		return nil, err
+	}
+	f.Comment = string(comment)
+	cs, err := r.num(4)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := r.num(4)
+	if err != nil {
+		return nil, err
+	}
+	f.Checksum, f.DesignSize = uint32(cs), tfm.FixWord(ds)
+
+	for {
+		o, err := r.num(1)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case o >= fntDef1 && o <= fntDef4:
+			if len(f.Chars) > 0 {
+				return nil, bad("font definition after the first character packet")
+			}
+			fd, err := r.fontDef(o - fntDef1 + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := f.Font(fd.Num); ok {
+				return nil, bad("font %d is defined twice", fd.Num)
+			}
+			f.Fonts = append(f.Fonts, fd)
+		case o <= longChar:
+			c := &Char{}
+			var pl, w int
+			if o == longChar {
+				if pl, err = r.num(4); err == nil {
+					if c.Code, err = r.num(4); err == nil {
+						w, err = r.num(4)
+					}
+				}
+			} else {
+				pl = o
+				if c.Code, err = r.num(1); err == nil {
+					w, err = r.num(3)
+					// the width is a signed three byte number
+					if w >= 0x800000 {
+						w -= 0x1000000
+					}
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			c.Width = tfm.FixWord(w)
+			if c.DVI, err = r.bytes(pl); err != nil {
+				return nil, err
+			}
+			if _, ok := f.Chars[c.Code]; ok {
+				return nil, bad("character %d is defined twice", c.Code)
+			}
+			f.Chars[c.Code] = c
+		case o == post:
+			for _, b := range data[r.pos:] {
+				if b != post {
+					return nil, bad("junk after the postamble")
+				}
+			}
+			return f, nil
+		default:
+			return nil, bad("unexpected command %d at byte %d", o, r.pos-1)
+		}
+	}
+}
+
+func (r *reader) fontDef(n int) (FontDef, error) {
+	var fd FontDef
+	var v [5]int
+	var err error
+	sizes := [5]int{n, 4, 4, 4, 1}
+	for i, size := range sizes {
+		if v[i], err = r.num(size); err != nil {
+			return fd, err
+		}
+	}
+	fd.Num, fd.Checksum, fd.Scale, fd.DesignSize = v[0], uint32(v[1]), tfm.FixWord(v[2]), tfm.FixWord(v[3])
+	a := v[4]
+	l, err := r.num(1)
+	if err != nil {
+		return fd, err
+	}
+	name, err := r.bytes(a + l)
+	if err != nil {
+		return fd, err
+	}
+	fd.Area, fd.Name = string(name[:a]), string(name[a:])
+	return fd, nil
+}
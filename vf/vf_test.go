@@ -0,0 +1,82 @@
+package vf
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/speedata/gotex/tfm"
+)
+
+func quad(b *bytes.Buffer, i int) {
+	b.Write([]byte{byte(i >> 24), byte(i >> 16), byte(i >> 8), byte(i)})
+}
+
+// testVF has the local fonts 0 (cmr10) and 300 (cmbx10 at twice the size),
+// a short packet for A and a long one for B.
+func testVF() []byte {
+	var b bytes.Buffer
+	b.Write([]byte{pre, vfID, 4})
+	b.WriteString("test")
+	quad(&b, 0x12345678)
+	quad(&b, 10<<20)
+	b.Write([]byte{fntDef1, 0})
+	quad(&b, 1)
+	quad(&b, 1<<20)
+	quad(&b, 10<<20)
+	b.Write([]byte{0, 5})
+	b.WriteString("cmr10")
+	b.Write([]byte{fntDef1 + 1, 1, 44})
+	quad(&b, 2)
+	quad(&b, 2<<20)
+	quad(&b, 10<<20)
+	b.Write([]byte{3, 6})
+	b.WriteString("dircmbx10")
+	b.Write([]byte{1, 'A', 0xff, 0xff, 0xff, 'A'})
+	b.WriteByte(longChar)
+	quad(&b, 2)
+	quad(&b, 'B')
+	quad(&b, 1<<19)
+	b.Write([]byte{236, 44})
+	b.Write([]byte{post, post, post, post})
+	return b.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(bytes.NewReader(testVF()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Comment != "test" || f.Checksum != 0x12345678 || f.DesignSize != 10<<20 {
+		t.Errorf("comment %q, checksum %x, design size %s", f.Comment, f.Checksum, f.DesignSize)
+	}
+	fd, ok := f.Font(300)
+	if !ok || fd.Area != "dir" || fd.Name != "cmbx10" || fd.Scale != 2<<20 || fd.Checksum != 2 {
+		t.Errorf("font 300: %+v", fd)
+	}
+	if len(f.Fonts) != 2 || f.Fonts[0].Name != "cmr10" {
+		t.Errorf("fonts %+v", f.Fonts)
+	}
+	if a := f.Chars['A']; a == nil || a.Width != -1 || !bytes.Equal(a.DVI, []byte{'A'}) {
+		t.Errorf("A: %+v", a)
+	}
+	if b := f.Chars['B']; b == nil || b.Width != tfm.FixWord(1<<19) || !bytes.Equal(b.DVI, []byte{236, 44}) {
+		t.Errorf("B: %+v", b)
+	}
+}
+
+func TestParseBad(t *testing.T) {
+	good := testVF()
+	junk := append(append([]byte{}, good...), 0)
+	for name, data := range map[string][]byte{
+		"not a vf":    {pre, 2},
+		"truncated":   good[:len(good)-8],
+		"junk at end": junk,
+		"bad command": append(append([]byte{}, good[:len(good)-4]...), 250),
+		"cut packet":  good[:len(good)-16],
+	} {
+		if _, err := Parse(bytes.NewReader(data)); !errors.Is(err, ErrBadVF) {
+			t.Errorf("%s: want ErrBadVF, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package vftovp converts virtual fonts to virtual property lists (VPL
+// files) like the TeXware program VFtoVP. The output can be read by
+// VPtoVF.
+package vftovp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/tftopl"
+	"github.com/speedata/gotex/vf"
+)
+
+// DVI commands in packets.
+const (
+	set1     = 128
+	setRule  = 132
+	put1     = 133
+	putRule  = 137
+	nop      = 138
+	push     = 141
+	pop      = 142
+	right1   = 143
+	w0       = 147
+	x0       = 152
+	down1    = 157
+	y0       = 161
+	z0       = 166
+	fntNum0  = 171
+	fnt1     = 235
+	xxx1     = 239
+	xxx4     = 242
+	maxStack = 100
+)
+
+// Write writes the virtual property list of the virtual font with the
+// metrics f and the packets v to w.
+func Write(w io.Writer, f *tfm.Font, v *vf.Font) error {
+	pl := &writer{Writer: tftopl.NewWriter(w, f), vf: v}
+	pl.Line("(VTITLE %s)", v.Comment)
+	pl.Line("(COMMENT Please edit that VTITLE if you edit this file)")
+	pl.Header()
+	pl.mapfonts()
+	pl.LigTable()
+	pl.Characters(func(c int) {
+		if vc, ok := v.Chars[c]; ok {
+			pl.packet(vc.DVI)
+		}
+	})
+	if pl.err != nil {
+		return pl.err
+	}
+	return pl.Flush()
+}
+
+type writer struct {
+	*tftopl.Writer
+	vf  *vf.Font
+	err error // the first error in a packet
+}
+
+func (pl *writer) mapfonts() {
+	for _, fd := range pl.vf.Fonts {
+		pl.Open("MAPFONT D %d", fd.Num)
+		pl.Line("(FONTNAME %s)", fd.Name)
+		if fd.Area != "" {
+			pl.Line("(FONTAREA %s)", fd.Area)
+		}
+		pl.Line("(FONTCHECKSUM O %o)", fd.Checksum)
+		pl.Line("(FONTAT %s)", tftopl.Fix(fd.Scale))
+		pl.Line("(FONTDSIZE %s)", tftopl.Fix(fd.DesignSize))
+		pl.Close()
+	}
+}
+
+// packet writes the MAP of a character.
+func (pl *writer) packet(dvi []byte) {
+	if err := pl.mapCommands(dvi); err != nil && pl.err == nil {
+		pl.err = err
+	}
+}
+
+func (pl *writer) mapCommands(dvi []byte) error {
+	bad := func(format string, a ...interface{}) error {
+		return fmt.Errorf("%w (%s)", vf.ErrBadVF, fmt.Sprintf(format, a...))
+	}
+	pos := 0
+	num := func(n int, signed bool) (int, error) {
+		if pos+n > len(dvi) {
+			return 0, bad("packet ends unexpectedly")
+		}
+		a := 0
+		for i := 0; i < n; i++ {
+			a = a<<8 | int(dvi[pos+i])
+		}
+		if signed && dvi[pos] > 127 {
+			a -= 1 << (8 * uint(n))
+		}
+		pos += n
+		return a, nil
+	}
+	move := func(a int, positive, negative string) {
+		if a < 0 {
+			pl.Line("(%s %s)", negative, tftopl.Fix(tfm.FixWord(-a)))
+		} else {
+			pl.Line("(%s %s)", positive, tftopl.Fix(tfm.FixWord(a)))
+		}
+	}
+	cur := 0
+	if len(pl.vf.Fonts) > 0 {
+		cur = pl.vf.Fonts[0].Num
+	}
+	var w, x, y, z int
+	type frame struct{ w, x, y, z int }
+	var stack []frame
+	pl.Open("MAP")
+	defer pl.Close()
+	for pos < len(dvi) {
+		o := int(dvi[pos])
+		pos++
+		var err error
+		var a, b int
+		switch {
+		case o < set1:
+			pl.Line("(SETCHAR %s)", pl.Char(o))
+		case o < setRule || o >= put1 && o < putRule:
+			n := o - set1 + 1
+			if o >= put1 {
+				n = o - put1 + 1
+			}
+			if a, err = num(n, n == 4); err != nil {
+				return err
+			}
+			if o >= put1 {
+				pl.Line("(PUSH)")
+			}
+			pl.Line("(SETCHAR %s)", pl.Char(a))
+			if o >= put1 {
+				pl.Line("(POP)")
+			}
+		case o == setRule || o == putRule:
+			if a, err = num(4, true); err != nil {
+				return err
+			}
+			if b, err = num(4, true); err != nil {
+				return err
+			}
+			if o == putRule {
+				pl.Line("(PUSH)")
+			}
+			pl.Line("(SETRULE %s %s)", tftopl.Fix(tfm.FixWord(a)), tftopl.Fix(tfm.FixWord(b)))
+			if o == putRule {
+				pl.Line("(POP)")
+			}
+		case o == nop:
+		case o == push:
+			if len(stack) >= maxStack {
+				return bad("stack overflow in a packet")
+			}
+			stack = append(stack, frame{w, x, y, z})
+			pl.Line("(PUSH)")
+		case o == pop:
+			if len(stack) == 0 {
+				return bad("pop without push in a packet")
+			}
+			fr := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			w, x, y, z = fr.w, fr.x, fr.y, fr.z
+			pl.Line("(POP)")
+		case o >= right1 && o < w0:
+			if a, err = num(o-right1+1, true); err != nil {
+				return err
+			}
+			move(a, "MOVERIGHT", "MOVELEFT")
+		case o >= w0 && o < x0:
+			if o > w0 {
+				if w, err = num(o-w0, true); err != nil {
+					return err
+				}
+			}
+			move(w, "MOVERIGHT", "MOVELEFT")
+		case o >= x0 && o < down1:
+			if o > x0 {
+				if x, err = num(o-x0, true); err != nil {
+					return err
+				}
+			}
+			move(x, "MOVERIGHT", "MOVELEFT")
+		case o >= down1 && o < y0:
+			if a, err = num(o-down1+1, true); err != nil {
+				return err
+			}
+			move(a, "MOVEDOWN", "MOVEUP")
+		case o >= y0 && o < z0:
+			if o > y0 {
+				if y, err = num(o-y0, true); err != nil {
+					return err
+				}
+			}
+			move(y, "MOVEDOWN", "MOVEUP")
+		case o >= z0 && o < fntNum0:
+			if o > z0 {
+				if z, err = num(o-z0, true); err != nil {
+					return err
+				}
+			}
+			move(z, "MOVEDOWN", "MOVEUP")
+		case o >= fntNum0 && o < xxx1:
+			a = o - fntNum0
+			if o >= fnt1 {
+				if a, err = num(o-fnt1+1, o == fnt1+3); err != nil {
+					return err
+				}
+			}
+			if _, ok := pl.vf.Font(a); !ok {
+				return bad("font %d is not defined", a)
+			}
+			if a != cur {
+				pl.Line("(SELECTFONT D %d)", a)
+				cur = a
+			}
+		case o >= xxx1 && o <= xxx4:
+			if a, err = num(o-xxx1+1, false); err != nil {
+				return err
+			}
+			if pos+a > len(dvi) {
+				return bad("special in a packet is too long")
+			}
+			pl.special(dvi[pos : pos+a])
+			pos += a
+		default:
+			return bad("command %d is not allowed in a packet", o)
+		}
+	}
+	if len(stack) > 0 {
+		return bad("push without pop in a packet")
+	}
+	return nil
+}
+
+// special writes SPECIAL if the text can be represented in a property
+// list, SPECIALHEX otherwise.
+func (pl *writer) special(data []byte) {
+	text := true
+	for _, c := range data {
+		if c < ' ' || c > '~' || c == '(' || c == ')' {
+			text = false
+			break
+		}
+	}
+	if text {
+		pl.Line("(SPECIAL %s)", data)
+		return
+	}
+	pl.Line("(SPECIALHEX %s)", strings.ToUpper(fmt.Sprintf("%x", data)))
+}
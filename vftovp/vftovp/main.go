@@ -0,0 +1,81 @@
+// Command vftovp converts a virtual font (VF file and TFM file) to a
+// virtual property list.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/vf"
+	"github.com/speedata/gotex/vftovp"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: vftovp VFFILE [TFMFILE [VPLFILE]]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 3 {
+		fmt.Fprintln(os.Stderr, "vftovp: Need one to three file arguments.")
+		fmt.Fprintln(os.Stderr, "Try `vftovp --help' for more information.")
+		os.Exit(1)
+	}
+	vfname := flag.Arg(0)
+	if !strings.HasSuffix(vfname, ".vf") {
+		vfname += ".vf"
+	}
+	tfmname := strings.TrimSuffix(vfname, ".vf") + ".tfm"
+	if flag.NArg() > 1 {
+		tfmname = flag.Arg(1)
+	}
+
+	vffile, err := os.Open(vfname)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer vffile.Close()
+	v, err := vf.Parse(vffile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", vfname, err)
+		os.Exit(2)
+	}
+	tfmfile, err := os.Open(tfmname)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer tfmfile.Close()
+	f, err := tfm.Parse(tfmfile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", tfmname, err)
+		os.Exit(2)
+	}
+	if v.Checksum != 0 && f.Checksum != 0 && v.Checksum != f.Checksum {
+		fmt.Fprintln(os.Stderr, "Check sum in VF file being replaced by TFM check sum")
+	}
+	if v.DesignSize != f.DesignSize {
+		fmt.Fprintln(os.Stderr, "Design size in VF file being replaced by TFM design size")
+	}
+
+	var out io.Writer = os.Stdout
+	if flag.NArg() == 3 {
+		vplfile, err := os.Create(flag.Arg(2))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer vplfile.Close()
+		out = vplfile
+	}
+	if err = vftovp.Write(out, f, v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,97 @@
+package vftovp
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/speedata/gotex/tfm"
+	"github.com/speedata/gotex/vf"
+)
+
+func fw(f float64) tfm.FixWord {
+	return tfm.FixWord(math.Round(f * (1 << 20)))
+}
+
+func TestWrite(t *testing.T) {
+	f := &tfm.Font{
+		DesignSize: fw(10),
+		BC:         'A',
+		EC:         'B',
+		CharInfo:   []tfm.CharInfo{{WidthIndex: 1}, {WidthIndex: 1}},
+		Width:      []tfm.FixWord{0, fw(0.5)},
+		Height:     []tfm.FixWord{0},
+		Depth:      []tfm.FixWord{0},
+		Italic:     []tfm.FixWord{0},
+	}
+	v := &vf.Font{
+		Comment:    "test",
+		DesignSize: fw(10),
+		Fonts: []vf.FontDef{
+			{Num: 0, Checksum: 8, Scale: fw(1), DesignSize: fw(10), Name: "cmr10"},
+			{Num: 5, Scale: fw(0.5), DesignSize: fw(10), Area: "x", Name: "cmbx10"},
+		},
+		Chars: map[int]*vf.Char{
+			'A': {Code: 'A', Width: fw(0.5), DVI: []byte{
+				push, right1 + 2, 0xfe, 0x66, 0x66, 'A', pop, // left 0.1
+				fntNum0 + 5, set1, 200, w0 + 1, 0x10, w0, // right twice
+				putRule, 0, 0x10, 0, 0, 0, 0x20, 0, 0,
+				y0 + 3, 0x01, 0, 0, xxx1, 3, 'a', '(', 'b', xxx1, 2, 'o', 'k',
+			}},
+		},
+	}
+	exp := `(VTITLE test)
+(COMMENT Please edit that VTITLE if you edit this file)
+(DESIGNSIZE R 10.0)
+(COMMENT DESIGNSIZE IS IN POINTS)
+(COMMENT OTHER SIZES ARE MULTIPLES OF DESIGNSIZE)
+(CHECKSUM O 0)
+(MAPFONT D 0
+   (FONTNAME cmr10)
+   (FONTCHECKSUM O 10)
+   (FONTAT R 1.0)
+   (FONTDSIZE R 10.0)
+   )
+(MAPFONT D 5
+   (FONTNAME cmbx10)
+   (FONTAREA x)
+   (FONTCHECKSUM O 0)
+   (FONTAT R 0.5)
+   (FONTDSIZE R 10.0)
+   )
+(CHARACTER C A
+   (CHARWD R 0.5)
+   (MAP
+      (PUSH)
+      (MOVELEFT R 0.1)
+      (SETCHAR C A)
+      (POP)
+      (SELECTFONT D 5)
+      (SETCHAR O 310)
+      (MOVERIGHT R 0.000015)
+      (MOVERIGHT R 0.000015)
+      (PUSH)
+      (SETRULE R 1.0 R 2.0)
+      (POP)
+      (MOVEDOWN R 0.0625)
+      (SPECIALHEX 612862)
+      (SPECIAL ok)
+      )
+   )
+(CHARACTER C B
+   (CHARWD R 0.5)
+   )
+`
+	var b bytes.Buffer
+	if err := Write(&b, f, v); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != exp {
+		t.Errorf("unexpected property list:\n%s", b.String())
+	}
+	v.Chars['B'] = &vf.Char{Code: 'B', DVI: []byte{pop}}
+	if err := Write(&b, f, v); !errors.Is(err, vf.ErrBadVF) {
+		t.Errorf("want ErrBadVF, got %v", err)
+	}
+}